@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	accountRiot  = "riot"
+	accountSteam = "steam"
+)
+
+var accountChoices = []*discordgo.ApplicationCommandOptionChoice{
+	{Name: "Riot", Value: accountRiot},
+	{Name: "Steam", Value: accountSteam},
+}
+
+var linkCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-link",
+	Description: "Link a game account, required to join some queues",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "provider",
+			Description: "Which account to link",
+			Required:    true,
+			Choices:     accountChoices,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "account",
+			Description: "Riot ID (name#tag) or Steam ID; empty unlinks",
+			MaxLength:   64,
+		},
+	},
+}
+
+func accountName(provider string) string {
+	for _, c := range accountChoices {
+		if c.Value == provider {
+			return c.Name
+		}
+	}
+	return provider
+}
+
+// missingAccountLocked returns the account provider the queue requires that
+// the user hasn't linked, or "" if they can join.
+// lock must be held
+func (q *queueState) missingAccountLocked(userID string) string {
+	provider := q.configs.get(q.guildID).RequiredAccounts[q.name]
+	if provider == "" || q.accounts[userID][provider] != "" {
+		return ""
+	}
+	return provider
+}
+
+func (q *queueState) handleLink(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	opts := optionMap(i.ApplicationCommandData().Options)
+	provider := opts["provider"].StringValue()
+	var account string
+	if opt, ok := opts["account"]; ok {
+		account = strings.TrimSpace(opt.StringValue())
+	}
+	user := i.Member.User
+	if account == "" {
+		delete(q.accounts[user.ID], provider)
+		respondEphemeral(s, i, fmt.Sprintf("Unlinked your %s account.", accountName(provider)))
+		return
+	}
+	if provider == accountRiot && !strings.Contains(account, "#") {
+		respondEphemeral(s, i, "Riot IDs look like name#tag.")
+		return
+	}
+	if q.accounts[user.ID] == nil {
+		q.accounts[user.ID] = make(map[string]string)
+	}
+	q.accounts[user.ID][provider] = account
+	respondEphemeral(s, i, fmt.Sprintf("Linked your %s account %s.", accountName(provider), account))
+}
+
+func (q *queueState) configAccount(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	var name string
+	if opt, ok := opts["name"]; ok {
+		name = normalizeQueueName(opt.StringValue())
+	}
+	provider := opts["provider"].StringValue()
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		if cfg.RequiredAccounts == nil {
+			cfg.RequiredAccounts = make(map[string]string)
+		}
+		if provider == "none" {
+			delete(cfg.RequiredAccounts, name)
+		} else {
+			cfg.RequiredAccounts[name] = provider
+		}
+	}); err != nil {
+		return "", err
+	}
+	queue := "the default queue"
+	if name != "" {
+		queue = "the " + name + " queue"
+	}
+	if provider == "none" {
+		return fmt.Sprintf("Joining %s no longer needs a linked account.", queue), nil
+	}
+	return fmt.Sprintf("Joining %s now needs a linked %s account.", queue, accountName(provider)), nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var altCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-alt",
+	Description: "Admin command to flag or unflag a member as an alt account",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionUser,
+			Name:        "user",
+			Description: "Member to flag",
+			Required:    true,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionUser,
+			Name:        "main",
+			Description: "Their main account, if known",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+			Name:        "remove",
+			Description: "Remove the flag instead",
+		},
+	},
+}
+
+// altFlag marks a member as an alt account. Main is empty if unknown.
+type altFlag struct {
+	Main *discordgo.User `json:"main,omitempty"`
+}
+
+func (q *queueState) handleAlt(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !q.configs.get(q.guildID).isAdmin(i.Member) {
+		respondEphemeral(s, i, "Only admins can use this command.")
+		return
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	data := i.ApplicationCommandData()
+	opts := optionMap(data.Options)
+	user := resolvedUser(data, opts["user"])
+	if opt, ok := opts["remove"]; ok && opt.BoolValue() {
+		delete(q.alts, user.ID)
+		respondEphemeral(s, i, fmt.Sprintf("<@%s> is no longer flagged as an alt.", user.ID))
+	} else {
+		flag := &altFlag{}
+		if opt, ok := opts["main"]; ok {
+			flag.Main = resolvedUser(data, opt)
+		}
+		q.alts[user.ID] = flag
+		respondEphemeral(s, i, fmt.Sprintf("Flagged <@%s> as an alt.", user.ID))
+	}
+	log.Printf("alt flag for %s (%s) changed by %s (%s)\n", user.Username, user.ID, i.Member.User.Username, i.Member.User.ID)
+
+	for _, qu := range q.openQueuesLocked() {
+		q.selectQueueLocked(qu)
+		if q.isQueuedLocked(user.ID) {
+			q.refreshLocked(s)
+		}
+	}
+}
+
+func (q *queueState) configRanked(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	var name string
+	if opt, ok := opts["name"]; ok {
+		name = normalizeQueueName(opt.StringValue())
+	}
+	ranked := opts["ranked"].BoolValue()
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		cfg.RankedQueues = removeString(cfg.RankedQueues, name)
+		if ranked {
+			cfg.RankedQueues = append(cfg.RankedQueues, name)
+		}
+	}); err != nil {
+		return "", err
+	}
+	queue := "The default queue"
+	if name != "" {
+		queue = "The " + name + " queue"
+	}
+	if ranked {
+		return queue + " is now ranked, so members flagged as alts can't join it.", nil
+	}
+	return queue + " is no longer ranked.", nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// apiQueue is a queue as the REST API shows it.
+type apiQueue struct {
+	Guild     string         `json:"guild"`
+	Name      string         `json:"name"`
+	Open      bool           `json:"open"`
+	ChannelID string         `json:"channel_id,omitempty"`
+	MessageID string         `json:"message_id,omitempty"`
+	Size      int            `json:"size"`
+	OpenedBy  string         `json:"opened_by,omitempty"`
+	OpenedAt  time.Time      `json:"opened_at"`
+	Users     []publicMember `json:"users"`
+	Waitlist  []publicMember `json:"waitlist"`
+}
+
+// registerAPI serves the REST API for dashboards and stream overlays. Every
+// endpoint takes the guild and queue query parameters, the home guild and
+// the default queue by default, and needs the guild's API token as a bearer
+// token.
+func (g *guildStates) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/queue", g.apiRoute(func(w http.ResponseWriter, r *http.Request, q *queueState) {
+		writeAPIQueue(w, q)
+	}))
+	mux.HandleFunc("POST /api/queue/close", g.apiRoute(g.handleAPIClose))
+	mux.HandleFunc("POST /api/queue/kick", g.apiRoute(g.handleAPIKick))
+}
+
+// apiRoute finds the guild and checks its token, then runs next with the
+// requested queue selected and the lock held. The state is saved after a
+// POST.
+func (g *guildStates) apiRoute(next func(w http.ResponseWriter, r *http.Request, q *queueState)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guildID := r.URL.Query().Get("guild")
+		if guildID == "" {
+			guildID = GuildID
+		}
+		g.Lock()
+		q, ok := g.states[guildID]
+		g.Unlock()
+		if !ok {
+			http.Error(w, "unknown guild", http.StatusNotFound)
+			return
+		}
+		cfg := g.configs.get(guildID)
+		homeToken := ""
+		if guildID == GuildID {
+			homeToken = current(&APIToken)
+		}
+		if cfg.APITokenHash == "" && homeToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !validAPIToken(cfg, homeToken, token) {
+			http.Error(w, "invalid API token", http.StatusUnauthorized)
+			return
+		}
+
+		q.Lock()
+		defer q.Unlock()
+		name := normalizeQueueName(r.URL.Query().Get("queue"))
+		if _, ok := q.queues[name]; !ok && name != "" {
+			http.Error(w, "unknown queue", http.StatusNotFound)
+			return
+		}
+		q.selectQueueLocked(q.queueLocked(name))
+		next(w, r, q)
+		if r.Method == http.MethodPost {
+			q.saveStateLocked()
+		}
+	}
+}
+
+// validAPIToken reports whether token is the guild's API token, or
+// homeToken for the home guild.
+func validAPIToken(cfg guildConfig, homeToken, token string) bool {
+	if homeToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(homeToken)) == 1 {
+		return true
+	}
+	return cfg.APITokenHash != "" && subtle.ConstantTimeCompare([]byte(apiTokenHash(token)), []byte(cfg.APITokenHash)) == 1
+}
+
+func apiTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (q *queueState) configAPIToken(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	action := opts["action"].StringValue()
+	var token string
+	if action == "new" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			log.Printf("error making API token: %v\n", err)
+			return "Couldn't make a token, try again.", nil
+		}
+		token = hex.EncodeToString(b)
+	}
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		cfg.APITokenHash = ""
+		if token != "" {
+			cfg.APITokenHash = apiTokenHash(token)
+		}
+	}); err != nil {
+		return "", err
+	}
+	if token == "" {
+		return "This server's API token no longer works.", nil
+	}
+	return fmt.Sprintf("This server's API token is `%s`. It only works for this server, and replaces the last one. Keep it safe, it won't be shown again.", token), nil
+}
+
+// writeAPIQueue writes the selected queue.
+// lock must be held
+func writeAPIQueue(w http.ResponseWriter, q *queueState) {
+	qu := apiQueue{
+		Guild:     q.guildID,
+		Name:      q.name,
+		Open:      q.currentMsgID != "",
+		ChannelID: q.channelID,
+		MessageID: q.currentMsgID,
+		Size:      q.size,
+		OpenedBy:  userID(q.openedBy),
+		OpenedAt:  q.openedAt,
+		Users:     publicMembers(q.users),
+		Waitlist:  publicMembers(q.waitlist),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(qu); err != nil {
+		log.Printf("error writing API queue: %v\n", err)
+	}
+}
+
+// handleAPIClose closes the queue like its Close button, except there's no
+// undo.
+// lock must be held
+func (g *guildStates) handleAPIClose(w http.ResponseWriter, r *http.Request, q *queueState) {
+	if q.currentMsgID == "" {
+		http.Error(w, "there is no active queue", http.StatusConflict)
+		return
+	}
+	log.Printf("queue %s closed through the API\n", q.currentMsgID)
+	q.closeQueueLocked(g.s)
+	writeAPIQueue(w, q)
+}
+
+// handleAPIKick removes the member given by the user query parameter from
+// the queue or its waitlist, like /standby-kick.
+// lock must be held
+func (g *guildStates) handleAPIKick(w http.ResponseWriter, r *http.Request, q *queueState) {
+	id := r.URL.Query().Get("user")
+	if q.currentMsgID == "" || id == "" || !q.isQueuedLocked(id) {
+		http.Error(w, "user isn't in the queue", http.StatusNotFound)
+		return
+	}
+	m := q.queuedMemberLocked(id)
+	q.kickLocked(m.User)
+	log.Printf("%s (%s) kicked from queue %s through the API\n", m.Username, m.ID, q.currentMsgID)
+	q.refreshLocked(g.s)
+	writeAPIQueue(w, q)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// TestAPIQueueTrimsMembers checks the public API only shows who is queued,
+// not the rest of their Discord profile.
+func TestAPIQueueTrimsMembers(t *testing.T) {
+	q := &queueState{guildID: "guild"}
+	q.selectQueueLocked(newQueue(""))
+	q.size = 5
+	q.users = []*queueMember{{
+		User:     &discordgo.User{ID: "1", Username: "ana", Email: "ana@example.com", Locale: "en-US", Flags: 64},
+		Source:   joinSourceButton,
+		JoinedAt: time.Unix(1700000000, 0).UTC(),
+	}}
+
+	w := httptest.NewRecorder()
+	writeAPIQueue(w, q)
+
+	var got struct {
+		Users    []map[string]any `json:"users"`
+		Waitlist []map[string]any `json:"waitlist"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Waitlist == nil {
+		t.Error("empty waitlist isn't written as []")
+	}
+	if len(got.Users) != 1 {
+		t.Fatalf("got %d users, want 1", len(got.Users))
+	}
+	var keys []string
+	for k := range got.Users[0] {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	if want := []string{"id", "joined_at", "source", "username"}; !slices.Equal(keys, want) {
+		t.Errorf("user has fields %v, want %v", keys, want)
+	}
+	if got.Users[0]["id"] != "1" || got.Users[0]["username"] != "ana" {
+		t.Errorf("user is %v, want id 1 and username ana", got.Users[0])
+	}
+}
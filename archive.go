@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxEmbedFieldLength is the most characters Discord allows in an embed
+// field value.
+const maxEmbedFieldLength = 1024
+
+// archiveLocked posts a summary of the queue that's closing to the guild's
+// archive channel, so its history stays visible once the queue message is
+// reused.
+// lock must be held
+func (q *queueState) archiveLocked(s *discordgo.Session, status string) {
+	archiveChannelID := q.configs.get(q.guildID).ArchiveChannelID
+	if archiveChannelID == "" || q.openedBy == nil {
+		return
+	}
+	participants := make([]*participant, 0, len(q.participants))
+	for _, p := range q.participants {
+		participants = append(participants, p)
+	}
+	sort.Slice(participants, func(a, b int) bool {
+		return participants[a].JoinedAt.Before(participants[b].JoinedAt)
+	})
+
+	var played, queued []string
+	for _, p := range participants {
+		line := fmt.Sprintf("<@%s>", p.ID)
+		if p.Flaked {
+			line += " (left after the fill)"
+		}
+		if p.Played {
+			played = append(played, line)
+		} else {
+			queued = append(queued, line)
+		}
+	}
+
+	embed := createQueueEmbed(q.titleLocked(), fmt.Sprintf("%s\nOpened by <@%s> <t:%d:f>.\n%s",
+		status, q.openedBy.ID, q.openedAt.Unix(), q.closedStatsLocked()), q.configs.get(q.guildID).Embed)
+	embed.Color = 0x99AAB5
+	if len(played) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Played", Value: archiveList(played)})
+	}
+	if len(queued) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Also queued", Value: archiveList(queued)})
+	}
+	if _, err := s.ChannelMessageSendComplex(archiveChannelID, &discordgo.MessageSend{
+		Embeds:          []*discordgo.MessageEmbed{embed},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}); err != nil {
+		log.Printf("error archiving queue: %v\n", err)
+	}
+}
+
+// archiveList joins lines for an embed field, cutting it short if it would
+// be too long.
+func archiveList(lines []string) string {
+	var sb strings.Builder
+	for idx, line := range lines {
+		more := fmt.Sprintf("…and %d more", len(lines)-idx)
+		if sb.Len()+len(line)+len(more)+2 > maxEmbedFieldLength {
+			sb.WriteString(more)
+			break
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// jobRenderBoard edits a channel's game board with the queues open in
+	// it, coalescing changes like jobRenderQueue.
+	jobRenderBoard = "render_board"
+	// maxBoardButtons is how many Join buttons fit on a message, five rows
+	// of five.
+	maxBoardButtons = 25
+)
+
+func boardJobKey(channelID string) string {
+	return jobRenderBoard + ":" + channelID
+}
+
+// updateBoardLocked schedules an update of the game board in the selected
+// queue's channel, for guilds with GameBoard set.
+// lock must be held
+func (q *queueState) updateBoardLocked() {
+	if !q.configs.get(q.guildID).GameBoard || q.channelID == "" {
+		return
+	}
+	q.scheduleBoardLocked(q.channelID)
+}
+
+// scheduleBoardLocked updates the channel's game board after renderInterval,
+// unless an update is already pending.
+// lock must be held
+func (q *queueState) scheduleBoardLocked(channelID string) {
+	key := boardJobKey(channelID)
+	if _, pending := q.scheduler.jobs[key]; pending {
+		return
+	}
+	q.scheduler.scheduleLocked(jobRenderBoard, key, time.Now().Add(renderInterval), channelID)
+}
+
+// runBoardJobLocked brings the channel's game board in line with the queues
+// open in it. The board is posted and pinned when the first queue opens,
+// reposted if it was deleted, and deleted once GameBoard is turned off.
+// lock must be held
+func (q *queueState) runBoardJobLocked(s *discordgo.Session, j *job) {
+	channelID := j.Args[0]
+	msgID := q.boards[channelID]
+	if !q.configs.get(q.guildID).GameBoard {
+		if msgID != "" {
+			if err := s.ChannelMessageDelete(channelID, msgID); err != nil && !messageGone(err) {
+				log.Printf("error deleting game board %s: %v\n", msgID, err)
+			}
+			delete(q.boards, channelID)
+		}
+		return
+	}
+
+	var open []*queue
+	for _, qu := range q.openQueuesLocked() {
+		if qu.channelID == channelID {
+			open = append(open, qu)
+		}
+	}
+	content, components := q.boardMessageLocked(open)
+	if msgID != "" {
+		_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:              msgID,
+			Channel:         channelID,
+			Content:         &content,
+			Components:      &components,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err == nil {
+			return
+		}
+		if !messageGone(err) {
+			log.Printf("error editing game board %s: %v\n", msgID, err)
+			return
+		}
+		log.Printf("game board %s is gone, posting it again\n", msgID)
+		delete(q.boards, channelID)
+	}
+	// A board is only posted once there's something on it; after that it
+	// stays, saying nothing is open, so it isn't pinned again every time.
+	if len(open) == 0 {
+		return
+	}
+	msg, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         content,
+		Components:      components,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Printf("error posting game board in %s: %v\n", channelID, err)
+		return
+	}
+	q.boards[channelID] = msg.ID
+	if err := s.ChannelMessagePin(channelID, msg.ID); err != nil {
+		log.Printf("error pinning game board %s: %v\n", msg.ID, err)
+	}
+}
+
+// boardMessageLocked returns the game board listing the open queues with
+// how full they are, and a Join button for each of the first
+// maxBoardButtons.
+// lock must be held
+func (q *queueState) boardMessageLocked(open []*queue) (string, []discordgo.MessageComponent) {
+	if len(open) == 0 {
+		return "### Open queues\nNo queues are open right now.", []discordgo.MessageComponent{}
+	}
+	lines := []string{"### Open queues"}
+	var rows []discordgo.MessageComponent
+	var buttons []discordgo.MessageComponent
+	for _, qu := range open {
+		title := qu.displayTitle()
+		line := fmt.Sprintf("[%s](https://discord.com/channels/%s/%s/%s) — %d/%d queued", title, q.guildID, qu.channelID, qu.currentMsgID, len(qu.users), qu.size)
+		if len(qu.waitlist) > 0 {
+			line += fmt.Sprintf(", %d on the waitlist", len(qu.waitlist))
+		}
+		lines = append(lines, line)
+
+		if len(rows)*5+len(buttons) >= maxBoardButtons {
+			continue
+		}
+		// Button labels can't be longer than 80 characters.
+		label := []rune("Join " + title)
+		if len(label) > 80 {
+			label = append(label[:79], '…')
+		}
+		buttons = append(buttons, discordgo.Button{
+			Label:    string(label),
+			Style:    discordgo.PrimaryButton,
+			CustomID: queueCustomID("join_queue", qu.name),
+		})
+		if len(buttons) == 5 {
+			rows = append(rows, discordgo.ActionsRow{Components: buttons})
+			buttons = nil
+		}
+	}
+	if len(buttons) > 0 {
+		rows = append(rows, discordgo.ActionsRow{Components: buttons})
+	}
+	return strings.Join(lines, "\n"), rows
+}
+
+func (q *queueState) configGameBoard(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	enabled := opts["enabled"].BoolValue()
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		cfg.GameBoard = enabled
+	}); err != nil {
+		return "", err
+	}
+
+	q.Lock()
+	defer q.Unlock()
+	// Boards are posted for the queues already open, or taken down.
+	channels := make(map[string]bool)
+	for channelID := range q.boards {
+		channels[channelID] = true
+	}
+	for _, qu := range q.openQueuesLocked() {
+		channels[qu.channelID] = true
+	}
+	for channelID := range channels {
+		q.scheduleBoardLocked(channelID)
+	}
+	q.saveStateLocked()
+
+	if !enabled {
+		return "Game boards are turned off, and the pinned ones will be deleted.", nil
+	}
+	return "Each channel with open queues now gets a pinned game board listing them, with a Join button for each.", nil
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// noTeam marks an empty side of a match: a bye in the first round, or a
+// winner that hasn't been decided yet in later rounds.
+const noTeam = -1
+
+var bracketCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-bracket",
+	Description: "Admin command to run an in-house single-elimination bracket",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "start",
+			Description: "Seed teams from the current queue and post the bracket",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "team_size",
+					Description: fmt.Sprintf("Players per team (default %d)", MaxQueueSize),
+					MinValue:    ptr(1.0),
+					MaxValue:    10,
+				},
+				queueNameOption("Queue to take sign-ups from"),
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "report",
+			Description: "Report the winner of a match",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "match",
+					Description: "Match number from the bracket",
+					Required:    true,
+					MinValue:    ptr(1.0),
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Name:        "team",
+					Description: "Number of the winning team",
+					Required:    true,
+					MinValue:    ptr(1.0),
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "end",
+			Description: "Stop tracking the current bracket",
+		},
+	},
+}
+
+// bracketMatch is a match between two teams, by index into bracket.teams.
+type bracketMatch struct {
+	a, b   int
+	winner int
+	// scoreA and scoreB are set when captains confirmed a score
+	scoreA, scoreB int
+	report         *scoreReport
+	veto           *mapVeto
+}
+
+// bracket is a single-elimination bracket seeded from queue sign-ups.
+type bracket struct {
+	channelID string
+	msgID     string
+	teams     [][]*discordgo.User
+	// subs are sign-ups that didn't fill a whole team
+	subs   []*discordgo.User
+	rounds [][]*bracketMatch
+}
+
+// newBracket shuffles players into teams of teamSize and pairs them up,
+// padding the first round with byes to a power of two.
+func newBracket(players []*discordgo.User, teamSize int) *bracket {
+	players = append([]*discordgo.User(nil), players...)
+	rand.Shuffle(len(players), func(i, j int) { players[i], players[j] = players[j], players[i] })
+
+	b := &bracket{}
+	for len(players) >= teamSize {
+		b.teams = append(b.teams, players[:teamSize])
+		players = players[teamSize:]
+	}
+	b.subs = players
+
+	slots := 1
+	for slots < len(b.teams) {
+		slots *= 2
+	}
+	// Seed i plays seed slots-1-i, so byes go to the top seeds.
+	var first []*bracketMatch
+	for i := 0; i < slots/2; i++ {
+		m := &bracketMatch{a: i, b: slots - 1 - i, winner: noTeam}
+		if m.b >= len(b.teams) {
+			m.b = noTeam
+		}
+		first = append(first, m)
+	}
+	b.rounds = append(b.rounds, first)
+	for prev := first; len(prev) > 1; prev = b.rounds[len(b.rounds)-1] {
+		next := make([]*bracketMatch, len(prev)/2)
+		for i := range next {
+			next[i] = &bracketMatch{a: noTeam, b: noTeam, winner: noTeam}
+		}
+		b.rounds = append(b.rounds, next)
+	}
+	b.advance()
+	return b
+}
+
+// advance fills later rounds from the winners of earlier ones. Byes win
+// automatically, and results that no longer match their teams after a
+// correction are cleared.
+func (b *bracket) advance() {
+	for r, round := range b.rounds {
+		for k, m := range round {
+			if r > 0 {
+				wa, wb := b.rounds[r-1][2*k].winner, b.rounds[r-1][2*k+1].winner
+				if wa != m.a || wb != m.b {
+					m.a, m.b = wa, wb
+					m.veto = nil
+				}
+			}
+			if m.winner != noTeam && m.winner != m.a && m.winner != m.b {
+				m.winner = noTeam
+				m.scoreA, m.scoreB = 0, 0
+			}
+			if r == 0 && m.b == noTeam {
+				m.winner = m.a
+			}
+		}
+	}
+}
+
+// match returns the match with the 1-based number shown in the bracket.
+func (b *bracket) match(number int) *bracketMatch {
+	for _, round := range b.rounds {
+		if number <= len(round) {
+			return round[number-1]
+		}
+		number -= len(round)
+	}
+	return nil
+}
+
+func (b *bracket) roundName(r int) string {
+	switch len(b.rounds) - r {
+	case 1:
+		return "Final"
+	case 2:
+		return "Semifinals"
+	}
+	return fmt.Sprintf("Round %d", r+1)
+}
+
+func teamName(team int) string {
+	if team == noTeam {
+		return "TBD"
+	}
+	return fmt.Sprintf("Team %d", team+1)
+}
+
+func (b *bracket) String() string {
+	var sb strings.Builder
+	sb.WriteString("### Bracket\n")
+	for i, team := range b.teams {
+		sb.WriteString(fmt.Sprintf("**%s:** <@%s> (c) %s\n", teamName(i), team[0].ID, userMentions(team[1:])))
+	}
+	if len(b.subs) > 0 {
+		sb.WriteString(fmt.Sprintf("**Subs:** %s\n", userMentions(b.subs)))
+	}
+
+	number := 0
+	for r, round := range b.rounds {
+		sb.WriteString(fmt.Sprintf("\n**%s**\n", b.roundName(r)))
+		for _, m := range round {
+			number++
+			switch {
+			case r == 0 && m.b == noTeam:
+				sb.WriteString(fmt.Sprintf("Match %d: %s has a bye\n", number, teamName(m.a)))
+			case m.winner != noTeam && m.scoreA+m.scoreB > 0:
+				sb.WriteString(fmt.Sprintf("Match %d: %s vs %s, **%s** won %d-%d\n", number, teamName(m.a), teamName(m.b), teamName(m.winner), max(m.scoreA, m.scoreB), min(m.scoreA, m.scoreB)))
+			case m.winner != noTeam:
+				sb.WriteString(fmt.Sprintf("Match %d: %s vs %s, **%s** won\n", number, teamName(m.a), teamName(m.b), teamName(m.winner)))
+			default:
+				sb.WriteString(fmt.Sprintf("Match %d: %s vs %s\n", number, teamName(m.a), teamName(m.b)))
+			}
+			if m.veto != nil && m.veto.side != "" {
+				sb.WriteString(fmt.Sprintf("-# on %s\n", m.veto.finalMap()))
+			}
+		}
+	}
+
+	if champion := b.rounds[len(b.rounds)-1][0].winner; champion != noTeam {
+		sb.WriteString(fmt.Sprintf("\n:trophy: %s wins: %s\n", teamName(champion), userMentions(b.teams[champion])))
+	}
+	return sb.String()
+}
+
+func userMentions(users []*discordgo.User) string {
+	mentions := make([]string, len(users))
+	for i, u := range users {
+		mentions[i] = fmt.Sprintf("<@%s>", u.ID)
+	}
+	return strings.Join(mentions, " ")
+}
+
+func (q *queueState) handleBracket(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !q.configs.get(q.guildID).isAdmin(i.Member) {
+		respondEphemeral(s, i, "Only admins can use this command.")
+		return
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	sub := i.ApplicationCommandData().Options[0]
+	opts := optionMap(sub.Options)
+	switch sub.Name {
+	case "start":
+		q.startBracketLocked(s, i, opts)
+	case "report":
+		q.reportBracketLocked(s, i, opts)
+	case "end":
+		if q.bracket == nil {
+			respondEphemeral(s, i, "There is no bracket running.")
+			return
+		}
+		q.bracket = nil
+		respondEphemeral(s, i, "Bracket ended.")
+	}
+}
+
+// startBracketLocked uses everyone in the open queue and waitlist as
+// sign-ups, then closes the queue.
+// lock must be held
+func (q *queueState) startBracketLocked(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	teamSize := MaxQueueSize
+	if opt, ok := opts["team_size"]; ok {
+		teamSize = int(opt.IntValue())
+	}
+	q.selectQueueLocked(q.commandQueueLocked(i.ChannelID, i.ApplicationCommandData().Options[0].Options))
+	if q.currentMsgID == "" {
+		respondEphemeral(s, i, "Open a queue with /standby to collect sign-ups first.")
+		return
+	}
+	var players []*discordgo.User
+	for _, m := range append(q.users, q.waitlist...) {
+		players = append(players, m.User)
+	}
+	if len(players) < 2*teamSize {
+		respondEphemeral(s, i, fmt.Sprintf("Need at least %d sign-ups for teams of %d, the queue has %d.", 2*teamSize, teamSize, len(players)))
+		return
+	}
+
+	b := newBracket(players, teamSize)
+	b.channelID = q.channelID
+	msg, err := s.ChannelMessageSendComplex(b.channelID, &discordgo.MessageSend{
+		Content: b.String(),
+	})
+	if err != nil {
+		log.Printf("interaction %s: error sending bracket: %v\n", interactionRef(i), err)
+		respondError(s, i, "Couldn't post the bracket.")
+		return
+	}
+	b.msgID = msg.ID
+	q.bracket = b
+	log.Printf("bracket %s started by %s (%s) with %d teams\n", b.msgID, i.Member.User.Username, i.Member.User.ID, len(b.teams))
+	respondEphemeral(s, i, "Bracket posted. Report results with /standby-bracket report.")
+	q.closeQueueLocked(s)
+}
+
+// lock must be held
+func (q *queueState) reportBracketLocked(s *discordgo.Session, i *discordgo.InteractionCreate, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	b := q.bracket
+	if b == nil {
+		respondEphemeral(s, i, "There is no bracket running.")
+		return
+	}
+	m := b.match(int(opts["match"].IntValue()))
+	if m == nil {
+		respondEphemeral(s, i, "There's no match with that number.")
+		return
+	}
+	team := int(opts["team"].IntValue()) - 1
+	if m.a == noTeam || m.b == noTeam {
+		respondEphemeral(s, i, "That match isn't ready to be played yet.")
+		return
+	}
+	if team != m.a && team != m.b {
+		respondEphemeral(s, i, fmt.Sprintf("%s isn't playing in that match.", teamName(team)))
+		return
+	}
+
+	if m.report != nil {
+		q.resolveScoreReportLocked(s, m, "Result set by an admin instead.")
+	}
+	m.winner = team
+	m.scoreA, m.scoreB = 0, 0
+	b.advance()
+	q.editBracketLocked(s)
+	respondEphemeral(s, i, fmt.Sprintf("Recorded %s as the winner.", teamName(team)))
+}
+
+// lock must be held
+func (q *queueState) editBracketLocked(s *discordgo.Session) {
+	content := q.bracket.String()
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:      q.bracket.msgID,
+		Channel: q.bracket.channelID,
+		Content: &content,
+	}); err != nil {
+		log.Printf("error editing bracket: %v\n", err)
+	}
+}
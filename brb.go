@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// defaultBrbMinutes is how long /standby-brb holds a slot without a duration.
+const defaultBrbMinutes = 15
+
+var brbCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-brb",
+	Description: "Hold your queue slot while you step away; run again when you're back",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "minutes",
+			Description: fmt.Sprintf("How long to hold your slot (default %d)", defaultBrbMinutes),
+			MinValue:    ptr(1.0),
+			MaxValue:    60,
+		},
+	},
+}
+
+// lastSlotBrbLocked reports whether the player whose join filled the queue
+// is away, which holds the fill notification until they're back. Anyone
+// else who stepped away was already in before the queue filled, so they
+// don't hold up the rest.
+// lock must be held
+func (q *queueState) lastSlotBrbLocked() bool {
+	if q.size <= 0 || len(q.users) < q.size {
+		return false
+	}
+	return !q.users[q.size-1].BrbUntil.IsZero()
+}
+
+// clearBrbLocked marks the user as back, reporting whether they were away.
+// lock must be held
+func (q *queueState) clearBrbLocked(userID string) bool {
+	for _, m := range q.users {
+		if m.ID == userID && !m.BrbUntil.IsZero() {
+			m.BrbUntil = time.Time{}
+			return true
+		}
+	}
+	return false
+}
+
+// checkBrbLocked releases the slots of players who haven't come back in time
+// to the waitlist.
+// lock must be held
+func (q *queueState) checkBrbLocked(s *discordgo.Session) {
+	if q.currentMsgID == "" {
+		return
+	}
+	var expired []*queueMember
+	for _, m := range q.users {
+		if !m.BrbUntil.IsZero() && time.Now().After(m.BrbUntil) {
+			expired = append(expired, m)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	for _, m := range expired {
+		q.recordActionLocked("leave", m.User)
+		q.recordWaitLocked(m)
+		delete(q.ready, m.ID)
+		q.removeUserLocked(m.ID)
+		log.Printf("released brb slot of %s (%s)\n", m.Username, m.ID)
+		q.notifyLocked(s, m.ID, notifyRemoved, "You didn't come back in time, so your standby slot was released.")
+	}
+	q.promoteLocked()
+	q.refreshLocked(s)
+}
+
+func (q *queueState) handleBrb(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	user := i.Member.User
+	for _, qu := range q.queues {
+		for _, m := range qu.users {
+			if m.ID == user.ID {
+				q.selectQueueLocked(qu)
+			}
+		}
+	}
+	if q.clearBrbLocked(user.ID) {
+		respondEphemeral(s, i, "Welcome back!")
+		q.refreshLocked(s)
+		return
+	}
+
+	var member *queueMember
+	for _, m := range q.users {
+		if m.ID == user.ID {
+			member = m
+		}
+	}
+	if member == nil {
+		respondEphemeral(s, i, "You need a slot in the queue to hold it.")
+		return
+	}
+
+	minutes := int64(defaultBrbMinutes)
+	if opts := i.ApplicationCommandData().Options; len(opts) > 0 {
+		minutes = opts[0].IntValue()
+	}
+	member.BrbUntil = time.Now().Add(time.Duration(minutes) * time.Minute)
+	respondEphemeral(s, i, fmt.Sprintf("Holding your slot until <t:%d:t>. Run /standby-brb again when you're back.", member.BrbUntil.Unix()))
+	q.refreshLocked(s)
+}
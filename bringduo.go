@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var letQueueCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-let-queue",
+	Description: "Let a member bring you into queues when they join, e.g. when you share a keyboard",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionUser,
+			Name:        "user",
+			Description: "Member who can bring you; run again to take it back",
+			Required:    true,
+		},
+	},
+}
+
+// handleLetQueue lets the chosen member queue the user, or stops letting
+// them if they already could.
+func (q *queueState) handleLetQueue(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	user := i.Member.User
+	data := i.ApplicationCommandData()
+	queuer := resolvedUser(data, data.Options[0])
+	if queuer.ID == user.ID {
+		respondEphemeral(s, i, "You can always queue yourself.")
+		return
+	}
+	if q.queuers[user.ID][queuer.ID] {
+		delete(q.queuers[user.ID], queuer.ID)
+		if len(q.queuers[user.ID]) == 0 {
+			delete(q.queuers, user.ID)
+		}
+		respondEphemeral(s, i, fmt.Sprintf("<@%s> can no longer bring you into queues.", queuer.ID))
+		return
+	}
+	if q.queuers[user.ID] == nil {
+		q.queuers[user.ID] = make(map[string]bool)
+	}
+	q.queuers[user.ID][queuer.ID] = true
+	respondEphemeral(s, i, fmt.Sprintf("<@%s> can now bring you into queues when they join. Run this again with them to take it back.", queuer.ID))
+}
+
+// canBringLocked reports whether anyone lets userID bring them into queues.
+// lock must be held
+func (q *queueState) canBringLocked(userID string) bool {
+	for _, queuers := range q.queuers {
+		if queuers[userID] {
+			return true
+		}
+	}
+	return false
+}
+
+// offerBringDuoLocked follows up a join with a user select to bring someone
+// along, if anyone lets the user bring them.
+// lock must be held
+func (q *queueState) offerBringDuoLocked(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !q.isQueuedLocked(i.Member.User.ID) || !q.canBringLocked(i.Member.User.ID) {
+		return
+	}
+	if _, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: "Playing with someone at your keyboard? Bring them too:",
+		Flags:   discordgo.MessageFlagsEphemeral,
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					MenuType:    discordgo.UserSelectMenu,
+					CustomID:    queueCustomID("bring_duo", q.name),
+					Placeholder: "Bring my duo...",
+				},
+			}},
+		},
+	}); err != nil {
+		log.Printf("interaction %s: error offering to bring a duo: %v\n", interactionRef(i), err)
+	}
+}
+
+// handleBringDuo queues the picked member next to the user, if the member
+// lets them.
+func (q *queueState) handleBringDuo(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	user := i.Member.User
+	data := i.MessageComponentData()
+	partner := data.Resolved.Users[data.Values[0]]
+	reply := func(content string) {
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:    content,
+				Components: []discordgo.MessageComponent{},
+			},
+		}); err != nil {
+			log.Printf("interaction %s: error responding to bring a duo: %v\n", interactionRef(i), err)
+		}
+	}
+
+	switch {
+	case q.currentMsgID == "":
+		reply("The queue was closed.")
+		return
+	case !q.isQueuedLocked(user.ID):
+		reply("You left the queue, join again to bring someone.")
+		return
+	case !q.queuers[partner.ID][user.ID]:
+		reply(fmt.Sprintf("<@%s> hasn't let you bring them. They can run /standby-let-queue with you first.", partner.ID))
+		return
+	case q.isQueuedLocked(partner.ID):
+		reply(fmt.Sprintf("<@%s> is already in the queue.", partner.ID))
+		return
+	}
+	if reason := q.joinBlockedLocked(s, partner.ID); reason != "" {
+		reply(fmt.Sprintf("Couldn't bring <@%s>, this queue %s.", partner.ID, reason))
+		return
+	}
+
+	q.removeConditionalLocked(partner.ID)
+	q.removeDeclineLocked(partner.ID)
+	// The partner goes where the user is, and waits on the waitlist if the
+	// queue's rank bracket would keep them out.
+	if q.waitlistPositionLocked(user.ID) > 0 || !q.inRankBracketLocked(partner.ID) {
+		q.waitlistUsersLocked([]*discordgo.User{partner}, joinSourceDuo)
+		reply(fmt.Sprintf("Brought <@%s> onto the waitlist.", partner.ID))
+	} else {
+		q.addUsersLocked([]*discordgo.User{partner}, joinSourceDuo)
+		reply(fmt.Sprintf("Brought <@%s> into the queue.", partner.ID))
+	}
+	q.refreshLocked(s)
+}
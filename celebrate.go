@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var celebrateCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-celebrate",
+	Description: "Save a date, like your birthday, to be celebrated when you're in a queue that fills",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "date",
+			Description: "Month and day as MM-DD, e.g. 07-14; empty forgets your date",
+			MaxLength:   5,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "occasion",
+			Description: "What's being celebrated, birthday by default",
+			MaxLength:   40,
+		},
+	},
+}
+
+// celebration is a yearly date a user asked to have celebrated.
+type celebration struct {
+	Month    time.Month `json:"month"`
+	Day      int        `json:"day"`
+	Occasion string     `json:"occasion"`
+}
+
+// on reports whether the celebration falls on t's date in UTC. February 29
+// is celebrated on the 28th outside leap years.
+func (c celebration) on(t time.Time) bool {
+	t = t.UTC()
+	if c.Month != t.Month() {
+		return false
+	}
+	if c.Month == time.February && c.Day == 29 && time.Date(t.Year(), time.February, 29, 0, 0, 0, 0, time.UTC).Month() == time.March {
+		return t.Day() == 28
+	}
+	return c.Day == t.Day()
+}
+
+// celebrationLineLocked returns a line for the fill message naming the
+// queued players with a celebration today, or "" if there are none or the
+// guild turned celebrations off.
+// lock must be held
+func (q *queueState) celebrationLineLocked(cfg guildConfig) string {
+	if cfg.NoCelebrations {
+		return ""
+	}
+	now := time.Now()
+	var who []string
+	for _, m := range q.users {
+		if c, ok := q.celebrations[m.ID]; ok && c.on(now) {
+			who = append(who, fmt.Sprintf("<@%s>'s %s", m.ID, c.Occasion))
+		}
+	}
+	if len(who) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("🎉 And it's %s stack!", strings.Join(who, " and "))
+}
+
+func (q *queueState) handleCelebrate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	user := i.Member.User
+	opts := optionMap(i.ApplicationCommandData().Options)
+	opt, ok := opts["date"]
+	if !ok || strings.TrimSpace(opt.StringValue()) == "" {
+		delete(q.celebrations, user.ID)
+		respondEphemeral(s, i, "Forgot your date.")
+		return
+	}
+	date, err := time.Parse("01-02", strings.TrimSpace(opt.StringValue()))
+	if err != nil {
+		respondEphemeral(s, i, "Give the date as MM-DD, e.g. 07-14.")
+		return
+	}
+	c := &celebration{Month: date.Month(), Day: date.Day(), Occasion: "birthday"}
+	if opt, ok := opts["occasion"]; ok && strings.TrimSpace(opt.StringValue()) != "" {
+		c.Occasion = strings.TrimSpace(opt.StringValue())
+	}
+	q.celebrations[user.ID] = c
+	log.Printf("%s (%s) saved a celebration on %s %d\n", user.Username, user.ID, c.Month, c.Day)
+
+	reply := fmt.Sprintf("If you're in a queue that fills on %s %d, it'll be a %s stack! 🎉", c.Month, c.Day, c.Occasion)
+	if q.configs.get(q.guildID).NoCelebrations {
+		reply += "\n-# Celebrations are turned off in this server for now."
+	}
+	respondEphemeral(s, i, reply)
+}
+
+func (q *queueState) configCelebrations(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	enabled := opts["enabled"].BoolValue()
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		cfg.NoCelebrations = !enabled
+	}); err != nil {
+		return "", err
+	}
+	if !enabled {
+		return "Fill messages no longer mention celebrations.", nil
+	}
+	return "Fill messages mention players celebrating something, for those who saved a date with /standby-celebrate.", nil
+}
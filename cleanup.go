@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// cleanupScanLimit is how many of the channel's latest messages
+	// /standby-cleanup looks through.
+	cleanupScanLimit = 1000
+	// bulkDeleteMaxAge is how old a message can be for Discord to bulk delete
+	// it, less an hour to be safe. Older ones are deleted one by one.
+	bulkDeleteMaxAge = 14*24*time.Hour - time.Hour
+	// bulkDeleteMax is how many messages Discord bulk deletes at once.
+	bulkDeleteMax = 100
+)
+
+var cleanupCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-cleanup",
+	Description: "Admin command to delete the bot's old messages from the queue channel",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "hours",
+			Description: "Delete messages older than this many hours",
+			Required:    true,
+			MinValue:    ptr(1.0),
+			MaxValue:    24 * 365,
+		},
+	},
+}
+
+// activeMessages is activeMessagesLocked for the cleanup, which deletes
+// without holding the lock.
+func (q *queueState) activeMessages() map[string]bool {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.activeMessagesLocked()
+}
+
+// activeMessagesLocked returns the IDs of messages the bot still edits or
+// deletes itself, which cleanup must leave alone.
+// lock must be held
+func (q *queueState) activeMessagesLocked() map[string]bool {
+	active := make(map[string]bool)
+	for _, qu := range q.queues {
+		for _, id := range []string{qu.currentMsgID, qu.notifyMsgID, qu.oneMoreMsgID, qu.pingMsgID} {
+			active[id] = true
+		}
+		if qu.readyCheck != nil {
+			active[qu.readyCheck.msgID] = true
+		}
+		if qu.mapVote != nil {
+			active[qu.mapVote.msgID] = true
+		}
+	}
+	for _, sq := range q.schedules {
+		active[sq.MessageID] = true
+	}
+	if q.mvp != nil {
+		active[q.mvp.msgID] = true
+	}
+	if q.bracket != nil {
+		active[q.bracket.msgID] = true
+		for _, round := range q.bracket.rounds {
+			for _, m := range round {
+				if m.report != nil {
+					active[m.report.msgID] = true
+				}
+				if m.veto != nil {
+					active[m.veto.msgID] = true
+				}
+			}
+		}
+	}
+	delete(active, "")
+	return active
+}
+
+func (q *queueState) handleCleanup(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	cfg := q.configs.get(q.guildID)
+	if !cfg.isAdmin(i.Member) {
+		respondEphemeral(s, i, "Only admins can use this command.")
+		return
+	}
+	hours := optionMap(i.ApplicationCommandData().Options)["hours"].IntValue()
+
+	// Deleting can take a while under rate limits, so answer once it's done
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	}); err != nil {
+		log.Printf("error deferring cleanup response: %v\n", err)
+		return
+	}
+
+	active := q.activeMessages()
+
+	channelID := cfg.ChannelID
+	if cfg.ChannelQueues {
+		channelID = i.ChannelID
+	}
+	deleted, err := cleanupChannel(s, channelID, time.Now().Add(-time.Duration(hours)*time.Hour), active)
+	content := fmt.Sprintf("Deleted %d old %s from <#%s>.", deleted, pluralize(deleted, "message", "messages"), channelID)
+	if err != nil {
+		log.Printf("error cleaning up channel %s: %v\n", channelID, err)
+		content += " I couldn't finish, check my permissions with /standby-permcheck."
+	}
+	log.Printf("%s (%s) cleaned up %d messages older than %d hours\n", i.Member.User.Username, i.Member.User.ID, deleted, hours)
+	if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content}); err != nil {
+		log.Printf("error responding to cleanup: %v\n", err)
+	}
+}
+
+// cleanupChannel deletes the bot's own messages sent before cutoff among the
+// channel's latest cleanupScanLimit, except pinned and active ones. It
+// returns how many it deleted.
+func cleanupChannel(s *discordgo.Session, channelID string, cutoff time.Time, active map[string]bool) (int, error) {
+	var bulk, single []string
+	beforeID := ""
+	for scanned := 0; scanned < cleanupScanLimit; {
+		msgs, err := s.ChannelMessages(channelID, 100, beforeID, "", "")
+		if err != nil {
+			return 0, err
+		}
+		for _, m := range msgs {
+			scanned++
+			beforeID = m.ID
+			if m.Author == nil || m.Author.ID != s.State.User.ID || m.Pinned || active[m.ID] || m.Timestamp.After(cutoff) {
+				continue
+			}
+			if time.Since(m.Timestamp) < bulkDeleteMaxAge {
+				bulk = append(bulk, m.ID)
+			} else {
+				single = append(single, m.ID)
+			}
+		}
+		if len(msgs) < 100 {
+			break
+		}
+	}
+
+	// discordgo waits out rate limits between requests
+	deleted := 0
+	for len(bulk) > 0 {
+		batch := bulk[:min(len(bulk), bulkDeleteMax)]
+		bulk = bulk[len(batch):]
+		if err := s.ChannelMessagesBulkDelete(channelID, batch); err != nil {
+			return deleted, err
+		}
+		deleted += len(batch)
+	}
+	for _, id := range single {
+		if err := s.ChannelMessageDelete(channelID, id); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
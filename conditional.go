@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// conditionalMember is a user who only wants to play if another member does.
+// They are converted into a full member once waitFor is in the queue.
+type conditionalMember struct {
+	*discordgo.User
+
+	WaitFor   *discordgo.User `json:"wait_for"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// lock must be held
+func (q *queueState) removeConditionalLocked(userID string) {
+	for idx, c := range q.conditional {
+		if c.ID == userID {
+			q.conditional = append(q.conditional[:idx], q.conditional[idx+1:]...)
+			return
+		}
+	}
+}
+
+// resolveConditionalsLocked converts conditional members whose condition now
+// holds. Conversions can satisfy other conditions, so it repeats until stable.
+// lock must be held
+func (q *queueState) resolveConditionalsLocked() {
+	for changed := true; changed; {
+		changed = false
+		for idx, c := range q.conditional {
+			if !q.isQueuedLocked(c.WaitFor.ID) {
+				continue
+			}
+			q.conditional = append(q.conditional[:idx], q.conditional[idx+1:]...)
+			q.addUserLocked(c.User, joinSourceSlash)
+			changed = true
+			break
+		}
+	}
+}
+
+// lock must be held
+func (q *queueState) conditionalLinesLocked() []string {
+	lines := make([]string, len(q.conditional))
+	for i, c := range q.conditional {
+		lines[i] = fmt.Sprintf("<@%s> (if <@%s> joins)", c.ID, c.WaitFor.ID)
+	}
+	return lines
+}
+
+func (q *queueState) handleJoinIf(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	data := i.ApplicationCommandData()
+	q.selectQueueLocked(q.commandQueueLocked(i.ChannelID, data.Options))
+	q.joinIfLocked(s, i, resolvedUser(data, data.Options[0]))
+}
+
+// handleJoinIfSelect handles the user select on the components layout, which
+// does the same as /standby-join-if.
+func (q *queueState) handleJoinIfSelect(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	data := i.MessageComponentData()
+	q.joinIfLocked(s, i, data.Resolved.Users[data.Values[0]])
+}
+
+// lock must be held
+func (q *queueState) joinIfLocked(s *discordgo.Session, i *discordgo.InteractionCreate, waitFor *discordgo.User) {
+	if q.currentMsgID == "" {
+		respondEphemeral(s, i, "There is no active queue to join.")
+		return
+	}
+
+	user := i.Member.User
+	if waitFor.ID == user.ID {
+		respondEphemeral(s, i, "You can't wait for yourself.")
+		return
+	}
+	if q.isQueuedLocked(user.ID) {
+		respondEphemeral(s, i, "You are already in the queue.")
+		return
+	}
+	// The select skips the Join button's guards, see appendUsersLocked.
+	if reason := q.joinRuleLocked(user.ID); reason != "" {
+		respondEphemeral(s, i, "This queue "+reason+".")
+		return
+	}
+
+	q.removeConditionalLocked(user.ID)
+	q.conditional = append(q.conditional, &conditionalMember{
+		User:      user,
+		WaitFor:   waitFor,
+		CreatedAt: time.Now(),
+	})
+	if q.isQueuedLocked(waitFor.ID) {
+		respondEphemeral(s, i, fmt.Sprintf("<@%s> is already queued, so you're in.", waitFor.ID))
+	} else {
+		respondEphemeral(s, i, fmt.Sprintf("You'll be added to the queue once <@%s> joins.", waitFor.ID))
+	}
+	q.refreshLocked(s)
+}
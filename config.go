@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is read if it exists and STANDBY_CONFIG_FILE isn't set.
+const defaultConfigFile = "standby.yaml"
+
+// setting is a variable from main.go's var block. Its value comes from the
+// environment variable env if set, then key in the config file, then def.
+// Values are written the way they would be in the environment.
+type setting struct {
+	key, env string
+	// target is a *string, *[]string, *bool, *int or *time.Duration.
+	target any
+	def    string
+	// required settings can't be left empty.
+	required bool
+	// min and max bound ints if max is set.
+	min, max int
+	// choices are the values a string can have if set.
+	choices []string
+	// restart settings are only read at startup, since the connections,
+	// files and listeners they set up aren't reopened by a reload.
+	restart bool
+}
+
+var settings = []setting{
+	{key: "bot_token", env: "DISCORD_BOT_TOKEN", target: &BotToken, required: true, restart: true},
+	{key: "app_id", env: "STANDBY_APP_ID", target: &AppID, required: true, restart: true},
+	{key: "guild_id", env: "STANDBY_GUILD_ID", target: &GuildID, restart: true},
+	{key: "admin_role_id", env: "STANDBY_ADMIN_ID", target: &AdminRoleID},
+	{key: "channel_id", env: "STANDBY_CHANNEL_ID", target: &ChannelID},
+	{key: "port", env: "PORT", target: &Port, def: "8080", min: 1, max: 65535, restart: true},
+	{key: "metrics_port", env: "STANDBY_METRICS_PORT", target: &MetricsPort, def: "2112", min: 1, max: 65535, restart: true},
+	{key: "queue_size", env: "STANDBY_QUEUE_SIZE", target: &QueueSize, def: strconv.Itoa(MaxQueueSize), min: MinQueueSize, max: MaxQueueSizeOption},
+	{key: "config_path", env: "STANDBY_CONFIG_PATH", target: &ConfigPath, def: "guild_config.json", restart: true},
+	{key: "state_path", env: "STANDBY_STATE_PATH", target: &StatePath, def: "queue_state.json", restart: true},
+	{key: "owner_ids", env: "STANDBY_OWNER_IDS", target: &OwnerIDs},
+	{key: "guild_allowlist", env: "STANDBY_GUILD_ALLOWLIST", target: &GuildAllowlist},
+	{key: "guild_denylist", env: "STANDBY_GUILD_DENYLIST", target: &GuildDenylist},
+	{key: "reinvite_after", env: "STANDBY_REINVITE_AFTER", target: &ReinviteAfter, def: "15m"},
+	{key: "suggest_last_slot", env: "STANDBY_SUGGEST_LAST_SLOT", target: &SuggestLastSlot, restart: true},
+	{key: "one_more_langs", env: "STANDBY_ONE_MORE_LANGS", target: &OneMoreLangs},
+	{key: "stale_after", env: "STANDBY_STALE_AFTER", target: &StaleAfter},
+	{key: "staff_channel_id", env: "STANDBY_STAFF_CHANNEL_ID", target: &StaffChannelID},
+	{key: "alert_user_ids", env: "STANDBY_ALERT_USER_IDS", target: &AlertUserIDs},
+	{key: "expire_after", env: "STANDBY_EXPIRE_AFTER", target: &ExpireAfter, def: "2h"},
+	{key: "launch_after", env: "STANDBY_LAUNCH_AFTER", target: &LaunchAfter, def: "10m"},
+	{key: "reminder_lead", env: "STANDBY_REMINDER_LEAD", target: &ReminderLead, def: "15m"},
+	{key: "history_path", env: "STANDBY_HISTORY_PATH", target: &HistoryPath, def: "queue_history.db", restart: true},
+	{key: "history_dsn", env: "STANDBY_HISTORY_DSN", target: &HistoryDSN, restart: true},
+	{key: "history_retention", env: "STANDBY_HISTORY_RETENTION", target: &HistoryRetention, def: "4320h"},
+	{key: "prune_after", env: "STANDBY_PRUNE_AFTER", target: &PruneAfter, def: "1344h"},
+	{key: "archive_channel_id", env: "STANDBY_ARCHIVE_CHANNEL_ID", target: &ArchiveChannelID},
+	{key: "ping_role_id", env: "STANDBY_PING_ROLE_ID", target: &PingRoleID},
+	{key: "stack_voice", env: "STANDBY_STACK_VOICE", target: &StackVoice},
+	{key: "error_dsn", env: "STANDBY_ERROR_DSN", target: &ErrorDSN, restart: true},
+	{key: "promotion_order", env: "STANDBY_PROMOTION_ORDER", target: &PromotionOrder, def: promotionWaitlist, choices: []string{promotionWaitlist, promotionRotation}},
+	{key: "team_balance", env: "STANDBY_TEAM_BALANCE", target: &TeamBalance, def: teamsGreedy, choices: []string{teamsGreedy, teamsSwap}},
+	{key: "shadow_algorithms", env: "STANDBY_SHADOW_ALGORITHMS", target: &ShadowAlgorithms},
+	{key: "client_secret", env: "STANDBY_CLIENT_SECRET", target: &ClientSecret, restart: true},
+	{key: "public_url", env: "STANDBY_PUBLIC_URL", target: &PublicURL, restart: true},
+	{key: "linked_roles_path", env: "STANDBY_LINKED_ROLES_PATH", target: &LinkedRolesPath, def: "linked_roles.json", restart: true},
+	{key: "api_token", env: "STANDBY_API_TOKEN", target: &APIToken},
+	{key: "debug_token", env: "STANDBY_DEBUG_TOKEN", target: &DebugToken},
+}
+
+// settingsMu guards the settings' variables against a reload, see current.
+// Settings that need a restart are never reloaded and can be read directly.
+var settingsMu sync.RWMutex
+
+// current reads a setting's variable that a reload can change.
+func current[T any](v *T) T {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+
+	return *v
+}
+
+// loadConfig sets the variables in main.go's var block from the config file
+// and the environment. It reports every missing or invalid value at once,
+// and sets nothing if there are any.
+func loadConfig() error {
+	values, err := readSettings()
+	if err != nil {
+		return err
+	}
+	for idx, st := range settings {
+		st.set(values[idx])
+	}
+	return nil
+}
+
+// reloadConfig is loadConfig for a running bot. Settings that need a restart
+// keep their values, and are returned if they changed, along with the
+// settings that did.
+func reloadConfig() (changed, needRestart []string, err error) {
+	values, err := readSettings()
+	if err != nil {
+		return nil, nil, err
+	}
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	for idx, st := range settings {
+		if reflect.DeepEqual(st.get(), values[idx]) {
+			continue
+		}
+		if st.restart {
+			needRestart = append(needRestart, st.key)
+			continue
+		}
+		st.set(values[idx])
+		changed = append(changed, st.key)
+	}
+	return changed, needRestart, nil
+}
+
+// readSettings returns the value of each of settings.
+func readSettings() ([]any, error) {
+	file, err := readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	values := make([]any, len(settings))
+	known := make(map[string]bool)
+	for idx, st := range settings {
+		known[st.key] = true
+		v, from := st.def, "default"
+		if fv, ok := file[st.key]; ok {
+			v, from = fv, "config file key "+st.key
+		}
+		if ev := os.Getenv(st.env); ev != "" {
+			v, from = ev, st.env
+		}
+		if st.required && v == "" {
+			errs = append(errs, fmt.Errorf("%s is required, set %s or %s in the config file", st.env, st.env, st.key))
+			continue
+		}
+		if values[idx], err = st.parse(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", from, err))
+		}
+	}
+	var unknown []string
+	for key := range file {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errs = append(errs, fmt.Errorf("config file has unknown key %s", key))
+	}
+	return values, errors.Join(errs...)
+}
+
+// parse parses v into a value of the setting's type.
+func (st setting) parse(v string) (any, error) {
+	switch st.target.(type) {
+	case *string:
+		if len(st.choices) > 0 && !slices.Contains(st.choices, v) {
+			return nil, fmt.Errorf("%q isn't one of %s", v, strings.Join(st.choices, ", "))
+		}
+		return v, nil
+	case *[]string:
+		return splitList(v), nil
+	case *bool:
+		if v == "" {
+			return false, nil
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't true or false", v)
+		}
+		return b, nil
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't a number", v)
+		}
+		if st.max != 0 && (n < st.min || n > st.max) {
+			return nil, fmt.Errorf("%d isn't between %d and %d", n, st.min, st.max)
+		}
+		return n, nil
+	case *time.Duration:
+		if v == "" {
+			return time.Duration(0), nil
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q isn't a duration like 15m", v)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("%s can't be negative", v)
+		}
+		return d, nil
+	}
+	panic(fmt.Sprintf("unsupported setting type %T", st.target))
+}
+
+// get returns the setting's variable.
+func (st setting) get() any {
+	return reflect.ValueOf(st.target).Elem().Interface()
+}
+
+// set sets the setting's variable to a value from parse.
+func (st setting) set(v any) {
+	reflect.ValueOf(st.target).Elem().Set(reflect.ValueOf(v))
+}
+
+// readConfigFile reads the YAML config file into values written the way they
+// would be in the environment, lists joined with commas. A missing default
+// file is the same as an empty one.
+func readConfigFile() (map[string]string, error) {
+	path := os.Getenv("STANDBY_CONFIG_FILE")
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigFile
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	file := make(map[string]string, len(raw))
+	for key, v := range raw {
+		switch v := v.(type) {
+		case nil:
+			file[key] = ""
+		case []any:
+			items := make([]string, len(v))
+			for idx, item := range v {
+				items[idx] = fmt.Sprint(item)
+			}
+			file[key] = strings.Join(items, ",")
+		case map[string]any:
+			return nil, fmt.Errorf("%s: %s should be a value or a list", path, key)
+		default:
+			file[key] = fmt.Sprint(v)
+		}
+	}
+	return file, nil
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var configCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-config",
+	Description: "Admin command to change standby settings for this server",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "channels",
+			Description: "Restrict which channels /standby can be used in",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "action",
+					Description: "What to do with the channel list",
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "add", Value: "add"},
+						{Name: "remove", Value: "remove"},
+						{Name: "clear", Value: "clear"},
+					},
+				},
+				{
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					Name:         "channel",
+					Description:  "Channel to add or remove",
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "per-channel",
+			Description: "Open queues in whichever channel /standby is used in, one queue per channel",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "enabled",
+					Description: "Whether each channel gets its own queue",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "alerts",
+			Description: "Set the staff alert channel, the archive channel or the role pinged when a queue opens",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "setting",
+					Description: "What to set",
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "staff channel", Value: "staff"},
+						{Name: "archive channel", Value: "archive"},
+						{Name: "ping role", Value: "ping_role"},
+					},
+				},
+				{
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					Name:         "channel",
+					Description:  "Channel for the staff or archive setting; empty turns it off",
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionRole,
+					Name:        "role",
+					Description: "Role for the ping role setting; empty turns it off",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "template",
+			Description: "Customize an announcement message, e.g. {{.Players}} get ready for {{.Game}}",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "kind",
+					Description: "Which message to change",
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "queue full", Value: templateFill},
+						{Name: "waitlist promotion", Value: templatePromote},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "template",
+					Description: "Go template using {{.Players}}, {{.Player}}, {{.Game}}, {{.Note}}; empty resets it",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "layout",
+			Description: "Choose how the queue message lists players",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "style",
+					Description: "Layout of the queue message",
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "single list", Value: embedLayoutDescription},
+						{Name: "columns", Value: embedLayoutFields},
+						{Name: "components", Value: embedLayoutComponents},
+					},
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "embed",
+			Description: "Customize how queue messages look; options left out are kept",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "color",
+					Description: "Hex color, e.g. #5865F2",
+					MaxLength:   7,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "thumbnail",
+					Description: "https:// link to an image shown in the corner",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "footer",
+					Description: "Text shown at the bottom",
+					MaxLength:   200,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "join_label",
+					Description: "Label of the Join button",
+					MaxLength:   80,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "join_emoji",
+					Description: "Emoji on the Join button",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "leave_label",
+					Description: "Label of the Leave button",
+					MaxLength:   80,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "leave_emoji",
+					Description: "Emoji on the Leave button",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "close_label",
+					Description: "Label of the Close button",
+					MaxLength:   80,
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "close_emoji",
+					Description: "Emoji on the Close button",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "reset",
+					Description: "Go back to the default look before applying the other options",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "maps",
+			Description: "Set the map pool for bracket map vetoes",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "maps",
+					Description: "Comma separated map names; empty clears the pool",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "vote",
+			Description: "Set the maps or modes players vote on once a queue fills",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "options",
+					Description: "Comma separated maps or modes; empty turns the vote off",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "roles",
+			Description: "Set the roles a queue needs so players take turns flexing",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "roles",
+					Description: "Comma separated role per slot, e.g. tank, dps, dps, support, support; empty turns it off",
+				},
+				queueNameOption("Queue to change; empty for the default queue"),
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "celebrations",
+			Description: "Mention birthdays and other dates players saved in fill messages",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "enabled",
+					Description: "Whether fill messages mention celebrations",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "plain-status",
+			Description: "Spell out queue status in words for screen readers and colorblind members",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "enabled",
+					Description: "Whether queue messages state their status in words",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "game-board",
+			Description: "Pin a message in each queue channel listing its open queues",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "enabled",
+					Description: "Whether queue channels get a game board",
+					Required:    true,
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "account",
+			Description: "Require a linked game account to join a queue",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "provider",
+					Description: "Account players must link",
+					Required:    true,
+					Choices:     append(accountChoices, &discordgo.ApplicationCommandOptionChoice{Name: "None", Value: "none"}),
+				},
+				queueNameOption("Queue the requirement applies to; empty for the default queue"),
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "ranked",
+			Description: "Mark a queue as ranked so alt accounts can't join it",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "ranked",
+					Description: "Whether the queue is ranked",
+					Required:    true,
+				},
+				queueNameOption("Queue to change; empty for the default queue"),
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "voice",
+			Description: "Tie joining a queue to being in a voice channel",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "mode",
+					Description: "How the voice channel is used",
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "Required to join", Value: voiceModeRequire},
+						{Name: "Joining voice joins the queue", Value: voiceModeAuto},
+						{Name: "Off", Value: "off"},
+					},
+				},
+				{
+					Type:         discordgo.ApplicationCommandOptionChannel,
+					Name:         "channel",
+					Description:  "Voice channel",
+					ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildVoice},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Name:        "leave",
+					Description: "Remove members from the queue when they leave the channel",
+				},
+				queueNameOption("Queue to change; empty for the default queue"),
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "timezone",
+			Description: "Set the timezone the server plays in",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "zone",
+					Description: "IANA timezone, e.g. America/Toronto; empty for UTC",
+				},
+			},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "api-token",
+			Description: "Make or revoke this server's token for the REST API",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "action",
+					Description: "What to do with the token",
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "new", Value: "new"},
+						{Name: "revoke", Value: "revoke"},
+					},
+				},
+			},
+		},
+	},
+}
+
+// optionMap indexes command options by name.
+func optionMap(opts []*discordgo.ApplicationCommandInteractionDataOption) map[string]*discordgo.ApplicationCommandInteractionDataOption {
+	m := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(opts))
+	for _, opt := range opts {
+		m[opt.Name] = opt
+	}
+	return m
+}
+
+func (q *queueState) handleConfig(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !q.configs.get(q.guildID).isAdmin(i.Member) {
+		respondEphemeral(s, i, "Only admins can use this command.")
+		return
+	}
+
+	sub := i.ApplicationCommandData().Options[0]
+	opts := optionMap(sub.Options)
+	var (
+		reply string
+		err   error
+	)
+	switch sub.Name {
+	case "channels":
+		reply, err = q.configChannels(s, opts)
+	case "per-channel":
+		reply, err = q.configChannelQueues(opts)
+	case "alerts":
+		reply, err = q.configAlerts(opts)
+	case "template":
+		reply, err = q.configTemplate(opts)
+	case "layout":
+		reply, err = q.configLayout(opts)
+	case "embed":
+		reply, err = q.configEmbed(opts)
+	case "maps":
+		reply, err = q.configMaps(opts)
+	case "vote":
+		reply, err = q.configVoteOptions(opts)
+	case "roles":
+		reply, err = q.configRoles(opts)
+	case "celebrations":
+		reply, err = q.configCelebrations(opts)
+	case "plain-status":
+		reply, err = q.configPlainStatus(opts)
+	case "game-board":
+		reply, err = q.configGameBoard(opts)
+	case "account":
+		reply, err = q.configAccount(opts)
+	case "ranked":
+		reply, err = q.configRanked(opts)
+	case "voice":
+		reply, err = q.configVoice(opts)
+	case "timezone":
+		reply, err = q.configTimezone(opts)
+	case "api-token":
+		reply, err = q.configAPIToken(opts)
+	}
+	if err != nil {
+		log.Printf("interaction %s: error saving guild config: %v\n", interactionRef(i), err)
+		respondError(s, i, "Couldn't save the settings, try again.")
+		return
+	}
+	log.Printf("guild config %s updated by %s (%s)\n", sub.Name, i.Member.User.Username, i.Member.User.ID)
+	respondEphemeral(s, i, reply)
+}
+
+func (q *queueState) configTimezone(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	var tz string
+	if opt, ok := opts["zone"]; ok {
+		tz = opt.StringValue()
+	}
+	if tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return fmt.Sprintf("I don't know the timezone %q, try something like America/Toronto.", tz), nil
+		}
+	}
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		cfg.Timezone = tz
+	}); err != nil {
+		return "", err
+	}
+	if tz == "" {
+		return "The server's timezone is back to UTC.", nil
+	}
+	return fmt.Sprintf("The server's timezone is now %s. Waitlist estimates go by weekdays there, and /standby-schedule uses it unless another is given.", tz), nil
+}
+
+func (q *queueState) configChannels(s *discordgo.Session, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	action := opts["action"].StringValue()
+	var channelID string
+	if opt, ok := opts["channel"]; ok {
+		channelID = opt.ChannelValue(nil).ID
+	} else if action != "clear" {
+		return "Pick a channel to " + action + ".", nil
+	}
+
+	var channels []string
+	err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		switch action {
+		case "add":
+			cfg.CommandChannelIDs = append(removeString(cfg.CommandChannelIDs, channelID), channelID)
+		case "remove":
+			cfg.CommandChannelIDs = removeString(cfg.CommandChannelIDs, channelID)
+		case "clear":
+			cfg.CommandChannelIDs = nil
+		}
+		channels = cfg.CommandChannelIDs
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(channels) == 0 {
+		return "/standby can now be used in any channel.", nil
+	}
+	return fmt.Sprintf("/standby can now only be used in %s.", channelMentions(channels)), nil
+}
+
+func (q *queueState) configChannelQueues(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	enabled := opts["enabled"].BoolValue()
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		cfg.ChannelQueues = enabled
+	}); err != nil {
+		return "", err
+	}
+	if !enabled {
+		return "Queues open in the queue channel again.", nil
+	}
+	return "/standby now opens a queue in the channel it's used in, named after the channel. Use /standby-config channels to pick which channels allow it.", nil
+}
+
+func (q *queueState) configAlerts(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	setting := opts["setting"].StringValue()
+	var id string
+	if opt, ok := opts["channel"]; ok && setting != "ping_role" {
+		id = opt.ChannelValue(nil).ID
+	}
+	if opt, ok := opts["role"]; ok && setting == "ping_role" {
+		id = opt.RoleValue(nil, "").ID
+	}
+
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		switch setting {
+		case "staff":
+			cfg.StaffChannelID = id
+		case "archive":
+			cfg.ArchiveChannelID = id
+		case "ping_role":
+			cfg.PingRoleID = id
+		}
+	}); err != nil {
+		return "", err
+	}
+
+	// Clearing a setting falls back to the environment in the home guild
+	cfg := q.configs.get(q.guildID)
+	switch {
+	case setting == "staff" && cfg.StaffChannelID != "":
+		return fmt.Sprintf("Stale queue alerts now go to <#%s>.", cfg.StaffChannelID), nil
+	case setting == "archive" && cfg.ArchiveChannelID != "":
+		return fmt.Sprintf("Closed queues are now archived in <#%s>.", cfg.ArchiveChannelID), nil
+	case setting == "ping_role" && cfg.PingRoleID != "":
+		return fmt.Sprintf("<@&%s> is now pinged when a queue opens.", cfg.PingRoleID), nil
+	}
+	return "Turned it off.", nil
+}
+
+func removeString(list []string, v string) []string {
+	var out []string
+	for _, s := range list {
+		if s != v {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func channelMentions(ids []string) string {
+	mentions := make([]string, len(ids))
+	for i, id := range ids {
+		mentions[i] = fmt.Sprintf("<#%s>", id)
+	}
+	return strings.Join(mentions, ", ")
+}
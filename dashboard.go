@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+)
+
+type grafanaDashboard struct {
+	Title         string            `json:"title"`
+	UID           string            `json:"uid"`
+	SchemaVersion int               `json:"schemaVersion"`
+	Refresh       string            `json:"refresh"`
+	Time          grafanaTimeRange  `json:"time"`
+	Templating    grafanaTemplating `json:"templating"`
+	Panels        []grafanaPanel    `json:"panels"`
+}
+
+type grafanaTimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type grafanaTemplating struct {
+	List []grafanaVariable `json:"list"`
+}
+
+type grafanaVariable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+type grafanaDatasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type grafanaPanel struct {
+	ID         int               `json:"id"`
+	Title      string            `json:"title"`
+	Type       string            `json:"type"`
+	Datasource grafanaDatasource `json:"datasource"`
+	GridPos    grafanaGridPos    `json:"gridPos"`
+	Targets    []grafanaTarget   `json:"targets"`
+}
+
+type grafanaGridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type grafanaTarget struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+// buildDashboard returns a Grafana dashboard covering the bot's metrics.
+func buildDashboard() grafanaDashboard {
+	panels := []struct {
+		title   string
+		targets []grafanaTarget
+	}{
+		{
+			title: "Queue size",
+			targets: []grafanaTarget{
+				{Expr: metricNamedQueueUsers, LegendFormat: "{{guild}} {{queue}} queued"},
+				{Expr: metricNamedQueueCap, LegendFormat: "{{guild}} {{queue}} capacity"},
+				{Expr: metricNamedQueueOpen, LegendFormat: "{{guild}} {{queue}} open"},
+			},
+		},
+		{
+			title: "Waitlist size",
+			targets: []grafanaTarget{
+				{Expr: metricQueueWaitlist, LegendFormat: "{{guild}} {{queue}}"},
+			},
+		},
+		{
+			title: "Waitlist fairness",
+			targets: []grafanaTarget{
+				{Expr: "sum(increase(" + metricWaitlistExits + `{outcome="promoted"}[1d])) by (guild) / sum(increase(` + metricWaitlistExits + "[1d])) by (guild)", LegendFormat: "{{guild}} promoted share"},
+				{Expr: "sum(increase(" + metricWaitlistSkips + "[1d])) by (guild) / sum(increase(" + metricWaitlistExits + `{outcome="promoted"}[1d])) by (guild)`, LegendFormat: "{{guild}} skips per promotion"},
+			},
+		},
+		{
+			title: "Queues opened, filled and closed",
+			targets: []grafanaTarget{
+				{Expr: "sum(increase(" + metricQueuesOpened + "[1h]))", LegendFormat: "opened"},
+				{Expr: "sum(increase(" + metricQueuesFilled + "[1h]))", LegendFormat: "filled"},
+				{Expr: "sum(increase(" + metricQueuesClosed + "[1h]))", LegendFormat: "closed"},
+			},
+		},
+		{
+			title: "Time to fill",
+			targets: []grafanaTarget{
+				{Expr: "histogram_quantile(0.5, sum(rate(" + metricQueueTimeToFill + "_bucket[1h])) by (le))", LegendFormat: "p50"},
+				{Expr: "histogram_quantile(0.95, sum(rate(" + metricQueueTimeToFill + "_bucket[1h])) by (le))", LegendFormat: "p95"},
+			},
+		},
+		{
+			title: "Joins by source",
+			targets: []grafanaTarget{
+				{Expr: "sum(increase(" + metricQueueJoins + "[1h])) by (source)", LegendFormat: "{{source}}"},
+			},
+		},
+		{
+			title: "Clicks by component",
+			targets: []grafanaTarget{
+				{Expr: "sum(increase(" + metricComponentClicks + "[1h])) by (component)", LegendFormat: "{{component}}"},
+			},
+		},
+		{
+			title: "Command latency",
+			targets: []grafanaTarget{
+				{Expr: "histogram_quantile(0.5, sum(rate(" + metricCommandDuration + "_bucket[5m])) by (le))", LegendFormat: "p50"},
+				{Expr: "histogram_quantile(0.95, sum(rate(" + metricCommandDuration + "_bucket[5m])) by (le))", LegendFormat: "p95"},
+			},
+		},
+		{
+			title: "Discord API errors",
+			targets: []grafanaTarget{
+				{Expr: "sum(rate(" + metricAPIErrors + "[5m])) by (reason)", LegendFormat: "{{reason}}"},
+			},
+		},
+		{
+			title: "Gateway connected",
+			targets: []grafanaTarget{
+				{Expr: metricGatewayConnected, LegendFormat: "connected"},
+			},
+		},
+	}
+
+	d := grafanaDashboard{
+		Title:         "Discord Standby Bot",
+		UID:           "discord-standby-bot",
+		SchemaVersion: 39,
+		Refresh:       "30s",
+		Time:          grafanaTimeRange{From: "now-24h", To: "now"},
+		Templating: grafanaTemplating{
+			List: []grafanaVariable{
+				{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+			},
+		},
+	}
+	for idx, p := range panels {
+		for t := range p.targets {
+			p.targets[t].RefID = string(rune('A' + t))
+		}
+		d.Panels = append(d.Panels, grafanaPanel{
+			ID:         idx + 1,
+			Title:      p.title,
+			Type:       "timeseries",
+			Datasource: grafanaDatasource{Type: "prometheus", UID: "${datasource}"},
+			GridPos:    grafanaGridPos{X: (idx % 2) * 12, Y: (idx / 2) * 8, W: 12, H: 8},
+			Targets:    p.targets,
+		})
+	}
+	return d
+}
+
+func printDashboard(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(buildDashboard())
+}
+
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := printDashboard(w); err != nil {
+		log.Printf("error writing dashboard: %v\n", err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var declineReasons = []discordgo.SelectMenuOption{
+	{Label: "Busy", Value: "busy"},
+	{Label: "Later", Value: "later", Description: "Say roughly when you'll be free"},
+	{Label: "Not tonight", Value: "not tonight"},
+}
+
+type decline struct {
+	*discordgo.User
+
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// lock must be held
+func (q *queueState) recordDeclineLocked(user *discordgo.User, reason string) {
+	q.removeDeclineLocked(user.ID)
+	q.declines = append(q.declines, &decline{
+		User:   user,
+		Reason: reason,
+		At:     time.Now(),
+	})
+}
+
+// lock must be held
+func (q *queueState) removeDeclineLocked(userID string) {
+	for idx, d := range q.declines {
+		if d.ID == userID {
+			q.declines = append(q.declines[:idx], q.declines[idx+1:]...)
+			return
+		}
+	}
+}
+
+// lock must be held
+func (q *queueState) declineLinesLocked() []string {
+	lines := make([]string, len(q.declines))
+	for i, d := range q.declines {
+		lines[i] = fmt.Sprintf("<@%s>: %s", d.ID, d.Reason)
+	}
+	return lines
+}
+
+// respondDeclineReasons shows the quick-pick reasons for declining. The
+// selection comes back as a component interaction with customID.
+func respondDeclineReasons(s *discordgo.Session, i *discordgo.InteractionCreate, customID string) error {
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "Let the group know why:",
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.SelectMenu{
+							MenuType:    discordgo.StringSelectMenu,
+							CustomID:    customID,
+							Placeholder: "Pick a reason",
+							Options:     declineReasons,
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+// respondDeclineLater asks for a rough time when "later" was picked. The
+// answer comes back as a modal submit with customID.
+func respondDeclineLater(s *discordgo.Session, i *discordgo.InteractionCreate, customID string) error {
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: customID,
+			Title:    "Later",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:    "when",
+							Label:       "When will you be free?",
+							Style:       discordgo.TextInputShort,
+							Placeholder: "~9pm",
+							MaxLength:   32,
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+// respondDeclineRecorded replaces the reason picker with a confirmation.
+func respondDeclineRecorded(s *discordgo.Session, i *discordgo.InteractionCreate, reason string) error {
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    fmt.Sprintf("Got it, you're marked as \"%s\".", reason),
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+}
+
+// modalValue returns the value of the text input with customID in a modal submit.
+func modalValue(data discordgo.ModalSubmitInteractionData, customID string) string {
+	for _, c := range data.Components {
+		row, ok := c.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		for _, rc := range row.Components {
+			if input, ok := rc.(*discordgo.TextInput); ok && input.CustomID == customID {
+				return input.Value
+			}
+		}
+	}
+	return ""
+}
+
+func (q *queueState) handleDeclineButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	if q.isQueuedLocked(i.Member.User.ID) {
+		respondEphemeral(s, i, "You're in the queue. Use Leave if you can't play.")
+		return
+	}
+	if err := respondDeclineReasons(s, i, queueCustomID("decline_reason", interactionQueueName(i))); err != nil {
+		log.Printf("error responding with decline reasons: %v\n", err)
+	}
+}
+
+func (q *queueState) handleDeclineReason(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	reason := i.MessageComponentData().Values[0]
+	if reason == "later" {
+		if err := respondDeclineLater(s, i, queueCustomID("decline_later", interactionQueueName(i))); err != nil {
+			log.Printf("error responding with decline modal: %v\n", err)
+		}
+		return
+	}
+	q.declineQueue(s, i, reason)
+}
+
+func (q *queueState) handleDeclineLater(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	reason := "later"
+	if when := strings.TrimSpace(modalValue(i.ModalSubmitData(), "when")); when != "" {
+		reason = "later " + when
+	}
+	q.declineQueue(s, i, reason)
+}
+
+func (q *queueState) declineQueue(s *discordgo.Session, i *discordgo.InteractionCreate, reason string) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	if err := respondDeclineRecorded(s, i, reason); err != nil {
+		log.Printf("error responding to decline: %v\n", err)
+	}
+	if q.currentMsgID == "" || q.isQueuedLocked(i.Member.User.ID) {
+		return
+	}
+	q.recordDeclineLocked(i.Member.User, reason)
+	q.refreshLocked(s)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// interactionTTL is how long handled interaction IDs are remembered.
+	// Discord stops accepting responses to an interaction well before this.
+	interactionTTL = 5 * time.Minute
+	// doubleTapWindow is how soon a second click of the same component by
+	// the same user counts as an accidental double tap.
+	doubleTapWindow = time.Second
+)
+
+// interactionSet remembers recently handled interactions so redeliveries
+// and double taps are only handled once. It has its own lock so duplicates
+// are dropped without waiting on the queue.
+type interactionSet struct {
+	sync.Mutex
+	seen map[string]time.Time
+}
+
+func newInteractionSet() *interactionSet {
+	return &interactionSet{seen: make(map[string]time.Time)}
+}
+
+// firstLocked records key and reports whether it wasn't seen within ttl.
+// lock must be held
+func (set *interactionSet) firstLocked(key string, ttl time.Duration, now time.Time) bool {
+	if at, ok := set.seen[key]; ok && now.Sub(at) < ttl {
+		return false
+	}
+	set.seen[key] = now
+	return true
+}
+
+// first reports whether the interaction should be handled: it isn't a
+// redelivery of one already handled, and for components, not a double tap.
+func (set *interactionSet) first(i *discordgo.InteractionCreate) bool {
+	set.Lock()
+	defer set.Unlock()
+
+	now := time.Now()
+	for key, at := range set.seen {
+		if now.Sub(at) >= interactionTTL {
+			delete(set.seen, key)
+		}
+	}
+	if !set.firstLocked(i.ID, interactionTTL, now) {
+		log.Printf("ignoring redelivered interaction %s\n", i.ID)
+		return false
+	}
+	if i.Type != discordgo.InteractionMessageComponent || i.Member == nil {
+		return true
+	}
+	return set.firstLocked(i.Member.User.ID+"|"+i.Message.ID+"|"+i.MessageComponentData().CustomID, doubleTapWindow, now)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// notifySettings are the preferences toggled from the queue message's
+// Notifications button. The rest are in /standby-prefs.
+var notifySettings = []struct {
+	key, on, off string
+	field        func(p *userPrefs) *bool
+}{
+	{"dm", "DM me when my queue fills or I'm promoted", "Fill and promotion DMs are on", func(p *userPrefs) *bool { return &p.FillDMs }},
+	{"open", "DM me when a queue opens", "Queue open DMs are on", func(p *userPrefs) *bool { return &p.OpenDMs }},
+}
+
+// notifySettingsComponentsLocked shows a toggle per setting, labelled with
+// what pressing it does.
+// lock must be held
+func (q *queueState) notifySettingsComponentsLocked(userID string) []discordgo.MessageComponent {
+	p := q.prefsLocked(userID)
+	var buttons []discordgo.MessageComponent
+	for _, setting := range notifySettings {
+		button := discordgo.Button{
+			Label:    setting.on,
+			Style:    discordgo.PrimaryButton,
+			CustomID: "notify_toggle:" + setting.key,
+		}
+		if *setting.field(&p) {
+			button.Label = setting.off + ", turn off"
+			button.Style = discordgo.SecondaryButton
+		}
+		buttons = append(buttons, button)
+	}
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: buttons},
+	}
+}
+
+const notifySettingsContent = "Everyone in the queue gets the channel ping when it fills. Turn on DMs if you've muted the channel. Several queues opening close together are sent as one DM. See /standby-prefs for more."
+
+func (q *queueState) handleNotifySettings(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	components := q.notifySettingsComponentsLocked(i.Member.User.ID)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:    notifySettingsContent,
+			Flags:      discordgo.MessageFlagsEphemeral,
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Printf("error responding with notification settings: %v\n", err)
+	}
+}
+
+func (q *queueState) handleNotifyToggle(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	userID := i.Member.User.ID
+	key := customIDArgs(i)[0]
+	for _, setting := range notifySettings {
+		if setting.key == key {
+			q.updatePrefsLocked(userID, func(p *userPrefs) {
+				*setting.field(p) = !*setting.field(p)
+			})
+		}
+	}
+	components := q.notifySettingsComponentsLocked(userID)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    notifySettingsContent,
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Printf("error updating notification settings: %v\n", err)
+	}
+}
+
+// dmFilledLocked DMs opted-in players that the queue is full.
+// lock must be held
+func (q *queueState) dmFilledLocked(s *discordgo.Session) {
+	what := "standby queue"
+	if q.game != "" {
+		what = q.game + " queue"
+	}
+	content := fmt.Sprintf("Your %s is full, time to play! https://discord.com/channels/%s/%s/%s", what, q.guildID, q.channelID, q.currentMsgID)
+	for _, m := range q.users {
+		q.notifyLocked(s, m.ID, notifyFill, content)
+	}
+}
+
+// dmPromotedLocked DMs a user promoted from the waitlist if they opted in.
+// lock must be held
+func (q *queueState) dmPromotedLocked(s *discordgo.Session, user *discordgo.User) {
+	content := fmt.Sprintf("A spot opened up and you've been promoted from the waitlist! https://discord.com/channels/%s/%s/%s", q.guildID, q.channelID, q.currentMsgID)
+	q.notifyLocked(s, user.ID, notifyPromote, content)
+}
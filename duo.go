@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// withDuoLocked returns the users that should join alongside user: the user
+// themselves and their duo partner if they have one who isn't queued yet.
+// lock must be held
+func (q *queueState) withDuoLocked(user *discordgo.User) []*discordgo.User {
+	users := []*discordgo.User{user}
+	if partner := q.duos[user.ID]; partner != nil && !q.isQueuedLocked(partner.ID) {
+		users = append(users, partner)
+	}
+	return users
+}
+
+// waitlistUnitLocked returns the members that must be promoted together with
+// m: m alone, or m and their duo partner if the partner is also waitlisted.
+// lock must be held
+func (q *queueState) waitlistUnitLocked(m *queueMember) []*queueMember {
+	unit := []*queueMember{m}
+	if partner := q.duos[m.ID]; partner != nil {
+		for _, w := range q.waitlist {
+			if w.ID == partner.ID {
+				unit = append(unit, w)
+				break
+			}
+		}
+	}
+	return unit
+}
+
+func (q *queueState) handleDuo(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	user := i.Member.User
+	data := i.ApplicationCommandData()
+	if len(data.Options) == 0 {
+		partner := q.duos[user.ID]
+		delete(q.duoRequests, user.ID)
+		if partner == nil {
+			respondEphemeral(s, i, "You don't have a duo.")
+			return
+		}
+		delete(q.duos, user.ID)
+		delete(q.duos, partner.ID)
+		respondEphemeral(s, i, fmt.Sprintf("You are no longer a duo with <@%s>.", partner.ID))
+		return
+	}
+
+	partner := resolvedUser(data, data.Options[0])
+	if partner.ID == user.ID {
+		respondEphemeral(s, i, "You can't duo with yourself.")
+		return
+	}
+	if q.duos[user.ID] != nil {
+		respondEphemeral(s, i, fmt.Sprintf("You are already a duo with <@%s>. Run /standby-duo without a user to unlink first.", q.duos[user.ID].ID))
+		return
+	}
+	if q.duos[partner.ID] != nil {
+		respondEphemeral(s, i, fmt.Sprintf("<@%s> already has a duo.", partner.ID))
+		return
+	}
+
+	if req := q.duoRequests[partner.ID]; req == nil || req.ID != user.ID {
+		q.duoRequests[user.ID] = partner
+		respondEphemeral(s, i, fmt.Sprintf("Duo request sent. <@%s> needs to run /standby-duo with you to confirm.", partner.ID))
+		return
+	}
+
+	delete(q.duoRequests, partner.ID)
+	delete(q.duoRequests, user.ID)
+	q.duos[user.ID] = partner
+	q.duos[partner.ID] = user
+	respondEphemeral(s, i, fmt.Sprintf("You are now a duo with <@%s>. You'll join and leave the queue together.", partner.ID))
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	embedLayoutDescription = "description"
+	embedLayoutFields      = "fields"
+	// embedLayoutComponents uses Discord's components layout instead of an
+	// embed, falling back to the description layout where it's rejected.
+	embedLayoutComponents = "components"
+)
+
+// embedSection is a list of users shown on the queue message.
+type embedSection struct {
+	name  string
+	lines []string
+	// always shows the section even when it's empty
+	always bool
+}
+
+// lock must be held
+func (q *queueState) sectionsLocked() []embedSection {
+	return []embedSection{
+		{name: fmt.Sprintf("Queued users (%d)", len(q.users)), lines: q.mentionLinesLocked(q.users), always: true},
+		{name: fmt.Sprintf("Waitlist (%d)", len(q.waitlist)), lines: q.mentionLinesLocked(q.waitlist)},
+		{name: fmt.Sprintf("Conditional (%d)", len(q.conditional)), lines: q.conditionalLinesLocked()},
+		{name: "Can't make it", lines: q.declineLinesLocked()},
+	}
+}
+
+// lock must be held
+func (q *queueState) mentionLinesLocked(members []*queueMember) []string {
+	lines := make([]string, len(members))
+	for i, m := range members {
+		lines[i] = fmt.Sprintf("<@%s>", m.ID)
+		if !m.BrbUntil.IsZero() {
+			lines[i] += fmt.Sprintf(" (brb, back <t:%d:R>)", m.BrbUntil.Unix())
+		}
+		if flag, ok := q.alts[m.ID]; ok {
+			lines[i] += " (alt"
+			if flag.Main != nil {
+				lines[i] += fmt.Sprintf(" of <@%s>", flag.Main.ID)
+			}
+			lines[i] += ")"
+		}
+	}
+	return lines
+}
+
+// queueEmbedLocked renders the open queue in the guild's embed layout. The
+// fields layout puts each list in its own column, which reads better on
+// desktop for larger queues.
+// lock must be held
+func (q *queueState) queueEmbedLocked() *discordgo.MessageEmbed {
+	cfg := q.configs.get(q.guildID)
+	if cfg.EmbedLayout != embedLayoutFields {
+		return createQueueEmbed(q.titleLocked(), q.buildStringLocked(), cfg.Embed)
+	}
+
+	embed := createQueueEmbed(q.titleLocked(), q.buildHeaderLocked()+q.buildActivityLocked(), cfg.Embed)
+	for _, section := range q.sectionsLocked() {
+		if len(section.lines) == 0 && !section.always {
+			continue
+		}
+		value := "-"
+		if len(section.lines) > 0 {
+			value = strings.Join(section.lines, "\n")
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   section.name,
+			Value:  value,
+			Inline: true,
+		})
+	}
+	return embed
+}
+
+// queueComponentsLocked renders the queue as a container of text displays
+// with the queue buttons and a "join if" user select underneath. A closed
+// queue shows only its closed status.
+// lock must be held
+func (q *queueState) queueComponentsLocked(closed string) []discordgo.MessageComponent {
+	style := q.configs.get(q.guildID).Embed
+	title := "### " + q.titleLocked() + "\n"
+	var inner []discordgo.MessageComponent
+	if closed != "" {
+		inner = append(inner, discordgo.TextDisplay{Content: title + closed})
+	} else {
+		inner = append(inner, discordgo.TextDisplay{Content: title + q.buildHeaderLocked()})
+		inner = append(inner, discordgo.Separator{Divider: ptr(true)})
+		for _, section := range q.sectionsLocked() {
+			if len(section.lines) == 0 && !section.always {
+				continue
+			}
+			value := "-"
+			if len(section.lines) > 0 {
+				value = strings.Join(section.lines, "\n")
+			}
+			inner = append(inner, discordgo.TextDisplay{Content: fmt.Sprintf("**%s**\n%s", section.name, value)})
+		}
+		if activity := q.buildActivityLocked(); activity != "" {
+			inner = append(inner, discordgo.Separator{Divider: ptr(true)})
+			inner = append(inner, discordgo.TextDisplay{Content: strings.TrimSpace(activity)})
+		}
+	}
+	if closed != "" || q.closing == nil {
+		inner = append(inner, createQueueButtons(q.name, closed != "", style)...)
+	}
+	if closed == "" && q.closing == nil {
+		inner = append(inner, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:    discordgo.UserSelectMenu,
+				CustomID:    queueCustomID("join_if_select", q.name),
+				Placeholder: "Join if someone else joins...",
+			},
+		}})
+	}
+	return []discordgo.MessageComponent{
+		discordgo.Container{AccentColor: ptr(style.color()), Components: inner},
+	}
+}
+
+// sendQueueMessageLocked posts the queue message in the guild's layout. If
+// Discord rejects the components layout it resends it as an embed.
+// lock must be held
+func (q *queueState) sendQueueMessageLocked(s *discordgo.Session, cfg guildConfig) (*discordgo.Message, error) {
+	if cfg.EmbedLayout == embedLayoutComponents {
+		msg, err := s.ChannelMessageSendComplex(q.channelID, &discordgo.MessageSend{
+			Components:      q.queueComponentsLocked(""),
+			Flags:           discordgo.MessageFlagsIsComponentsV2,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		if err == nil {
+			q.components = true
+			return msg, nil
+		}
+		log.Printf("error sending components queue message, falling back to embed: %v\n", err)
+	}
+	return s.ChannelMessageSendComplex(q.channelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{q.queueEmbedLocked()},
+		Components: createQueueButtons(q.name, false, cfg.Embed),
+	})
+}
+
+// editQueueMessageLocked re-renders the queue message in the format it was
+// sent with, or replaces it with the closed status if one is given.
+// lock must be held
+func (q *queueState) editQueueMessageLocked(s *discordgo.Session, closed string) error {
+	edit := &discordgo.MessageEdit{
+		ID:      q.currentMsgID,
+		Channel: q.channelID,
+	}
+	style := q.configs.get(q.guildID).Embed
+	switch {
+	case q.components:
+		edit.Components = ptr(q.queueComponentsLocked(closed))
+		edit.Flags = discordgo.MessageFlagsIsComponentsV2
+		edit.AllowedMentions = &discordgo.MessageAllowedMentions{}
+	case closed != "":
+		edit.Embeds = &[]*discordgo.MessageEmbed{createQueueEmbed(q.titleLocked(), closed, style)}
+		edit.Components = ptr(createQueueButtons(q.name, true, style))
+	case q.closing != nil:
+		edit.Embeds = &[]*discordgo.MessageEmbed{q.queueEmbedLocked()}
+		edit.Components = &[]discordgo.MessageComponent{}
+	default:
+		edit.Embeds = &[]*discordgo.MessageEmbed{q.queueEmbedLocked()}
+		edit.Components = ptr(createQueueButtons(q.name, false, style))
+	}
+	_, err := s.ChannelMessageEditComplex(edit)
+	return err
+}
+
+func (q *queueState) configLayout(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	layout := opts["style"].StringValue()
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		cfg.EmbedLayout = layout
+	}); err != nil {
+		return "", err
+	}
+	if layout == embedLayoutComponents {
+		return "New queues will use the components layout. A queue that's already open keeps its current layout.", nil
+	}
+	return fmt.Sprintf("Queue messages will use the %s layout from the next update.", layout), nil
+}
+
+// defaultEmbedColor is the queue message's color unless the guild set one.
+const defaultEmbedColor = 0x0099FF
+
+// embedStyle is how a guild's queue messages look, set with
+// /standby-config embed. Empty fields keep the defaults.
+type embedStyle struct {
+	// Color is a hex color like "#5865F2".
+	Color     string `json:"color,omitempty"`
+	Thumbnail string `json:"thumbnail,omitempty"`
+	Footer    string `json:"footer,omitempty"`
+	// The button emojis are a unicode emoji or a custom one as <:name:id>.
+	JoinLabel  string `json:"join_label,omitempty"`
+	JoinEmoji  string `json:"join_emoji,omitempty"`
+	LeaveLabel string `json:"leave_label,omitempty"`
+	LeaveEmoji string `json:"leave_emoji,omitempty"`
+	CloseLabel string `json:"close_label,omitempty"`
+	CloseEmoji string `json:"close_emoji,omitempty"`
+}
+
+// color returns the embed color, the default if unset or invalid.
+func (e embedStyle) color() int {
+	if c, err := parseColor(e.Color); err == nil {
+		return c
+	}
+	return defaultEmbedColor
+}
+
+// apply sets the style's color, thumbnail and footer on embed.
+func (e embedStyle) apply(embed *discordgo.MessageEmbed) {
+	embed.Color = e.color()
+	if e.Thumbnail != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: e.Thumbnail}
+	}
+	if e.Footer != "" {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: e.Footer}
+	}
+}
+
+// styledButton returns a button's label and emoji, falling back to
+// defaultLabel and no emoji.
+func styledButton(label, emoji, defaultLabel string) (string, *discordgo.ComponentEmoji) {
+	if label == "" {
+		label = defaultLabel
+	}
+	if emoji == "" {
+		return label, nil
+	}
+	e, _ := parseEmoji(emoji)
+	return label, e
+}
+
+func parseColor(s string) (int, error) {
+	c, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(s), "#"), 16, 32)
+	if err != nil || c > 0xFFFFFF {
+		return 0, fmt.Errorf("%q isn't a hex color like #5865F2", s)
+	}
+	return int(c), nil
+}
+
+var customEmojiPattern = regexp.MustCompile(`^<(a?):(\w+):(\d+)>$`)
+
+// parseEmoji parses a custom emoji as Discord formats it in messages, or a
+// unicode one.
+func parseEmoji(s string) (*discordgo.ComponentEmoji, error) {
+	s = strings.TrimSpace(s)
+	if m := customEmojiPattern.FindStringSubmatch(s); m != nil {
+		return &discordgo.ComponentEmoji{Name: m[2], ID: m[3], Animated: m[1] == "a"}, nil
+	}
+	if s == "" || len(s) > 32 {
+		return nil, fmt.Errorf("%q isn't an emoji", s)
+	}
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			return nil, fmt.Errorf("%q isn't an emoji", s)
+		}
+	}
+	return &discordgo.ComponentEmoji{Name: s}, nil
+}
+
+func (q *queueState) configEmbed(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	str := func(name string) (string, bool) {
+		opt, ok := opts[name]
+		if !ok {
+			return "", false
+		}
+		return strings.TrimSpace(opt.StringValue()), true
+	}
+	if v, ok := str("color"); ok {
+		if _, err := parseColor(v); err != nil {
+			return fmt.Sprintf("That color doesn't work: %v.", err), nil
+		}
+	}
+	if v, ok := str("thumbnail"); ok && !strings.HasPrefix(v, "https://") {
+		return "The thumbnail has to be an https:// image link.", nil
+	}
+	for _, name := range []string{"join_emoji", "leave_emoji", "close_emoji"} {
+		if v, ok := str(name); ok {
+			if _, err := parseEmoji(v); err != nil {
+				return fmt.Sprintf("That emoji doesn't work: %v.", err), nil
+			}
+		}
+	}
+
+	var style embedStyle
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		if opt, ok := opts["reset"]; ok && opt.BoolValue() {
+			cfg.Embed = embedStyle{}
+		}
+		for name, field := range map[string]*string{
+			"color":       &cfg.Embed.Color,
+			"thumbnail":   &cfg.Embed.Thumbnail,
+			"footer":      &cfg.Embed.Footer,
+			"join_label":  &cfg.Embed.JoinLabel,
+			"join_emoji":  &cfg.Embed.JoinEmoji,
+			"leave_label": &cfg.Embed.LeaveLabel,
+			"leave_emoji": &cfg.Embed.LeaveEmoji,
+			"close_label": &cfg.Embed.CloseLabel,
+			"close_emoji": &cfg.Embed.CloseEmoji,
+		} {
+			if v, ok := str(name); ok {
+				*field = v
+			}
+		}
+		style = cfg.Embed
+	}); err != nil {
+		return "", err
+	}
+
+	join, _ := styledButton(style.JoinLabel, "", "Join")
+	leave, _ := styledButton(style.LeaveLabel, "", "Leave")
+	closeLabel, _ := styledButton(style.CloseLabel, "", "Close")
+	var sb strings.Builder
+	sb.WriteString("Queue messages will look like this from the next update:\n")
+	sb.WriteString(fmt.Sprintf("Color: #%06X\n", style.color()))
+	sb.WriteString(fmt.Sprintf("Thumbnail: %s\n", orNone(style.Thumbnail)))
+	sb.WriteString(fmt.Sprintf("Footer: %s\n", orNone(style.Footer)))
+	sb.WriteString(fmt.Sprintf("Buttons: %s · %s · %s", strings.TrimSpace(style.JoinEmoji+" "+join),
+		strings.TrimSpace(style.LeaveEmoji+" "+leave), strings.TrimSpace(style.CloseEmoji+" "+closeLabel)))
+	return sb.String(), nil
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	// maxPromotionWaits is how many past promotions are remembered for
+	// waitlist estimates.
+	maxPromotionWaits = 500
+	// minETASamples is how many past promotions from a waitlist position an
+	// estimate needs.
+	minETASamples = 3
+)
+
+// promotionWait is how long a member waited to be promoted after joining a
+// queue's waitlist at Position.
+type promotionWait struct {
+	Queue    string        `json:"queue,omitempty"`
+	Position int           `json:"position"`
+	Waited   time.Duration `json:"waited"`
+	At       time.Time     `json:"at"`
+}
+
+// recordPromotionWaitLocked remembers how long m waited on the selected
+// queue's waitlist before being promoted.
+// lock must be held
+func (q *queueState) recordPromotionWaitLocked(m *queueMember) {
+	if m.WaitlistPos == 0 {
+		return
+	}
+	q.promotionWaits = append(q.promotionWaits, promotionWait{
+		Queue:    q.name,
+		Position: m.WaitlistPos,
+		Waited:   time.Since(m.JoinedAt),
+		At:       time.Now(),
+	})
+	if len(q.promotionWaits) > maxPromotionWaits {
+		q.promotionWaits = q.promotionWaits[len(q.promotionWaits)-maxPromotionWaits:]
+	}
+}
+
+// waitlistETALocked estimates how much longer m will wait on the selected
+// queue's waitlist. Past waits of members who joined it at the same
+// position as m are compared with how long m has waited already, and the
+// median of what was left of the longer ones is the estimate. Past waits on
+// the same weekday in the guild's timezone are preferred, since queues fill
+// faster on some days. It returns "" without enough history.
+// lock must be held
+func (q *queueState) waitlistETALocked(m *queueMember) string {
+	if m.WaitlistPos == 0 {
+		return ""
+	}
+	loc := q.configs.get(q.guildID).location()
+	now := time.Now().In(loc)
+	waited := now.Sub(m.JoinedAt)
+	var all, sameDay []time.Duration
+	for _, w := range q.promotionWaits {
+		if w.Queue != q.name || w.Position != m.WaitlistPos || w.Waited <= waited {
+			continue
+		}
+		all = append(all, w.Waited-waited)
+		if w.At.In(loc).Weekday() == now.Weekday() {
+			sameDay = append(sameDay, w.Waited-waited)
+		}
+	}
+	switch {
+	case len(sameDay) >= minETASamples:
+		return fmt.Sprintf("~%s more based on past %ss", humanDuration(medianDuration(sameDay)), now.Weekday())
+	case len(all) >= minETASamples:
+		return fmt.Sprintf("~%s more based on past waits", humanDuration(medianDuration(all)))
+	}
+	return ""
+}
+
+func medianDuration(ds []time.Duration) time.Duration {
+	slices.Sort(ds)
+	return max(ds[len(ds)/2], time.Minute)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// lastActivityLocked returns when the queue was opened or last joined or left.
+// lock must be held
+func (q *queueState) lastActivityLocked() time.Time {
+	if len(q.actions) > 0 {
+		return q.actions[len(q.actions)-1].at
+	}
+	return q.openedAt
+}
+
+// checkExpiryLocked closes the queue once it has gone ExpireAfter without
+// anyone joining or leaving.
+// lock must be held
+func (q *queueState) checkExpiryLocked(s *discordgo.Session) {
+	expireAfter := current(&ExpireAfter)
+	if expireAfter <= 0 || q.currentMsgID == "" || time.Since(q.lastActivityLocked()) < expireAfter {
+		return
+	}
+	log.Printf("queue %s expired after %s without activity\n", q.currentMsgID, expireAfter)
+	q.closeQueueAsLocked(s, "Queue expired", waitlistExpired)
+}
@@ -0,0 +1,44 @@
+package main
+
+// How members leave a waitlist, counted per guild so admins can see how
+// often the waitlist gets people a game and tune its size and PromotionOrder.
+const (
+	waitlistPromoted = "promoted"
+	waitlistLeft     = "left"
+	waitlistKicked   = "kicked"
+	// waitlistClosed is the queue closing or launching with them still
+	// waiting, and waitlistExpired is it expiring, so nobody got a game.
+	waitlistClosed  = "closed"
+	waitlistExpired = "expired"
+)
+
+// recordWaitlistExitLocked counts how the user left the selected queue's
+// waitlist, if they were on it.
+// lock must be held
+func (q *queueState) recordWaitlistExitLocked(userID, outcome string) {
+	if q.waitlistPositionLocked(userID) == 0 {
+		return
+	}
+	waitlistExits.WithLabelValues(q.guildID, outcome).Inc()
+}
+
+// recordSkipsLocked counts the members ahead of unit on the waitlist that
+// it's about to be promoted past, e.g. because a duo didn't fit or the
+// rotation order picked someone who played less.
+// lock must be held
+func (q *queueState) recordSkipsLocked(unit []*queueMember) {
+	inUnit := make(map[string]bool)
+	for _, m := range unit {
+		inUnit[m.ID] = true
+	}
+	skipped := 0
+	for _, m := range q.waitlist {
+		if inUnit[m.ID] {
+			break
+		}
+		skipped++
+	}
+	if skipped > 0 {
+		waitlistSkips.WithLabelValues(q.guildID).Add(float64(skipped))
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	notifyStyleMention = "mention"
+	notifyStyleSilent  = "silent"
+)
+
+// guildConfig is the per-guild configuration written by /standby-setup.
+// Unset fields fall back to the environment in the home guild, GuildID.
+type guildConfig struct {
+	ChannelID    string   `json:"channel_id,omitempty"`
+	AdminRoleIDs []string `json:"admin_role_ids,omitempty"`
+	QueueSize    int      `json:"queue_size,omitempty"`
+	NotifyStyle  string   `json:"notify_style,omitempty"`
+
+	// StaffChannelID, ArchiveChannelID and PingRoleID are described with
+	// the environment variables they default to in main.go.
+	StaffChannelID   string `json:"staff_channel_id,omitempty"`
+	ArchiveChannelID string `json:"archive_channel_id,omitempty"`
+	PingRoleID       string `json:"ping_role_id,omitempty"`
+
+	// CommandChannelIDs restricts /standby to these channels if set.
+	CommandChannelIDs []string `json:"command_channel_ids,omitempty"`
+	// ChannelQueues opens queues in the channel /standby is used in, each
+	// channel's queue named after it, instead of in ChannelID.
+	ChannelQueues bool `json:"channel_queues,omitempty"`
+
+	// Templates overrides announcement messages by kind, see templates.go.
+	Templates map[string]string `json:"templates,omitempty"`
+
+	// EmbedLayout is embedLayoutDescription, embedLayoutFields or
+	// embedLayoutComponents.
+	EmbedLayout string `json:"embed_layout,omitempty"`
+	// Embed is how queue messages look, see embed.go.
+	Embed embedStyle `json:"embed,omitempty"`
+
+	// MapPool is the maps captains veto from, see veto.go.
+	MapPool []string `json:"map_pool,omitempty"`
+
+	// VoteOptions are the maps or modes queued players vote on once the
+	// queue fills, see mapvote.go.
+	VoteOptions []string `json:"vote_options,omitempty"`
+
+	// RequiredAccounts maps queue names to the account provider players
+	// must link before joining, see accounts.go.
+	RequiredAccounts map[string]string `json:"required_accounts,omitempty"`
+
+	// RankedQueues lists queues that members flagged as alts can't join,
+	// see alts.go.
+	RankedQueues []string `json:"ranked_queues,omitempty"`
+
+	// NoCelebrations leaves dates saved with /standby-celebrate out of fill
+	// messages, see celebrate.go.
+	NoCelebrations bool `json:"no_celebrations,omitempty"`
+
+	// PlainStatus spells out queue status in words rather than leaving it
+	// to colors and emoji, see plainstatus.go.
+	PlainStatus bool `json:"plain_status,omitempty"`
+
+	// GameBoard keeps a pinned message in each queue channel listing its
+	// open queues, see board.go.
+	GameBoard bool `json:"game_board,omitempty"`
+
+	// QueueRoles maps queue names to the roles each player fills, with a
+	// role repeated for each slot, see roles.go.
+	QueueRoles map[string][]string `json:"queue_roles,omitempty"`
+
+	// VoiceQueues maps queue names to the voice channel joining depends on,
+	// see voice.go.
+	VoiceQueues map[string]*voiceQueue `json:"voice_queues,omitempty"`
+
+	// APITokenHash is the SHA-256 of the guild's REST API token, see
+	// api.go. The token itself is only shown when it's made.
+	APITokenHash string `json:"api_token_hash,omitempty"`
+
+	// Timezone is the IANA timezone the guild plays in, for waitlist
+	// estimates by weekday and as the default for /standby-schedule.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// withDefaults fills in unset fields. The channels and roles from the
+// environment only exist in the home guild, so other guilds don't get them.
+func (c guildConfig) withDefaults(home bool) guildConfig {
+	if home {
+		if c.ChannelID == "" {
+			c.ChannelID = current(&ChannelID)
+		}
+		if adminRoleID := current(&AdminRoleID); len(c.AdminRoleIDs) == 0 && adminRoleID != "" {
+			c.AdminRoleIDs = []string{adminRoleID}
+		}
+		if c.StaffChannelID == "" {
+			c.StaffChannelID = current(&StaffChannelID)
+		}
+		if c.ArchiveChannelID == "" {
+			c.ArchiveChannelID = current(&ArchiveChannelID)
+		}
+		if c.PingRoleID == "" {
+			c.PingRoleID = current(&PingRoleID)
+		}
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = current(&QueueSize)
+	}
+	if c.NotifyStyle == "" {
+		c.NotifyStyle = notifyStyleMention
+	}
+	if c.EmbedLayout == "" {
+		c.EmbedLayout = embedLayoutDescription
+	}
+	return c
+}
+
+// location returns the guild's Timezone, or UTC if it isn't set.
+func (c guildConfig) location() *time.Location {
+	if c.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// commandAllowedIn reports whether /standby may be used in channelID.
+func (c guildConfig) commandAllowedIn(channelID string) bool {
+	if len(c.CommandChannelIDs) == 0 {
+		return true
+	}
+	for _, id := range c.CommandChannelIDs {
+		if id == channelID {
+			return true
+		}
+	}
+	return false
+}
+
+// isRanked reports whether the queue called name excludes alts.
+func (c guildConfig) isRanked(name string) bool {
+	for _, n := range c.RankedQueues {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c guildConfig) isAdmin(m *discordgo.Member) bool {
+	for _, r := range m.Roles {
+		for _, id := range c.AdminRoleIDs {
+			if r == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// configStore persists guild configs as a JSON file.
+type configStore struct {
+	sync.Mutex
+
+	path   string
+	guilds map[string]guildConfig
+}
+
+func loadConfigStore(path string) (*configStore, error) {
+	c := &configStore{
+		path:   path,
+		guilds: make(map[string]guildConfig),
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.guilds); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// get returns the guild's config with defaults applied.
+func (c *configStore) get(guildID string) guildConfig {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.guilds[guildID].withDefaults(guildID == GuildID)
+}
+
+// configured reports whether the guild has been through /standby-setup.
+func (c *configStore) configured(guildID string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	_, ok := c.guilds[guildID]
+	return ok
+}
+
+// update applies fn to the guild's stored config and saves it. Configs from
+// get share their maps with the stored one and are read without this lock,
+// so fn is given copies of the maps to change.
+func (c *configStore) update(guildID string, fn func(*guildConfig)) error {
+	c.Lock()
+	defer c.Unlock()
+
+	cfg := c.guilds[guildID]
+	cfg.Templates = maps.Clone(cfg.Templates)
+	cfg.RequiredAccounts = maps.Clone(cfg.RequiredAccounts)
+	cfg.QueueRoles = maps.Clone(cfg.QueueRoles)
+	cfg.VoiceQueues = maps.Clone(cfg.VoiceQueues)
+	fn(&cfg)
+	c.guilds[guildID] = cfg
+	return writeJSONFile(c.path, c.guilds)
+}
+
+// writeJSONFile atomically replaces path with v encoded as JSON.
+func writeJSONFile(path string, v any) error {
+	return writeJSONFileMode(path, v, 0o644)
+}
+
+// writeJSONFileMode is writeJSONFile for a file created with perm.
+func writeJSONFileMode(path string, v any, perm os.FileMode) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	// A leftover tmp keeps its mode, so it's removed first.
+	os.Remove(tmp)
+	if err := os.WriteFile(tmp, b, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestConfigUpdateWhileReading changes a guild's maps while another
+// goroutine reads a config it got before, which is a data race unless
+// update copies the maps. Run it with -race.
+func TestConfigUpdateWhileReading(t *testing.T) {
+	c, err := loadConfigStore(filepath.Join(t.TempDir(), "guild_config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const guildID = "guild"
+	if err := c.update(guildID, func(cfg *guildConfig) {
+		cfg.Templates = map[string]string{templateFill: "go"}
+		cfg.RequiredAccounts = map[string]string{"": "riot"}
+		cfg.QueueRoles = map[string][]string{"": {"tank"}}
+		cfg.VoiceQueues = map[string]*voiceQueue{"": {Mode: voiceModeRequire}}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	read := c.get(guildID)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			_ = read.Templates[templateFill]
+			_ = read.RequiredAccounts[""]
+			_ = read.QueueRoles[""]
+			_ = read.VoiceQueues[""]
+		}
+	}()
+	for n := range 100 {
+		key := strconv.Itoa(n)
+		if err := c.update(guildID, func(cfg *guildConfig) {
+			cfg.Templates[key] = key
+			cfg.RequiredAccounts[key] = key
+			cfg.QueueRoles[key] = []string{key}
+			cfg.VoiceQueues[key] = &voiceQueue{}
+			delete(cfg.Templates, templateFill)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+
+	if got := read.Templates[templateFill]; got != "go" {
+		t.Errorf("config read before the updates has template %q, want %q", got, "go")
+	}
+	if got := c.get(guildID).Templates["99"]; got != "99" {
+		t.Errorf("updated config has template %q, want %q", got, "99")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// guildAllowed reports whether the bot may stay in the guild. The configured
+// GuildID is always allowed; otherwise the denylist wins over the allowlist,
+// and an empty allowlist allows everyone.
+func guildAllowed(guildID string) bool {
+	if guildID == GuildID {
+		return true
+	}
+	for _, id := range current(&GuildDenylist) {
+		if id == guildID {
+			return false
+		}
+	}
+	allowlist := current(&GuildAllowlist)
+	if len(allowlist) == 0 {
+		return true
+	}
+	for _, id := range allowlist {
+		if id == guildID {
+			return true
+		}
+	}
+	return false
+}
+
+// leaveDisallowedGuild leaves guilds the operator hasn't allowed. GuildCreate
+// fires for every guild on startup and whenever the bot is added to one.
+func leaveDisallowedGuild(s *discordgo.Session, g *discordgo.GuildCreate) {
+	if guildAllowed(g.ID) {
+		return
+	}
+	log.Printf("leaving guild %s (%s): not allowed\n", g.Name, g.ID)
+	if err := s.GuildLeave(g.ID); err != nil {
+		log.Printf("error leaving guild %s: %v\n", g.ID, err)
+	}
+}
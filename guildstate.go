@@ -0,0 +1,244 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// guildStates keeps a queueState per guild, each with its own lock, saved
+// state and scheduler. A guild's state is set up the first time the guild
+// is seen, which for guilds the bot is already in is on startup.
+type guildStates struct {
+	sync.Mutex
+
+	s        *discordgo.Session
+	presence *presenceWatcher
+	configs  *configStore
+	history  *historyStore
+	health   *healthCheck
+	// linkedRoles is nil unless linked roles are set up, see linkedroles.go
+	linkedRoles *linkedRoles
+	reporter    *errorReporter
+
+	states map[string]*queueState
+	// registered are the guilds the slash commands were registered in
+	registered map[string]bool
+	// maintenance is shown to users in every guild instead of handling
+	// their interactions while set
+	maintenance string
+}
+
+func newGuildStates(s *discordgo.Session, presence *presenceWatcher, configs *configStore, history *historyStore, health *healthCheck, linked *linkedRoles, reporter *errorReporter) *guildStates {
+	return &guildStates{
+		s:           s,
+		presence:    presence,
+		configs:     configs,
+		history:     history,
+		health:      health,
+		linkedRoles: linked,
+		reporter:    reporter,
+		states:      make(map[string]*queueState),
+		registered:  make(map[string]bool),
+	}
+}
+
+// statePath is where the guild's state is saved. The home guild keeps
+// StatePath so existing state is picked up; other guilds get the guild ID
+// added before the extension.
+func statePath(guildID string) string {
+	if guildID == GuildID {
+		return StatePath
+	}
+	ext := filepath.Ext(StatePath)
+	return strings.TrimSuffix(StatePath, ext) + "." + guildID + ext
+}
+
+// newQueueState returns an empty state for the guild. Only the home guild
+// shows its queues in the bot's status, since the status is shared by every
+// guild.
+func (g *guildStates) newQueueState(guildID string) *queueState {
+	q := &queueState{
+		guildID:          guildID,
+		configs:          g.configs,
+		history:          g.history,
+		linkedRoles:      g.linkedRoles,
+		reporter:         g.reporter,
+		setupDrafts:      make(map[string]*guildConfig),
+		queues:           make(map[string]*queue),
+		accounts:         make(map[string]map[string]string),
+		alts:             make(map[string]*altFlag),
+		regions:          make(map[string]string),
+		ranks:            make(map[string]*playerRank),
+		rollPicks:        make(map[string][]time.Time),
+		mainRoles:        make(map[string]string),
+		lastFlexed:       make(map[string]time.Time),
+		celebrations:     make(map[string]*celebration),
+		duos:             make(map[string]*discordgo.User),
+		duoRequests:      make(map[string]*discordgo.User),
+		queuers:          make(map[string]map[string]bool),
+		boards:           make(map[string]string),
+		prefs:            make(map[string]*userPrefs),
+		notified:         make(map[string]time.Time),
+		stats:            make(map[string]*playerStats),
+		pendingReactions: make(map[string]time.Time),
+		scheduler:        newScheduler(),
+		limiter:          newActionLimiter(),
+	}
+	if guildID == GuildID {
+		q.presence = g.presence
+	}
+	q.registerRoutes()
+	q.registerJobs()
+	q.queues[""] = newQueue("")
+	q.selectQueueLocked(q.queues[""])
+	return q
+}
+
+// get returns the guild's state, restoring it from disk and starting its
+// scheduler the first time it's asked for.
+func (g *guildStates) get(guildID string) *queueState {
+	g.Lock()
+	defer g.Unlock()
+
+	if q, ok := g.states[guildID]; ok {
+		return q
+	}
+	q := g.newQueueState(guildID)
+	if err := q.restoreState(g.s); err != nil {
+		log.Printf("error restoring queue state for guild %s: %v\n", guildID, err)
+	}
+	q.Lock()
+	q.scheduleHistoryPurgeLocked()
+	q.schedulePruneLocked()
+	q.Unlock()
+	go q.runScheduler(g.s)
+	g.states[guildID] = q
+	return q
+}
+
+// all returns every guild's state set up so far.
+func (g *guildStates) all() []*queueState {
+	g.Lock()
+	defer g.Unlock()
+
+	states := make([]*queueState, 0, len(g.states))
+	for _, q := range g.states {
+		states = append(states, q)
+	}
+	return states
+}
+
+// interactionGuildID returns the guild an interaction belongs to. Buttons
+// sent in DMs have no guild, so they carry its ID as the last custom ID
+// argument; older ones without it belong to the home guild.
+func interactionGuildID(i *discordgo.InteractionCreate) string {
+	if i.GuildID != "" {
+		return i.GuildID
+	}
+	if i.Type == discordgo.InteractionMessageComponent {
+		if args := customIDArgs(i); len(args) > 1 {
+			return args[len(args)-1]
+		}
+	}
+	return GuildID
+}
+
+// handleGuildCreate sets up each guild the bot is allowed in as it becomes
+// available, registering the slash commands there.
+func (g *guildStates) handleGuildCreate(s *discordgo.Session, gc *discordgo.GuildCreate) {
+	if !guildAllowed(gc.ID) {
+		return
+	}
+	q := g.get(gc.ID)
+	q.promptSetup(s, gc)
+	g.registerCommands(gc.ID)
+}
+
+// registerCommands registers the slash commands in the guild, once per run.
+// Guild commands show up right away, unlike global ones.
+func (g *guildStates) registerCommands(guildID string) {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.registered[guildID] {
+		return
+	}
+	if _, err := g.s.ApplicationCommandBulkOverwrite(AppID, guildID, commands); err != nil {
+		log.Printf("error registering commands in guild %s: %v\n", guildID, err)
+		return
+	}
+	g.registered[guildID] = true
+	g.health.commandsRegistered.Store(true)
+}
+
+// unregisterCommands removes the slash commands from every guild they were
+// registered in.
+func (g *guildStates) unregisterCommands() {
+	g.Lock()
+	defer g.Unlock()
+
+	for guildID := range g.registered {
+		if _, err := g.s.ApplicationCommandBulkOverwrite(AppID, guildID, nil); err != nil {
+			log.Printf("error removing commands from guild %s: %v\n", guildID, err)
+		}
+	}
+}
+
+// handleInteraction passes the interaction to its guild's state.
+func (g *guildStates) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type == discordgo.InteractionApplicationCommand && isOwnerCommand(i.ApplicationCommandData().Name) {
+		g.handleOwnerCommand(s, i)
+		return
+	}
+	if g.maintenanceBlocked(s, i) {
+		return
+	}
+	guildID := interactionGuildID(i)
+	if !guildAllowed(guildID) {
+		return
+	}
+	q := g.get(guildID)
+	defer q.saveState()
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		q.handleSlashCommand(s, i)
+	case discordgo.InteractionMessageComponent:
+		q.componentRoutes.dispatch(s, i)
+	case discordgo.InteractionModalSubmit:
+		q.modalRoutes.dispatch(s, i)
+	}
+}
+
+func (g *guildStates) handleVoiceStateUpdate(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	if !guildAllowed(v.GuildID) {
+		return
+	}
+	defer g.reporter.recoverBackground("voice state update", map[string]string{"guild": v.GuildID, "user": v.UserID})
+	q := g.get(v.GuildID)
+	q.handleVoiceStateUpdate(s, v)
+	q.handleVoiceQueueUpdate(s, v)
+}
+
+// handleDebugDump dumps the state of the guild given by the guild query
+// parameter, the home guild by default. Any guild's members can be dumped,
+// so it's only served behind DebugToken, see requireToken.
+func (g *guildStates) handleDebugDump(w http.ResponseWriter, r *http.Request) {
+	guildID := r.URL.Query().Get("guild")
+	if guildID == "" {
+		guildID = GuildID
+	}
+	g.Lock()
+	q, ok := g.states[guildID]
+	g.Unlock()
+	if !ok {
+		http.Error(w, "unknown guild", http.StatusNotFound)
+		return
+	}
+	q.handleDebugDump(w, r)
+}
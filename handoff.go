@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// handoffNext is the handoff option that promotes the waitlist as usual.
+const handoffNext = "next"
+
+// handleLeaveButton lets a player leaving a full queue pick who takes their
+// slot from the waitlist. It reports false when there's nothing to pick, so
+// the click is handled as a plain leave.
+func (q *queueState) handleLeaveButton(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	if len(q.users) < q.size || len(q.waitlist) == 0 || !q.inMainQueueLocked(i.Member.User.ID) {
+		return false
+	}
+
+	options := []discordgo.SelectMenuOption{
+		{Label: "Next in line", Value: handoffNext, Description: "Promote the waitlist in order"},
+	}
+	for _, m := range q.waitlist {
+		if len(options) == 25 {
+			break
+		}
+		options = append(options, discordgo.SelectMenuOption{Label: m.Username, Value: m.ID})
+	}
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: "The queue is full. Who should take your slot?",
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.SelectMenu{
+						MenuType:    discordgo.StringSelectMenu,
+						CustomID:    queueCustomID("leave_handoff", q.name),
+						Placeholder: "Pick a replacement",
+						Options:     options,
+					},
+				}},
+			},
+		},
+	}); err != nil {
+		log.Printf("error responding with handoff picker: %v\n", err)
+	}
+	return true
+}
+
+// handleLeaveHandoff removes the player and promotes the replacement they
+// picked ahead of the rest of the waitlist.
+func (q *queueState) handleLeaveHandoff(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	user := i.Member.User
+	content := "You already left the queue."
+	if q.currentMsgID != "" && q.inMainQueueLocked(user.ID) {
+		q.leaveLocked(user)
+		pick := i.MessageComponentData().Values[0]
+		content = "You left the queue."
+		if pick != handoffNext {
+			if m := q.waitlistMemberLocked(pick); m != nil && q.promoteUnitLocked(q.waitlistUnitLocked(m)) {
+				content = fmt.Sprintf("You left the queue and handed your slot to <@%s>.", pick)
+			}
+		}
+		q.promoteLocked()
+	}
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	}); err != nil {
+		log.Printf("error responding to handoff: %v\n", err)
+	}
+	if q.currentMsgID != "" {
+		q.refreshLocked(s)
+	}
+}
+
+// lock must be held
+func (q *queueState) inMainQueueLocked(userID string) bool {
+	for _, m := range q.users {
+		if m.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// lock must be held
+func (q *queueState) waitlistMemberLocked(userID string) *queueMember {
+	for _, m := range q.waitlist {
+		if m.ID == userID {
+			return m
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// heartbeatStaleAfter is how long the gateway can go without acknowledging
+// a heartbeat before the bot counts as unhealthy. Discord heartbeats every
+// 41.25 seconds, so this allows a few to go missing while discordgo
+// reconnects.
+const heartbeatStaleAfter = 3 * time.Minute
+
+// healthCheck serves /healthz and /readyz for liveness and readiness probes.
+type healthCheck struct {
+	s *discordgo.Session
+	// commandsRegistered is set once the slash commands are registered in a
+	// guild.
+	commandsRegistered atomic.Bool
+}
+
+type healthStatus struct {
+	Connected          bool      `json:"connected"`
+	LastHeartbeatAck   time.Time `json:"last_heartbeat_ack"`
+	HeartbeatLatency   string    `json:"heartbeat_latency"`
+	CommandsRegistered bool      `json:"commands_registered"`
+}
+
+func (h *healthCheck) status() healthStatus {
+	h.s.RLock()
+	defer h.s.RUnlock()
+	return healthStatus{
+		Connected:          h.s.DataReady,
+		LastHeartbeatAck:   h.s.LastHeartbeatAck,
+		HeartbeatLatency:   h.s.HeartbeatLatency().String(),
+		CommandsRegistered: h.commandsRegistered.Load(),
+	}
+}
+
+// heartbeatFresh reports whether the gateway acknowledged a heartbeat
+// recently.
+func (st healthStatus) heartbeatFresh() bool {
+	return time.Since(st.LastHeartbeatAck) < heartbeatStaleAfter
+}
+
+// handleHealthz fails once the gateway has stopped acknowledging heartbeats,
+// so a bot stuck disconnected gets restarted.
+func (h *healthCheck) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	st := h.status()
+	writeHealth(w, st, st.heartbeatFresh())
+}
+
+// handleReadyz fails until the gateway is connected and the commands are
+// registered, and while the gateway is reconnecting.
+func (h *healthCheck) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	st := h.status()
+	writeHealth(w, st, st.Connected && st.CommandsRegistered && st.heartbeatFresh())
+}
+
+func writeHealth(w http.ResponseWriter, st healthStatus, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(st); err != nil {
+		log.Printf("error writing health status: %v\n", err)
+	}
+}
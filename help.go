@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxHelpPageLength keeps help pages well under Discord's 2000 character
+// message limit.
+const maxHelpPageLength = 1800
+
+// adminDescriptionPrefix starts the description of commands and
+// subcommands only admins can use.
+const adminDescriptionPrefix = "Admin command"
+
+var helpCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-help",
+	Description: "Show how to use the queue, the admin commands and this server's settings",
+}
+
+// queueButtonHelp describes the buttons on the queue message, which have no
+// metadata to generate it from.
+var queueButtonHelp = []string{
+	"**Join** puts you in the queue, or on the waitlist once it's full. If someone lets you bring them, you can pick them right after.",
+	"**Waitlist** waits behind the queue without taking a slot.",
+	"**Leave** takes you out. Leaving a full queue lets you pick who takes your slot.",
+	"**Can't play** tells the others you're out this time.",
+	"**Last call** lets the opener or an admin close the queue soon unless it fills.",
+	"**Close** is for the opener or an admin, and can be undone for a moment.",
+	"**Notifications** picks which DMs you get.",
+}
+
+// helpPages builds the help from the registered commands and the guild's
+// config: queue buttons, member commands, admin commands, then the
+// settings. Sections too long for one message are split over several pages.
+func helpPages(cfg guildConfig) []string {
+	var user, admin []string
+	for _, c := range commands {
+		for _, line := range commandHelp(c) {
+			if line.admin {
+				admin = append(admin, line.text)
+			} else {
+				user = append(user, line.text)
+			}
+		}
+	}
+
+	var pages []string
+	pages = append(pages, paginateHelp("Queue buttons", queueButtonHelp)...)
+	pages = append(pages, paginateHelp("Commands", user)...)
+	pages = append(pages, paginateHelp("Admin commands", admin)...)
+	pages = append(pages, paginateHelp("This server's settings", settingsHelp(cfg))...)
+	for idx := range pages {
+		pages[idx] += fmt.Sprintf("\n-# Page %d of %d", idx+1, len(pages))
+	}
+	return pages
+}
+
+type helpLine struct {
+	text  string
+	admin bool
+}
+
+// commandHelp describes the command, or each of its subcommands if it has
+// any. A subcommand is admin only if it or its command is.
+func commandHelp(c *discordgo.ApplicationCommand) []helpLine {
+	admin := strings.HasPrefix(c.Description, adminDescriptionPrefix)
+	var lines []helpLine
+	for _, opt := range c.Options {
+		if opt.Type != discordgo.ApplicationCommandOptionSubCommand {
+			continue
+		}
+		lines = append(lines, helpLine{
+			text:  fmt.Sprintf("`/%s %s` %s", c.Name, opt.Name, helpDescription(opt.Description)),
+			admin: admin || strings.HasPrefix(opt.Description, adminDescriptionPrefix),
+		})
+	}
+	if len(lines) == 0 {
+		lines = append(lines, helpLine{
+			text:  fmt.Sprintf("`/%s` %s", c.Name, helpDescription(c.Description)),
+			admin: admin,
+		})
+	}
+	return lines
+}
+
+// helpDescription drops the admin prefix, which the page title already
+// says.
+func helpDescription(desc string) string {
+	if rest, ok := strings.CutPrefix(desc, adminDescriptionPrefix+" to "); ok && rest != "" {
+		return strings.ToUpper(rest[:1]) + rest[1:]
+	}
+	return desc
+}
+
+// settingsHelp describes the guild's current settings.
+func settingsHelp(cfg guildConfig) []string {
+	roles := make([]string, len(cfg.AdminRoleIDs))
+	for idx, id := range cfg.AdminRoleIDs {
+		roles[idx] = fmt.Sprintf("<@&%s>", id)
+	}
+	onOff := func(on bool) string {
+		if on {
+			return "on"
+		}
+		return "off"
+	}
+	channel := func(id string) string {
+		if id == "" {
+			return "none"
+		}
+		return fmt.Sprintf("<#%s>", id)
+	}
+	commandChannels := "any"
+	if len(cfg.CommandChannelIDs) > 0 {
+		commandChannels = channelMentions(cfg.CommandChannelIDs)
+	}
+	pingRole := "none"
+	if cfg.PingRoleID != "" {
+		pingRole = fmt.Sprintf("<@&%s>", cfg.PingRoleID)
+	}
+	templates := make([]string, 0, len(cfg.Templates))
+	for kind := range cfg.Templates {
+		templates = append(templates, kind)
+	}
+	sort.Strings(templates)
+
+	return []string{
+		"Queue channel: " + channel(cfg.ChannelID),
+		"Admin roles: " + orNone(strings.Join(roles, ", ")),
+		"Queue size: " + strconv.Itoa(cfg.QueueSize),
+		"Fill notifications: " + cfg.NotifyStyle,
+		"/standby allowed in: " + commandChannels,
+		"Queue per channel: " + onOff(cfg.ChannelQueues),
+		"Staff channel: " + channel(cfg.StaffChannelID),
+		"Archive channel: " + channel(cfg.ArchiveChannelID),
+		"Ping role: " + pingRole,
+		"Layout: " + cfg.EmbedLayout,
+		"Plain status: " + onOff(cfg.PlainStatus),
+		"Game board: " + onOff(cfg.GameBoard),
+		"Celebrations: " + onOff(!cfg.NoCelebrations),
+		"Custom templates: " + orNone(strings.Join(templates, ", ")),
+		"Map pool: " + orNone(strings.Join(cfg.MapPool, ", ")),
+		"Vote options: " + orNone(strings.Join(cfg.VoteOptions, ", ")),
+		"Ranked queues: " + orNone(strings.Join(queueNames(cfg.RankedQueues), ", ")),
+	}
+}
+
+// queueNames names the default queue, which has no name, for display.
+func queueNames(names []string) []string {
+	named := make([]string, len(names))
+	for idx, name := range names {
+		named[idx] = name
+		if name == "" {
+			named[idx] = "default"
+		}
+	}
+	return named
+}
+
+// paginateHelp puts lines under title on as many pages as they need, about
+// evenly filled.
+func paginateHelp(title string, lines []string) []string {
+	pages := fillHelpPages(title, lines, maxHelpPageLength)
+	if len(pages) < 2 {
+		return pages
+	}
+	total, longest := 0, 0
+	for _, line := range lines {
+		total += len(line) + 1
+		longest = max(longest, len(line)+1)
+	}
+	return fillHelpPages(title, lines, min(maxHelpPageLength, total/len(pages)+longest+len(title)+5))
+}
+
+// fillHelpPages fills each page up to limit before starting the next.
+func fillHelpPages(title string, lines []string, limit int) []string {
+	var (
+		pages []string
+		sb    strings.Builder
+	)
+	for _, line := range lines {
+		if sb.Len() > 0 && sb.Len()+len(line) > limit {
+			pages = append(pages, sb.String())
+			sb.Reset()
+		}
+		if sb.Len() == 0 {
+			sb.WriteString("### " + title + "\n")
+		}
+		sb.WriteString(line + "\n")
+	}
+	if sb.Len() > 0 {
+		pages = append(pages, sb.String())
+	}
+	return pages
+}
+
+// helpMessage is the help page at idx with buttons to flip to the others.
+func helpMessage(pages []string, idx int) *discordgo.InteractionResponseData {
+	idx = max(0, min(idx, len(pages)-1))
+	return &discordgo.InteractionResponseData{
+		Content:         pages[idx],
+		Flags:           discordgo.MessageFlagsEphemeral,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Previous",
+					Style:    discordgo.SecondaryButton,
+					CustomID: fmt.Sprintf("help_page:%d", idx-1),
+					Disabled: idx == 0,
+				},
+				discordgo.Button{
+					Label:    "Next",
+					Style:    discordgo.SecondaryButton,
+					CustomID: fmt.Sprintf("help_page:%d", idx+1),
+					Disabled: idx == len(pages)-1,
+				},
+			}},
+		},
+	}
+}
+
+func (q *queueState) handleHelp(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	pages := helpPages(q.configs.get(q.guildID))
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: helpMessage(pages, 0),
+	}); err != nil {
+		log.Printf("interaction %s: error responding with help: %v\n", interactionRef(i), err)
+	}
+}
+
+// handleHelpPage flips the help message to another page.
+func (q *queueState) handleHelpPage(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	idx, _ := strconv.Atoi(customIDArgs(i)[0])
+	pages := helpPages(q.configs.get(q.guildID))
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: helpMessage(pages, idx),
+	}); err != nil {
+		log.Printf("interaction %s: error flipping help page: %v\n", interactionRef(i), err)
+	}
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// jobHistoryPurge applies HistoryRetention to the history.
+	jobHistoryPurge = "history_purge"
+	// historyPurgeInterval is how often the history is purged.
+	historyPurgeInterval = 24 * time.Hour
+	// historyPurgeGrace is how long soft-deleted queues are kept before
+	// they're deleted for good, so a retention set too short by mistake can
+	// still be undone by hand.
+	historyPurgeGrace = 7 * 24 * time.Hour
+)
+
+// participant is someone who joined the queue or its waitlist while it was
+// open.
+type participant struct {
+	*discordgo.User
+	JoinedAt time.Time `json:"joined_at"`
+	// Played is set if they were in the queue when it filled.
+	Played bool `json:"played,omitempty"`
+	// Flaked is set if they left after the queue filled.
+	Flaked bool `json:"flaked,omitempty"`
+}
+
+// queueRecord is a finished queue.
+type queueRecord struct {
+	GuildID      string
+	Name         string
+	Game         string
+	Size         int
+	OpenedBy     string
+	OpenedAt     time.Time
+	ClosedAt     time.Time
+	CloseReason  string
+	Counts       queueCounts
+	Participants []*participant
+}
+
+// historyStore keeps a log of finished queues in SQLite or Postgres.
+type historyStore struct {
+	db      *sql.DB
+	dialect historyDialect
+	cache   *historyCache
+
+	// The statements run for every closed queue or command are prepared
+	// once.
+	insertQueue       *sql.Stmt
+	insertParticipant *sql.Stmt
+	recentQueues      *sql.Stmt
+	queuePlayers      *sql.Stmt
+	leaderboardTop    *sql.Stmt
+	fillAverage       *sql.Stmt
+	gamesTop          *sql.Stmt
+	playerTotal       *sql.Stmt
+
+	// writes are run one at a time by runWrites, see enqueue, and done is
+	// closed once it has run them all
+	writes chan func()
+	done   chan struct{}
+}
+
+// historyWriteBacklog is how many writes can wait for the writer before
+// enqueue blocks.
+const historyWriteBacklog = 64
+
+// openConfiguredHistory opens the history in Postgres if HistoryDSN is set,
+// or in SQLite at HistoryPath. It returns nil if both are empty.
+func openConfiguredHistory() (*historyStore, error) {
+	switch {
+	case HistoryDSN != "":
+		return openHistoryStore(postgresHistory, HistoryDSN)
+	case HistoryPath != "":
+		return openHistoryStore(sqliteHistory, HistoryPath)
+	}
+	return nil, nil
+}
+
+func openHistoryStore(d historyDialect, dsn string) (*historyStore, error) {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d.pool(db)
+	if err := d.migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	h := &historyStore{
+		db:      db,
+		dialect: d,
+		cache:   newHistoryCache(),
+		writes:  make(chan func(), historyWriteBacklog),
+		done:    make(chan struct{}),
+	}
+	go h.runWrites()
+	for _, p := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&h.insertQueue, `INSERT INTO queues (guild_id, name, game, size, opened_by, opened_at, filled_at, closed_at, close_reason, peak, joins, leaves)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`},
+		{&h.insertParticipant, `INSERT INTO participants (queue_id, user_id, username, joined_at, played, flaked) VALUES (?, ?, ?, ?, ?, ?)`},
+		{&h.recentQueues, `SELECT id, name, game, size, opened_by, opened_at, filled_at, closed_at, close_reason, peak, joins, leaves
+			FROM queues WHERE guild_id = ? AND deleted_at IS NULL ORDER BY closed_at DESC, id DESC LIMIT ?`},
+		{&h.queuePlayers, `SELECT user_id, username, joined_at FROM participants WHERE queue_id = ? AND played = 1 ORDER BY joined_at`},
+		{&h.leaderboardTop, `SELECT user_id, SUM(played), COUNT(*), SUM(flaked) FROM participants
+			JOIN queues ON queues.id = participants.queue_id WHERE queues.guild_id = ? AND queues.deleted_at IS NULL
+			GROUP BY user_id ORDER BY SUM(played) DESC, COUNT(*) DESC LIMIT ?`},
+		{&h.fillAverage, `SELECT AVG(filled_at - opened_at), COUNT(*) FROM queues WHERE guild_id = ? AND filled_at IS NOT NULL AND deleted_at IS NULL`},
+		{&h.gamesTop, `SELECT game, COUNT(*) FROM queues WHERE guild_id = ? AND game != '' AND filled_at IS NOT NULL AND deleted_at IS NULL
+			GROUP BY game ORDER BY COUNT(*) DESC, game LIMIT ?`},
+		{&h.playerTotal, `SELECT COALESCE(SUM(played), 0), COALESCE(SUM(flaked), 0) FROM participants
+			JOIN queues ON queues.id = participants.queue_id WHERE participants.user_id = ? AND queues.deleted_at IS NULL`},
+	} {
+		if *p.stmt, err = db.Prepare(d.rebind(p.query)); err != nil {
+			h.close()
+			return nil, fmt.Errorf("preparing history statement: %w", err)
+		}
+	}
+	return h, nil
+}
+
+// claimUnowned gives queues recorded before the history kept guilds to
+// guildID.
+func (h *historyStore) claimUnowned(guildID string) error {
+	_, err := h.db.Exec(h.dialect.rebind(`UPDATE queues SET guild_id = ? WHERE guild_id = ''`), guildID)
+	return err
+}
+
+// enqueue runs write after the writes enqueued before it, without waiting
+// for it. Closes record their queue and the purge job runs while holding
+// the guild lock, which a slow database shouldn't hold up.
+func (h *historyStore) enqueue(write func()) {
+	h.writes <- write
+}
+
+func (h *historyStore) runWrites() {
+	defer close(h.done)
+	for write := range h.writes {
+		write()
+	}
+}
+
+// close waits for the enqueued writes before closing the database.
+func (h *historyStore) close() error {
+	close(h.writes)
+	<-h.done
+	for _, stmt := range []*sql.Stmt{h.insertQueue, h.insertParticipant, h.recentQueues, h.queuePlayers, h.leaderboardTop, h.fillAverage, h.gamesTop, h.playerTotal} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	return h.db.Close()
+}
+
+func unixOrNull(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Unix()
+}
+
+func (h *historyStore) record(r queueRecord) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.Stmt(h.insertQueue).QueryRow(
+		r.GuildID, r.Name, r.Game, r.Size, r.OpenedBy, r.OpenedAt.Unix(), unixOrNull(r.Counts.FilledAt), r.ClosedAt.Unix(), r.CloseReason,
+		r.Counts.Peak, r.Counts.Joins, r.Counts.Leaves).Scan(&id); err != nil {
+		return err
+	}
+	insertParticipant := tx.Stmt(h.insertParticipant)
+	for _, p := range r.Participants {
+		if _, err := insertParticipant.Exec(id, p.ID, p.Username, p.JoinedAt.Unix(), boolInt(p.Played), boolInt(p.Flaked)); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	h.cache.invalidate()
+	return nil
+}
+
+// queryRecent returns the guild's last n finished queues, newest first, with
+// only the players who played listed as participants.
+func (h *historyStore) queryRecent(guildID string, n int) ([]queueRecord, error) {
+	rows, err := h.recentQueues.Query(guildID, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		ids     []int64
+		records []queueRecord
+	)
+	for rows.Next() {
+		var (
+			id                 int64
+			r                  = queueRecord{GuildID: guildID}
+			openedAt, closedAt int64
+			filledAt           sql.NullInt64
+		)
+		if err := rows.Scan(&id, &r.Name, &r.Game, &r.Size, &r.OpenedBy, &openedAt, &filledAt, &closedAt, &r.CloseReason,
+			&r.Counts.Peak, &r.Counts.Joins, &r.Counts.Leaves); err != nil {
+			return nil, err
+		}
+		r.OpenedAt = time.Unix(openedAt, 0)
+		r.ClosedAt = time.Unix(closedAt, 0)
+		if filledAt.Valid {
+			r.Counts.FilledAt = time.Unix(filledAt.Int64, 0)
+		}
+		ids = append(ids, id)
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for idx, id := range ids {
+		players, err := h.queuePlayers.Query(id)
+		if err != nil {
+			return nil, err
+		}
+		for players.Next() {
+			p := &participant{User: &discordgo.User{}, Played: true}
+			var joinedAt int64
+			if err := players.Scan(&p.ID, &p.Username, &joinedAt); err != nil {
+				players.Close()
+				return nil, err
+			}
+			p.JoinedAt = time.Unix(joinedAt, 0)
+			records[idx].Participants = append(records[idx].Participants, p)
+		}
+		players.Close()
+		if err := players.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// leaderboardRow is a player's totals across a guild's history.
+type leaderboardRow struct {
+	UserID string
+	Played int
+	Queued int
+	Flaked int
+}
+
+// queryLeaderboard returns the n players who played the most games in the
+// guild.
+func (h *historyStore) queryLeaderboard(guildID string, n int) ([]leaderboardRow, error) {
+	rows, err := h.leaderboardTop.Query(guildID, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var board []leaderboardRow
+	for rows.Next() {
+		var r leaderboardRow
+		if err := rows.Scan(&r.UserID, &r.Played, &r.Queued, &r.Flaked); err != nil {
+			return nil, err
+		}
+		board = append(board, r)
+	}
+	return board, rows.Err()
+}
+
+// gameRow is how many of a guild's queues for a game filled.
+type gameRow struct {
+	Game   string
+	Played int
+}
+
+// queryGames returns the n games whose queues filled most often in the
+// guild.
+func (h *historyStore) queryGames(guildID string, n int) ([]gameRow, error) {
+	rows, err := h.gamesTop.Query(guildID, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var games []gameRow
+	for rows.Next() {
+		var r gameRow
+		if err := rows.Scan(&r.Game, &r.Played); err != nil {
+			return nil, err
+		}
+		games = append(games, r)
+	}
+	return games, rows.Err()
+}
+
+// playerTotals returns how many queues the user played in every guild, and
+// how many of those they left after they filled.
+func (h *historyStore) playerTotals(userID string) (played, flaked int, err error) {
+	err = h.playerTotal.QueryRow(userID).Scan(&played, &flaked)
+	return played, flaked, err
+}
+
+// guildQueueCounts are how many queues a guild opened and filled.
+type guildQueueCounts struct {
+	Opened int
+	Filled int
+}
+
+// queryGuildCounts returns how many queues each guild opened and filled
+// that closed since since. It's only for the owner's stats, so it isn't
+// prepared or cached.
+func (h *historyStore) queryGuildCounts(since time.Time) (map[string]guildQueueCounts, error) {
+	rows, err := h.db.Query(h.dialect.rebind(`SELECT guild_id, COUNT(*), COUNT(filled_at) FROM queues
+		WHERE closed_at >= ? AND deleted_at IS NULL GROUP BY guild_id`), since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]guildQueueCounts)
+	for rows.Next() {
+		var (
+			guildID string
+			c       guildQueueCounts
+		)
+		if err := rows.Scan(&guildID, &c.Opened, &c.Filled); err != nil {
+			return nil, err
+		}
+		counts[guildID] = c
+	}
+	return counts, rows.Err()
+}
+
+// queryAverageFill returns how long the guild's queues that filled took on
+// average, and how many filled.
+func (h *historyStore) queryAverageFill(guildID string) (time.Duration, int, error) {
+	var (
+		avg    sql.NullFloat64
+		filled int
+	)
+	err := h.fillAverage.QueryRow(guildID).Scan(&avg, &filled)
+	return time.Duration(avg.Float64 * float64(time.Second)), filled, err
+}
+
+// purge soft-deletes the guild's queues that closed before cutoff, and
+// deletes its queues that were soft-deleted before graceCutoff for good. It
+// returns how many queues it soft-deleted and deleted.
+func (h *historyStore) purge(guildID string, cutoff, graceCutoff time.Time) (int64, int64, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(h.dialect.rebind(`UPDATE queues SET deleted_at = ? WHERE guild_id = ? AND deleted_at IS NULL AND closed_at < ?`),
+		time.Now().Unix(), guildID, cutoff.Unix())
+	if err != nil {
+		return 0, 0, err
+	}
+	softDeleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := tx.Exec(h.dialect.rebind(`DELETE FROM participants WHERE queue_id IN (SELECT id FROM queues WHERE guild_id = ? AND deleted_at < ?)`),
+		guildID, graceCutoff.Unix()); err != nil {
+		return 0, 0, err
+	}
+	res, err = tx.Exec(h.dialect.rebind(`DELETE FROM queues WHERE guild_id = ? AND deleted_at < ?`), guildID, graceCutoff.Unix())
+	if err != nil {
+		return 0, 0, err
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	h.cache.invalidate()
+	return softDeleted, deleted, nil
+}
+
+// scheduleHistoryPurgeLocked makes sure the purge job is scheduled if the
+// history has a retention period.
+// lock must be held
+func (q *queueState) scheduleHistoryPurgeLocked() {
+	if q.history == nil || current(&HistoryRetention) == 0 {
+		q.scheduler.cancelLocked(jobHistoryPurge)
+		return
+	}
+	if _, ok := q.scheduler.jobs[jobHistoryPurge]; !ok {
+		q.scheduler.scheduleLocked(jobHistoryPurge, jobHistoryPurge, time.Now())
+	}
+}
+
+// runHistoryPurgeJobLocked drops queues older than HistoryRetention from the
+// history and schedules the next purge. The purge is handed to the history
+// writer, so a large table doesn't hold up the guild.
+// lock must be held
+func (q *queueState) runHistoryPurgeJobLocked(s *discordgo.Session, j *job) {
+	retention := current(&HistoryRetention)
+	if q.history == nil || retention == 0 {
+		return
+	}
+	now := time.Now()
+	history, guildID := q.history, q.guildID
+	history.enqueue(func() {
+		softDeleted, deleted, err := history.purge(guildID, now.Add(-retention), now.Add(-historyPurgeGrace))
+		if err != nil {
+			log.Printf("error purging queue history: %v\n", err)
+		} else if softDeleted > 0 || deleted > 0 {
+			log.Printf("purged queue history: %d expired, %d deleted\n", softDeleted, deleted)
+		}
+	})
+	q.scheduler.scheduleLocked(jobHistoryPurge, jobHistoryPurge, now.Add(historyPurgeInterval))
+}
+
+// markFlakeLocked records that the user left the selected queue after it
+// filled.
+// lock must be held
+func (q *queueState) markFlakeLocked(userID string) {
+	if q.notifyMsgID == "" || !q.inMainQueueLocked(userID) {
+		return
+	}
+	if p, ok := q.participants[userID]; ok {
+		p.Flaked = true
+	}
+}
+
+// addParticipantLocked remembers that user took part in the queue.
+// lock must be held
+func (q *queueState) addParticipantLocked(user *discordgo.User) {
+	if _, ok := q.participants[user.ID]; ok {
+		return
+	}
+	q.participants[user.ID] = &participant{User: user, JoinedAt: time.Now()}
+}
+
+// recordHistoryLocked writes the closing queue to the history store in the
+// background.
+// lock must be held
+func (q *queueState) recordHistoryLocked(reason string) {
+	if q.history == nil || q.openedBy == nil {
+		return
+	}
+	r := queueRecord{
+		GuildID:     q.guildID,
+		Name:        q.name,
+		Game:        q.game,
+		Size:        q.size,
+		OpenedBy:    q.openedBy.ID,
+		OpenedAt:    q.openedAt,
+		ClosedAt:    time.Now(),
+		CloseReason: reason,
+		Counts:      q.counts,
+	}
+	for _, p := range q.participants {
+		r.Participants = append(r.Participants, p)
+	}
+	history, linked := q.history, q.linkedRoles
+	history.enqueue(func() {
+		if err := history.record(r); err != nil {
+			log.Printf("error recording queue history: %v\n", err)
+			return
+		}
+		// The role connections are worked out from the history, so they're
+		// only pushed once it's recorded.
+		if linked == nil {
+			return
+		}
+		for _, p := range r.Participants {
+			if err := linked.push(p.ID); err != nil {
+				log.Printf("error updating role connection for %s: %v\n", p.ID, err)
+			}
+		}
+	})
+}
+
+var historyCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-history",
+	Description: "Show the last few queues",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "count",
+			Description: "How many queues to show, 5 by default",
+			MinValue:    ptr(1.0),
+			MaxValue:    15,
+		},
+	},
+}
+
+func (q *queueState) handleHistory(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if q.history == nil {
+		respondEphemeral(s, i, "Queue history isn't enabled.")
+		return
+	}
+	n := 5
+	if opt, ok := optionMap(i.ApplicationCommandData().Options)["count"]; ok {
+		n = int(opt.IntValue())
+	}
+	records, err := q.history.recent(q.guildID, n)
+	if err != nil {
+		log.Printf("interaction %s: error reading queue history: %v\n", interactionRef(i), err)
+		respondError(s, i, "Couldn't read the queue history, try again.")
+		return
+	}
+	if len(records) == 0 {
+		respondEphemeral(s, i, "No queues have finished yet.")
+		return
+	}
+
+	var sb strings.Builder
+	for _, r := range records {
+		name := r.Name
+		// Queues opened per channel are recorded by the channel's ID.
+		if channelID, ok := strings.CutPrefix(name, channelQueuePrefix); ok {
+			name = "<#" + channelID + ">"
+		}
+		sb.WriteString(fmt.Sprintf("**%s** opened by <@%s> <t:%d:R>\n", stackTitle(name, r.Game, r.Size), r.OpenedBy, r.OpenedAt.Unix()))
+		if r.Counts.FilledAt.IsZero() {
+			sb.WriteString(fmt.Sprintf("-# Didn't fill, peaked at %d/%d. %s after %s.\n", r.Counts.Peak, r.Size, r.CloseReason, humanDuration(r.ClosedAt.Sub(r.OpenedAt))))
+			continue
+		}
+		mentions := make([]string, len(r.Participants))
+		for idx, p := range r.Participants {
+			mentions[idx] = fmt.Sprintf("<@%s>", p.ID)
+		}
+		sb.WriteString(fmt.Sprintf("-# Filled in %s: %s\n", humanDuration(r.Counts.FilledAt.Sub(r.OpenedAt)), strings.Join(mentions, ", ")))
+	}
+	respondEphemeral(s, i, sb.String())
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// historyCacheTTL bounds how stale a cached history read can be. Writes from
+// this bot invalidate the cache right away, so this only matters for
+// another instance sharing a Postgres history.
+const historyCacheTTL = time.Minute
+
+// historyCacheSize bounds how many results are cached. Keys carry the guild,
+// so with many guilds the least recently read are evicted.
+const historyCacheSize = 512
+
+// historyCache holds history query results until the next write, evicting
+// the least recently used past historyCacheSize.
+type historyCache struct {
+	sync.Mutex
+	entries map[string]*list.Element
+	// lru has the most recently used entry at the front.
+	lru *list.List
+	// gen is bumped by every invalidate, so a load that started before a
+	// write doesn't cache what it read.
+	gen uint64
+}
+
+type historyCacheEntry struct {
+	key   string
+	at    time.Time
+	value any
+}
+
+func newHistoryCache() *historyCache {
+	return &historyCache{entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// invalidate drops everything, called after every write.
+func (c *historyCache) invalidate() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.gen++
+}
+
+// get returns the entry for key if there is one, and the generation to
+// store a fresh load under.
+func (c *historyCache) get(key string) (*historyCacheEntry, uint64) {
+	c.Lock()
+	defer c.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, c.gen
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*historyCacheEntry), c.gen
+}
+
+// put caches value for key, unless the cache was invalidated since gen.
+func (c *historyCache) put(key string, value any, gen uint64) {
+	c.Lock()
+	defer c.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	e := &historyCacheEntry{key: key, at: time.Now(), value: value}
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > historyCacheSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*historyCacheEntry).key)
+	}
+}
+
+// cachedRead returns the cached result for key, or runs load and caches
+// what it returns. Errors aren't cached.
+func cachedRead[T any](c *historyCache, key string, load func() (T, error)) (T, error) {
+	e, gen := c.get(key)
+	if e != nil && time.Since(e.at) < historyCacheTTL {
+		return e.value.(T), nil
+	}
+
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+	c.put(key, v, gen)
+	return v, nil
+}
+
+// fillAverage is the result of averageFill.
+type fillAverage struct {
+	avg    time.Duration
+	filled int
+}
+
+// recent is queryRecent through the cache.
+func (h *historyStore) recent(guildID string, n int) ([]queueRecord, error) {
+	return cachedRead(h.cache, fmt.Sprintf("recent:%s:%d", guildID, n), func() ([]queueRecord, error) {
+		return h.queryRecent(guildID, n)
+	})
+}
+
+// leaderboard is queryLeaderboard through the cache.
+func (h *historyStore) leaderboard(guildID string, n int) ([]leaderboardRow, error) {
+	return cachedRead(h.cache, fmt.Sprintf("leaderboard:%s:%d", guildID, n), func() ([]leaderboardRow, error) {
+		return h.queryLeaderboard(guildID, n)
+	})
+}
+
+// games is queryGames through the cache.
+func (h *historyStore) games(guildID string, n int) ([]gameRow, error) {
+	return cachedRead(h.cache, fmt.Sprintf("games:%s:%d", guildID, n), func() ([]gameRow, error) {
+		return h.queryGames(guildID, n)
+	})
+}
+
+// averageFill is queryAverageFill through the cache.
+func (h *historyStore) averageFill(guildID string) (time.Duration, int, error) {
+	f, err := cachedRead(h.cache, "average_fill:"+guildID, func() (fillAverage, error) {
+		avg, filled, err := h.queryAverageFill(guildID)
+		return fillAverage{avg, filled}, err
+	})
+	return f.avg, f.filled, err
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// historyMaxConns bounds the Postgres connection pool. SQLite allows a
+// single writer, so it only ever gets one connection.
+const historyMaxConns = 8
+
+// historyDialect covers what differs between the databases the history can
+// be stored in. Queries are written with ? placeholders and rebound.
+type historyDialect struct {
+	driver string
+	// migrations create and update the schema. Each runs once, so only ever
+	// append to the list.
+	migrations []string
+	// numbered uses $1, $2... placeholders instead of ?.
+	numbered bool
+	// schemaVersion returns how many migrations have run.
+	schemaVersion func(db *sql.DB) (int, error)
+	// setSchemaVersion records that version migrations have run.
+	setSchemaVersion func(tx *sql.Tx, version int) error
+	// pool sets up the connection pool.
+	pool func(db *sql.DB)
+}
+
+// sqliteHistory stores the history in a file at HistoryPath, tracking the
+// schema with SQLite's user_version.
+var sqliteHistory = historyDialect{
+	driver: "sqlite",
+	migrations: []string{
+		`CREATE TABLE queues (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			opened_by TEXT NOT NULL,
+			opened_at INTEGER NOT NULL,
+			filled_at INTEGER,
+			closed_at INTEGER NOT NULL,
+			close_reason TEXT NOT NULL,
+			peak INTEGER NOT NULL,
+			joins INTEGER NOT NULL,
+			leaves INTEGER NOT NULL
+		);
+		CREATE TABLE participants (
+			queue_id INTEGER NOT NULL REFERENCES queues(id),
+			user_id TEXT NOT NULL,
+			username TEXT NOT NULL,
+			joined_at INTEGER NOT NULL,
+			played INTEGER NOT NULL
+		);
+		CREATE INDEX participants_user ON participants(user_id);`,
+		`ALTER TABLE participants ADD COLUMN flaked INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE queues ADD COLUMN deleted_at INTEGER;
+		CREATE INDEX queues_closed_at ON queues(closed_at);`,
+		`ALTER TABLE queues ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+		CREATE INDEX queues_guild ON queues(guild_id, closed_at);`,
+		`ALTER TABLE queues ADD COLUMN game TEXT NOT NULL DEFAULT '';`,
+	},
+	schemaVersion: func(db *sql.DB) (int, error) {
+		var version int
+		err := db.QueryRow("PRAGMA user_version").Scan(&version)
+		return version, err
+	},
+	setSchemaVersion: func(tx *sql.Tx, version int) error {
+		_, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version))
+		return err
+	},
+	pool: func(db *sql.DB) {
+		db.SetMaxOpenConns(1)
+	},
+}
+
+// postgresHistory stores the history in the Postgres database at HistoryDSN,
+// tracking the schema in a schema_version table.
+var postgresHistory = historyDialect{
+	driver:   "pgx",
+	numbered: true,
+	migrations: []string{
+		`CREATE TABLE queues (
+			id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			name TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			opened_by TEXT NOT NULL,
+			opened_at BIGINT NOT NULL,
+			filled_at BIGINT,
+			closed_at BIGINT NOT NULL,
+			close_reason TEXT NOT NULL,
+			peak INTEGER NOT NULL,
+			joins INTEGER NOT NULL,
+			leaves INTEGER NOT NULL,
+			deleted_at BIGINT
+		);
+		CREATE INDEX queues_closed_at ON queues(closed_at);
+		CREATE TABLE participants (
+			queue_id BIGINT NOT NULL REFERENCES queues(id),
+			user_id TEXT NOT NULL,
+			username TEXT NOT NULL,
+			joined_at BIGINT NOT NULL,
+			played INTEGER NOT NULL,
+			flaked INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX participants_user ON participants(user_id);
+		CREATE INDEX participants_queue ON participants(queue_id);`,
+		`ALTER TABLE queues ADD COLUMN guild_id TEXT NOT NULL DEFAULT '';
+		CREATE INDEX queues_guild ON queues(guild_id, closed_at);`,
+		`ALTER TABLE queues ADD COLUMN game TEXT NOT NULL DEFAULT '';`,
+	},
+	schemaVersion: func(db *sql.DB) (int, error) {
+		if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+			return 0, err
+		}
+		var version int
+		err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+		return version, err
+	},
+	setSchemaVersion: func(tx *sql.Tx, version int) error {
+		_, err := tx.Exec(`INSERT INTO schema_version (version) VALUES ($1)`, version)
+		return err
+	},
+	pool: func(db *sql.DB) {
+		db.SetMaxOpenConns(historyMaxConns)
+		db.SetMaxIdleConns(historyMaxConns / 2)
+		db.SetConnMaxIdleTime(5 * time.Minute)
+	},
+}
+
+// rebind rewrites the ? placeholders in query for the dialect.
+func (d historyDialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var (
+		sb strings.Builder
+		n  int
+	)
+	for _, r := range query {
+		if r != '?' {
+			sb.WriteRune(r)
+			continue
+		}
+		n++
+		fmt.Fprintf(&sb, "$%d", n)
+	}
+	return sb.String()
+}
+
+// migrate brings the schema up to date, each migration in its own
+// transaction.
+func (d historyDialect) migrate(db *sql.DB) error {
+	version, err := d.schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	for ; version < len(d.migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(d.migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrating history to version %d: %w", version+1, err)
+		}
+		if err := d.setSchemaVersion(tx, version+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boolInt stores b in an INTEGER column, which Postgres won't do for bools.
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
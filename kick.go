@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var kickCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-kick",
+	Description: "Admin command to remove a member from the queue or waitlist",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionUser,
+			Name:        "user",
+			Description: "Member to remove",
+			Required:    true,
+		},
+		queueNameOption("Queue to remove them from; defaults to the one they're in"),
+	},
+}
+
+func (q *queueState) handleKick(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !q.configs.get(q.guildID).isAdmin(i.Member) {
+		respondEphemeral(s, i, "Only admins can use this command.")
+		return
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	data := i.ApplicationCommandData()
+	user := resolvedUser(data, data.Options[0])
+	opts := optionMap(data.Options)
+	if _, ok := opts["name"]; ok {
+		q.selectQueueLocked(q.commandQueueLocked(i.ChannelID, data.Options))
+	} else {
+		for _, qu := range q.openQueuesLocked() {
+			q.selectQueueLocked(qu)
+			if q.isQueuedLocked(user.ID) {
+				break
+			}
+		}
+	}
+	if q.currentMsgID == "" || !q.isQueuedLocked(user.ID) {
+		respondEphemeral(s, i, fmt.Sprintf("<@%s> isn't in the queue.", user.ID))
+		return
+	}
+
+	q.kickLocked(user)
+	log.Printf("%s (%s) kicked %s (%s) from queue %s\n", i.Member.User.Username, i.Member.User.ID, user.Username, user.ID, q.currentMsgID)
+	respondEphemeral(s, i, fmt.Sprintf("Removed <@%s> from the queue.", user.ID))
+	q.refreshLocked(s)
+}
+
+// kickLocked removes user from the selected queue or its waitlist and
+// promotes whoever's next. The caller refreshes the queue message.
+// lock must be held
+func (q *queueState) kickLocked(user *discordgo.User) {
+	q.removeConditionalLocked(user.ID)
+	q.recordActionLocked("leave", user)
+	q.recordWaitLocked(q.queuedMemberLocked(user.ID))
+	delete(q.ready, user.ID)
+	q.recordWaitlistExitLocked(user.ID, waitlistKicked)
+	q.removeUserLocked(user.ID)
+	q.promoteLocked()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// lastCallWindow is how long a last call gives the queue to fill.
+const lastCallWindow = 10 * time.Minute
+
+// jobLastCall closes the queue if it didn't fill during its last call.
+const jobLastCall = "last_call"
+
+func lastCallJobKey(name string) string {
+	return jobLastCall + ":" + name
+}
+
+// canManageLocked reports whether the member opened the selected queue or is
+// an admin.
+// lock must be held
+func (q *queueState) canManageLocked(m *discordgo.Member) bool {
+	return q.openedBy != nil && q.openedBy.ID == m.User.ID || q.configs.get(q.guildID).isAdmin(m)
+}
+
+// handleLastCall starts a last call: the queue closes after lastCallWindow
+// unless it fills first, and a final ping goes out.
+func (q *queueState) handleLastCall(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	switch {
+	case !q.canManageLocked(i.Member):
+		respondEphemeral(s, i, "Only whoever opened the queue or an admin can start a last call.")
+		return
+	case q.currentMsgID == "":
+		respondEphemeral(s, i, "The queue is closed.")
+		return
+	case len(q.users) >= q.size:
+		respondEphemeral(s, i, "The queue is already full.")
+		return
+	case !q.lastCallUntil.IsZero():
+		respondEphemeral(s, i, fmt.Sprintf("Last call is already running, the queue closes <t:%d:R>.", q.lastCallUntil.Unix()))
+		return
+	}
+
+	q.lastCallUntil = time.Now().Add(lastCallWindow)
+	q.scheduler.scheduleLocked(jobLastCall, lastCallJobKey(q.name), q.lastCallUntil, q.name)
+	missing := q.size - len(q.users)
+	msg := &discordgo.MessageSend{
+		Content: fmt.Sprintf("⏰ Last call for %s! It closes <t:%d:R> unless %d more %s.",
+			q.titleLocked(), q.lastCallUntil.Unix(), missing, pluralize(missing, "joins", "join")),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+		Reference:       &discordgo.MessageReference{MessageID: q.currentMsgID, ChannelID: q.channelID},
+	}
+	if roleID := q.configs.get(q.guildID).PingRoleID; roleID != "" {
+		msg.Content = fmt.Sprintf("<@&%s> %s", roleID, msg.Content)
+		msg.AllowedMentions.Roles = []string{roleID}
+	}
+	if m, err := s.ChannelMessageSendComplex(q.channelID, msg); err != nil {
+		log.Printf("error sending last call: %v\n", err)
+	} else {
+		q.lastCallMsgID = m.ID
+	}
+	log.Printf("%s (%s) started a last call for queue %s\n", i.Member.User.Username, i.Member.User.ID, q.currentMsgID)
+	respondEphemeral(s, i, "Last call started.")
+	q.refreshLocked(s)
+}
+
+// endLastCallLocked stops the last call, e.g. because the queue filled.
+// lock must be held
+func (q *queueState) endLastCallLocked(s *discordgo.Session) {
+	if q.lastCallUntil.IsZero() {
+		return
+	}
+	q.lastCallUntil = time.Time{}
+	q.scheduler.cancelLocked(lastCallJobKey(q.name))
+	if q.lastCallMsgID != "" {
+		if err := s.ChannelMessageDelete(q.channelID, q.lastCallMsgID); err != nil {
+			log.Printf("error deleting last call: %v\n", err)
+		}
+	}
+	q.lastCallMsgID = ""
+}
+
+// runLastCallJobLocked closes the queue whose last call ran out.
+// lock must be held
+func (q *queueState) runLastCallJobLocked(s *discordgo.Session, j *job) {
+	q.selectQueueLocked(q.queueLocked(j.Args[0]))
+	if q.currentMsgID == "" || q.lastCallUntil.IsZero() {
+		return
+	}
+	if len(q.users) >= q.size {
+		q.endLastCallLocked(s)
+		return
+	}
+	log.Printf("queue %s didn't fill during its last call\n", q.currentMsgID)
+	q.closeQueueAsLocked(s, "Queue closed after a last call", waitlistClosed)
+}
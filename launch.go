@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// jobLaunch closes a full queue LaunchAfter after its fill notification.
+const jobLaunch = "launch"
+
+func launchJobKey(name string) string {
+	return jobLaunch + ":" + name
+}
+
+// launchCountdown is the line added to the fill notification for a queue
+// that closes at.
+func launchCountdown(at time.Time) string {
+	return fmt.Sprintf("The queue closes <t:%d:R>.", at.Unix())
+}
+
+// startLaunchCountdownLocked schedules the queue to close as launched at,
+// once its fill notification is sent.
+// lock must be held
+func (q *queueState) startLaunchCountdownLocked(at time.Time) {
+	q.scheduler.scheduleLocked(jobLaunch, launchJobKey(q.name), at, q.name, q.notifyMsgID)
+}
+
+// cancelLaunchCountdownLocked stops the countdown, e.g. when someone leaves
+// the full queue.
+// lock must be held
+func (q *queueState) cancelLaunchCountdownLocked() {
+	q.scheduler.cancelLocked(launchJobKey(q.name))
+}
+
+// runLaunchJobLocked closes the queue the job was scheduled for, if it's
+// still full from the same fill.
+// lock must be held
+func (q *queueState) runLaunchJobLocked(s *discordgo.Session, j *job) {
+	q.selectQueueLocked(q.queueLocked(j.Args[0]))
+	if q.currentMsgID == "" || q.notifyMsgID != j.Args[1] {
+		return
+	}
+	log.Printf("queue %s launched\n", q.currentMsgID)
+	q.closeQueueAsLocked(s, "Queue launched", waitlistClosed)
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// linkedRolePath is the linked roles verification URL to set in the
+	// developer portal, under PublicURL. Discord sends members there to
+	// authorize the bot, and back to linkedRoleCallbackPath after.
+	linkedRolePath         = "/linked-role"
+	linkedRoleCallbackPath = "/linked-role/callback"
+	linkedRoleStateCookie  = "linked_role_state"
+	linkedRoleScopes       = "role_connections.write identify"
+	linkedRoleTimeout      = 10 * time.Second
+
+	discordAuthorizeURL = "https://discord.com/oauth2/authorize"
+	discordTokenURL     = "https://discord.com/api/v10/oauth2/token"
+)
+
+// The role connection metadata keys, each an integer that server owners
+// can require a minimum of.
+const (
+	metadataGamesPlayed = "games_played"
+	metadataReputation  = "reputation"
+	metadataReliability = "reliability"
+)
+
+var roleConnectionMetadata = []*discordgo.ApplicationRoleConnectionMetadata{
+	{
+		Type:        discordgo.ApplicationRoleConnectionMetadataIntegerGreaterThanOrEqual,
+		Key:         metadataGamesPlayed,
+		Name:        "Games played",
+		Description: "Standby queues played in, at least",
+	},
+	{
+		Type:        discordgo.ApplicationRoleConnectionMetadataIntegerGreaterThanOrEqual,
+		Key:         metadataReputation,
+		Name:        "Reputation",
+		Description: "Session MVP votes won, at least",
+	},
+	{
+		Type:        discordgo.ApplicationRoleConnectionMetadataIntegerGreaterThanOrEqual,
+		Key:         metadataReliability,
+		Name:        "Reliability",
+		Description: "Percent of filled queues stayed in rather than left, at least",
+	},
+}
+
+// linkedRoleToken is a member's OAuth2 grant, kept to update their role
+// connection whenever their stats change.
+type linkedRoleToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// linkedRoles publishes members' stats as role connection metadata, so
+// servers can give roles to members with enough games, MVP votes or
+// reliability through Discord's linked roles. Members who authorized the bot
+// are kept in a JSON file. The stats are the same in every guild, since a
+// member has one role connection per app.
+type linkedRoles struct {
+	sync.Mutex
+
+	path    string
+	tokens  map[string]*linkedRoleToken
+	history *historyStore
+	guilds  *guildStates
+	client  *http.Client
+}
+
+// loadLinkedRoles returns nil, disabling linked roles, unless ClientSecret
+// and PublicURL are set.
+func loadLinkedRoles(path string, history *historyStore) (*linkedRoles, error) {
+	if ClientSecret == "" || PublicURL == "" {
+		return nil, nil
+	}
+	l := &linkedRoles{
+		path:    path,
+		tokens:  make(map[string]*linkedRoleToken),
+		history: history,
+		client:  &http.Client{Timeout: linkedRoleTimeout},
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &l.tokens); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// registerMetadata tells Discord which stats server owners can pick from.
+func (l *linkedRoles) registerMetadata(s *discordgo.Session) error {
+	_, err := s.ApplicationRoleConnectionMetadataUpdate(AppID, roleConnectionMetadata)
+	return err
+}
+
+func (l *linkedRoles) register(mux *http.ServeMux) {
+	mux.HandleFunc(linkedRolePath, l.handleLink)
+	mux.HandleFunc(linkedRoleCallbackPath, l.handleCallback)
+}
+
+func redirectURI() string {
+	return strings.TrimSuffix(PublicURL, "/") + linkedRoleCallbackPath
+}
+
+// handleLink sends the member on to authorize the bot, with a random state
+// in a cookie to check they're the one coming back.
+func (l *linkedRoles) handleLink(w http.ResponseWriter, r *http.Request) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	state := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     linkedRoleStateCookie,
+		Value:    state,
+		Path:     linkedRoleCallbackPath,
+		MaxAge:   int((5 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	v := url.Values{
+		"client_id":     {AppID},
+		"redirect_uri":  {redirectURI()},
+		"response_type": {"code"},
+		"scope":         {linkedRoleScopes},
+		"state":         {state},
+		"prompt":        {"consent"},
+	}
+	http.Redirect(w, r, discordAuthorizeURL+"?"+v.Encode(), http.StatusFound)
+}
+
+// handleCallback trades the code Discord sent the member back with for a
+// token, and publishes their stats with it.
+func (l *linkedRoles) handleCallback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(linkedRoleStateCookie)
+	state := r.URL.Query().Get("state")
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		http.Error(w, "This link expired, start again from Linked Roles in Discord.", http.StatusBadRequest)
+		return
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		http.Error(w, "Discord didn't authorize the bot, start again from Linked Roles in Discord.", http.StatusBadRequest)
+		return
+	}
+	tok, err := l.exchange(url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {redirectURI()},
+	})
+	if err != nil {
+		log.Printf("error exchanging linked role code: %v\n", err)
+		http.Error(w, "Couldn't reach Discord, try again in a bit.", http.StatusBadGateway)
+		return
+	}
+	user, err := l.session(tok).User("@me")
+	if err != nil {
+		log.Printf("error fetching linked role user: %v\n", err)
+		http.Error(w, "Couldn't reach Discord, try again in a bit.", http.StatusBadGateway)
+		return
+	}
+	if err := l.store(user.ID, tok); err != nil {
+		log.Printf("error saving linked role token: %v\n", err)
+	}
+	if err := l.push(user.ID); err != nil {
+		log.Printf("error updating role connection for %s: %v\n", user.ID, err)
+		http.Error(w, "Couldn't update your stats, try again in a bit.", http.StatusBadGateway)
+		return
+	}
+	fmt.Fprintln(w, "Your standby stats are linked. You can close this tab and go back to Discord.")
+}
+
+// exchange asks Discord for a token with the given grant.
+func (l *linkedRoles) exchange(grant url.Values) (*linkedRoleToken, error) {
+	grant.Set("client_id", AppID)
+	grant.Set("client_secret", ClientSecret)
+	resp, err := l.client.PostForm(discordTokenURL, grant)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request got status %d", resp.StatusCode)
+	}
+	var body struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return &linkedRoleToken{
+		AccessToken:  body.AccessToken,
+		RefreshToken: body.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(body.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// session calls the API as the member who granted tok.
+func (l *linkedRoles) session(tok *linkedRoleToken) *discordgo.Session {
+	s, _ := discordgo.New("Bearer " + tok.AccessToken)
+	s.Client = l.client
+	return s
+}
+
+// store saves the member's token, or forgets them if tok is nil.
+func (l *linkedRoles) store(userID string, tok *linkedRoleToken) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if tok == nil {
+		delete(l.tokens, userID)
+	} else {
+		l.tokens[userID] = tok
+	}
+	// The file holds members' OAuth tokens, so only the bot can read it.
+	return writeJSONFileMode(l.path, l.tokens, 0o600)
+}
+
+// token returns the member's token, refreshed if it expired, or nil if they
+// haven't linked their stats.
+func (l *linkedRoles) token(userID string) (*linkedRoleToken, error) {
+	l.Lock()
+	tok := l.tokens[userID]
+	l.Unlock()
+	if tok == nil || time.Now().Before(tok.Expiry.Add(-time.Minute)) {
+		return tok, nil
+	}
+	fresh, err := l.exchange(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tok.RefreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fresh, l.store(userID, fresh)
+}
+
+// metadata is the member's stats across every guild.
+func (l *linkedRoles) metadata(userID string) (map[string]string, error) {
+	played, flaked := 0, 0
+	if l.history != nil {
+		var err error
+		if played, flaked, err = l.history.playerTotals(userID); err != nil {
+			return nil, err
+		}
+	}
+	reliability := 0
+	if played > 0 {
+		reliability = 100 * (played - flaked) / played
+	}
+	return map[string]string{
+		metadataGamesPlayed: strconv.Itoa(played),
+		metadataReputation:  strconv.Itoa(l.guilds.mvpCount(userID)),
+		metadataReliability: strconv.Itoa(reliability),
+	}, nil
+}
+
+// push updates the member's role connection with their current stats, if
+// they linked them. Members who took the authorization back are forgotten.
+func (l *linkedRoles) push(userID string) error {
+	tok, err := l.token(userID)
+	if err != nil || tok == nil {
+		return err
+	}
+	meta, err := l.metadata(userID)
+	if err != nil {
+		return err
+	}
+	_, err = l.session(tok).UserApplicationRoleConnectionUpdate(AppID, &discordgo.ApplicationRoleConnection{
+		PlatformName: "Standby",
+		Metadata:     meta,
+	})
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusUnauthorized {
+		return l.store(userID, nil)
+	}
+	return err
+}
+
+// pushLinkedRolesLocked updates the members' role connections in the
+// background, after their stats changed.
+// lock must be held
+func (q *queueState) pushLinkedRolesLocked(userIDs ...string) {
+	if q.linkedRoles == nil {
+		return
+	}
+	go func() {
+		for _, id := range userIDs {
+			if err := q.linkedRoles.push(id); err != nil {
+				log.Printf("error updating role connection for %s: %v\n", id, err)
+			}
+		}
+	}()
+}
+
+// mvpCount is how many session MVP votes the member won in every guild.
+func (g *guildStates) mvpCount(userID string) int {
+	total := 0
+	for _, q := range g.all() {
+		q.Lock()
+		if ps, ok := q.stats[userID]; ok {
+			total += ps.MVPCount
+		}
+		q.Unlock()
+	}
+	return total
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// lobbyCodeButton is shown on the fill notification so the host can share
+// the lobby code with just the queued players.
+func lobbyCodeButton(name string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Share lobby code",
+				Style:    discordgo.SecondaryButton,
+				CustomID: queueCustomID("share_lobby_code", name),
+			},
+		}},
+	}
+}
+
+func (q *queueState) handleLobbyCodeButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	name := q.name
+	if !q.inMainQueueLocked(i.Member.User.ID) {
+		respondEphemeral(s, i, "Only players in the queue can share the lobby code.")
+		return
+	}
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID: queueCustomID("lobby_code", name),
+			Title:    "Share lobby code",
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.TextInput{
+						CustomID:  "code",
+						Label:     "Lobby code or invite",
+						Style:     discordgo.TextInputShort,
+						Required:  true,
+						MaxLength: 100,
+					},
+				}},
+			},
+		},
+	}); err != nil {
+		log.Printf("error responding with lobby code modal: %v\n", err)
+	}
+}
+
+// handleLobbyCode DMs the code to everyone in the queue instead of posting
+// it in the channel.
+func (q *queueState) handleLobbyCode(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	host := i.Member.User
+	if !q.inMainQueueLocked(host.ID) {
+		respondEphemeral(s, i, "You're no longer in the queue.")
+		return
+	}
+	code := strings.TrimSpace(modalValue(i.ModalSubmitData(), "code"))
+	content := fmt.Sprintf("<@%s> shared the lobby code: `%s`", host.ID, code)
+	sent := 0
+	for _, m := range q.users {
+		if err := q.notifyLocked(s, m.ID, notifyLobbyCode, content); err != nil {
+			continue
+		}
+		sent++
+	}
+	respondEphemeral(s, i, fmt.Sprintf("Sent the lobby code to %d of %d %s.", sent, len(q.users), pluralize(len(q.users), "player", "players")))
+}
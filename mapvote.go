@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// mapVoteDuration is how long queued players have to vote once the queue
+// fills.
+const mapVoteDuration = 2 * time.Minute
+
+// maxVoteOptions is how many options fit in a select menu.
+const maxVoteOptions = 25
+
+// mapVote is the vote on a map or mode for the queue that just filled.
+type mapVote struct {
+	msgID   string
+	options []string
+	players []string
+	// votes maps voter ID to the option they picked
+	votes  map[string]string
+	endsAt time.Time
+}
+
+func (v *mapVote) isPlayer(userID string) bool {
+	for _, id := range v.players {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// tally counts the votes per option, in the order of the options.
+func (v *mapVote) tally() []int {
+	counts := make([]int, len(v.options))
+	for _, choice := range v.votes {
+		for idx, option := range v.options {
+			if option == choice {
+				counts[idx]++
+			}
+		}
+	}
+	return counts
+}
+
+func (v *mapVote) String() string {
+	var sb strings.Builder
+	sb.WriteString("### Map vote\n")
+	counts := v.tally()
+	for idx, option := range v.options {
+		if counts[idx] > 0 {
+			sb.WriteString(fmt.Sprintf("%s: %d %s\n", option, counts[idx], pluralize(counts[idx], "vote", "votes")))
+		}
+	}
+	return sb.String()
+}
+
+// startMapVoteLocked posts a vote on the guild's vote options for the
+// players of the queue that just filled.
+// lock must be held
+func (q *queueState) startMapVoteLocked(s *discordgo.Session) {
+	options := q.configs.get(q.guildID).VoteOptions
+	if len(options) < 2 {
+		return
+	}
+	if q.mapVote != nil {
+		q.finishMapVoteLocked(s)
+	}
+
+	vote := &mapVote{
+		options: options,
+		votes:   make(map[string]string),
+		endsAt:  time.Now().Add(mapVoteDuration),
+	}
+	for _, m := range q.users {
+		vote.players = append(vote.players, m.ID)
+	}
+	menu := discordgo.SelectMenu{
+		MenuType:    discordgo.StringSelectMenu,
+		CustomID:    queueCustomID("map_vote", q.name),
+		Placeholder: "Vote for a map",
+	}
+	for _, option := range options {
+		menu.Options = append(menu.Options, discordgo.SelectMenuOption{Label: option, Value: option})
+	}
+	msg, err := s.ChannelMessageSendComplex(q.channelID, &discordgo.MessageSend{
+		Content:    fmt.Sprintf("%sPlayers, what do you want to play? Voting closes <t:%d:R>.", vote, vote.endsAt.Unix()),
+		Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{menu}}},
+	})
+	if err != nil {
+		log.Printf("error sending map vote: %v\n", err)
+		return
+	}
+	vote.msgID = msg.ID
+	q.mapVote = vote
+}
+
+// checkMapVoteLocked closes the vote once its time is up.
+// lock must be held
+func (q *queueState) checkMapVoteLocked(s *discordgo.Session) {
+	if q.mapVote != nil && time.Now().After(q.mapVote.endsAt) {
+		q.finishMapVoteLocked(s)
+	}
+}
+
+// finishMapVoteLocked announces the option with the most votes, picking at
+// random between ties, and removes the menu.
+// lock must be held
+func (q *queueState) finishMapVoteLocked(s *discordgo.Session) {
+	vote := q.mapVote
+	q.mapVote = nil
+
+	counts := vote.tally()
+	most := 0
+	for _, n := range counts {
+		most = max(most, n)
+	}
+	var tied []string
+	for idx, n := range counts {
+		if n == most {
+			tied = append(tied, vote.options[idx])
+		}
+	}
+
+	content := vote.String()
+	if most == 0 {
+		content += fmt.Sprintf("Nobody voted, so it's **%s**!", tied[rand.IntN(len(tied))])
+	} else if len(tied) > 1 {
+		content += fmt.Sprintf("It's a tie, so it's **%s**!", tied[rand.IntN(len(tied))])
+	} else {
+		content += fmt.Sprintf("**%s** wins!", tied[0])
+	}
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         vote.msgID,
+		Channel:    q.channelID,
+		Content:    &content,
+		Components: &[]discordgo.MessageComponent{},
+	}); err != nil {
+		log.Printf("error editing map vote: %v\n", err)
+	}
+}
+
+func (q *queueState) handleMapVote(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	voter := i.Member.User
+	values := i.MessageComponentData().Values
+	switch {
+	case q.mapVote == nil || q.mapVote.msgID != i.Message.ID:
+		respondEphemeral(s, i, "This vote has closed.")
+		return
+	case !q.mapVote.isPlayer(voter.ID):
+		respondEphemeral(s, i, "Only players in the queue can vote.")
+		return
+	case len(values) == 0:
+		return
+	}
+
+	q.mapVote.votes[voter.ID] = values[0]
+	if len(q.mapVote.votes) == len(q.mapVote.players) {
+		q.finishMapVoteLocked(s)
+		respondEphemeral(s, i, fmt.Sprintf("Voted for %s.", values[0]))
+		return
+	}
+	content := fmt.Sprintf("%sPlayers, what do you want to play? Voting closes <t:%d:R>.", q.mapVote, q.mapVote.endsAt.Unix())
+	if _, err := s.ChannelMessageEdit(q.channelID, q.mapVote.msgID, content); err != nil {
+		log.Printf("error updating map vote: %v\n", err)
+	}
+	respondEphemeral(s, i, fmt.Sprintf("Voted for %s. You can change your vote until it closes.", values[0]))
+}
+
+func (q *queueState) configVoteOptions(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	var options []string
+	if opt, ok := opts["options"]; ok {
+		options = splitList(opt.StringValue())
+	}
+	if len(options) > maxVoteOptions {
+		return fmt.Sprintf("There can be at most %d vote options.", maxVoteOptions), nil
+	}
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		cfg.VoteOptions = options
+	}); err != nil {
+		return "", err
+	}
+	if len(options) < 2 {
+		return "Map votes turned off.", nil
+	}
+	return fmt.Sprintf("Players will vote on %s once a queue fills.", strings.Join(options, ", ")), nil
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metric names are shared with the generated alerting rules and dashboard.
+const (
+	metricCommandDuration   = "command_duration_seconds"
+	metricQueueJoins        = "queue_joins_total"
+	metricQueueOpen         = "queue_open"
+	metricQueueUsers        = "queue_users"
+	metricQueueWaitlist     = "queue_waitlist_users"
+	metricQueueCapacity     = "queue_capacity"
+	metricNamedQueueOpen    = "named_queue_open"
+	metricNamedQueueUsers   = "named_queue_users"
+	metricNamedQueueCap     = "named_queue_capacity"
+	metricQueueLastActivity = "queue_last_activity_timestamp_seconds"
+	metricQueueTimeToFill   = "queue_time_to_fill_seconds"
+	metricQueuesOpened      = "queues_opened_total"
+	metricQueuesFilled      = "queues_filled_total"
+	metricQueuesClosed      = "queues_closed_total"
+	metricComponentClicks   = "component_clicks_total"
+	metricWaitlistExits     = "waitlist_exits_total"
+	metricWaitlistSkips     = "waitlist_skips_total"
+	metricGatewayConnected  = "discord_gateway_connected"
+	metricAPIErrors         = "discord_api_errors_total"
+	metricActionsLimited    = "queue_actions_rate_limited_total"
+	metricShadowRuns        = "algorithm_shadow_runs_total"
+	metricShadowDivergences = "algorithm_shadow_divergences_total"
+	metricTeamSkillGap      = "team_split_skill_gap"
+	metricAPIRetries        = "discord_api_retries_total"
+)
+
+var (
+	commandDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    metricCommandDuration,
+			Help:    "Duration of commands in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+	queueJoins = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metricQueueJoins,
+			Help: "Number of queue joins by entry point",
+		},
+		[]string{"source"},
+	)
+	// queueOpen, queueUsers and queueCapacity are the home guild's default
+	// queue, as they were before there was more than one. The named
+	// versions cover every queue.
+	queueOpen = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: metricQueueOpen,
+			Help: "Whether a queue is currently open",
+		},
+	)
+	queueUsers = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: metricQueueUsers,
+			Help: "Number of users in the queue, not counting the waitlist",
+		},
+	)
+	queueCapacity = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: metricQueueCapacity,
+			Help: "Number of users needed to fill the queue",
+		},
+	)
+	namedQueueOpen = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: metricNamedQueueOpen,
+			Help: "Whether a queue is currently open by guild and queue name",
+		},
+		[]string{"guild", "queue"},
+	)
+	namedQueueUsers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: metricNamedQueueUsers,
+			Help: "Number of users in the queue, not counting the waitlist by guild and queue name",
+		},
+		[]string{"guild", "queue"},
+	)
+	queueWaitlist = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: metricQueueWaitlist,
+			Help: "Number of users on the waitlist by guild and queue name",
+		},
+		[]string{"guild", "queue"},
+	)
+	namedQueueCapacity = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: metricNamedQueueCap,
+			Help: "Number of users needed to fill the queue by guild and queue name",
+		},
+		[]string{"guild", "queue"},
+	)
+	queueLastActivity = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: metricQueueLastActivity,
+			Help: "Unix time of the last join, leave or open",
+		},
+	)
+	queueTimeToFill = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    metricQueueTimeToFill,
+			Help:    "Time from opening a queue until it fills in seconds",
+			Buckets: []float64{60, 300, 600, 1200, 1800, 3600, 7200, 14400},
+		},
+	)
+	queuesOpened = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metricQueuesOpened,
+			Help: "Number of queues opened by guild",
+		},
+		[]string{"guild"},
+	)
+	queuesFilled = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metricQueuesFilled,
+			Help: "Number of queues that filled by guild",
+		},
+		[]string{"guild"},
+	)
+	queuesClosed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metricQueuesClosed,
+			Help: "Number of queues closed by guild",
+		},
+		[]string{"guild"},
+	)
+	componentClicks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metricComponentClicks,
+			Help: "Number of button and select menu clicks by custom ID namespace",
+		},
+		[]string{"component"},
+	)
+	waitlistExits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metricWaitlistExits,
+			Help: "Number of members who left a waitlist by guild and outcome: promoted, left, kicked, closed or expired",
+		},
+		[]string{"guild", "outcome"},
+	)
+	waitlistSkips = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metricWaitlistSkips,
+			Help: "Number of times a waitlisted member was passed over for someone behind them by guild",
+		},
+		[]string{"guild"},
+	)
+	gatewayConnected = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: metricGatewayConnected,
+			Help: "Whether the Discord gateway connection is up",
+		},
+	)
+	apiErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metricAPIErrors,
+			Help: "Number of failed Discord API requests by reason",
+		},
+		[]string{"reason"},
+	)
+	apiRetried = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: metricAPIRetries,
+			Help: "Number of failed Discord API requests that were retried",
+		},
+	)
+	actionsLimited = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: metricActionsLimited,
+			Help: "Number of queue button clicks turned away for coming too fast",
+		},
+	)
+	shadowRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metricShadowRuns,
+			Help: "Number of times an algorithm ran in shadow by kind and algorithm",
+		},
+		[]string{"kind", "algorithm"},
+	)
+	shadowDivergences = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metricShadowDivergences,
+			Help: "Number of shadow runs that differed from the live algorithm by kind and algorithm",
+		},
+		[]string{"kind", "algorithm"},
+	)
+	teamSkillGap = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    metricTeamSkillGap,
+			Help:    "Difference between the teams' total skill when splitting by balancer",
+			Buckets: []float64{0, 1, 2, 3, 5, 8, 13},
+		},
+		[]string{"algorithm"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(commandDuration)
+	prometheus.MustRegister(queueJoins)
+	prometheus.MustRegister(queueOpen)
+	prometheus.MustRegister(queueUsers)
+	prometheus.MustRegister(queueWaitlist)
+	prometheus.MustRegister(queueCapacity)
+	prometheus.MustRegister(namedQueueOpen)
+	prometheus.MustRegister(namedQueueUsers)
+	prometheus.MustRegister(namedQueueCapacity)
+	prometheus.MustRegister(queueLastActivity)
+	prometheus.MustRegister(queueTimeToFill)
+	prometheus.MustRegister(queuesOpened)
+	prometheus.MustRegister(queuesFilled)
+	prometheus.MustRegister(queuesClosed)
+	prometheus.MustRegister(componentClicks)
+	prometheus.MustRegister(waitlistExits)
+	prometheus.MustRegister(waitlistSkips)
+	prometheus.MustRegister(gatewayConnected)
+	prometheus.MustRegister(apiErrors)
+	prometheus.MustRegister(apiRetried)
+	prometheus.MustRegister(actionsLimited)
+	prometheus.MustRegister(shadowRuns)
+	prometheus.MustRegister(shadowDivergences)
+	prometheus.MustRegister(teamSkillGap)
+}
+
+// lock must be held
+func (q *queueState) updateMetricsLocked() {
+	for name, qu := range q.queues {
+		label := queueLabel(name)
+		open := 0
+		if qu.currentMsgID != "" {
+			open = 1
+		}
+		namedQueueOpen.WithLabelValues(q.guildID, label).Set(float64(open))
+		namedQueueUsers.WithLabelValues(q.guildID, label).Set(float64(len(qu.users)))
+		queueWaitlist.WithLabelValues(q.guildID, label).Set(float64(len(qu.waitlist)))
+		namedQueueCapacity.WithLabelValues(q.guildID, label).Set(float64(qu.size))
+		if q.guildID == GuildID && name == "" {
+			queueOpen.Set(float64(open))
+			queueUsers.Set(float64(len(qu.users)))
+			queueCapacity.Set(float64(qu.size))
+		}
+	}
+}
+
+// deleteQueueMetrics drops the series of a queue the guild no longer keeps.
+func deleteQueueMetrics(guildID, name string) {
+	label := queueLabel(name)
+	namedQueueOpen.DeleteLabelValues(guildID, label)
+	namedQueueUsers.DeleteLabelValues(guildID, label)
+	queueWaitlist.DeleteLabelValues(guildID, label)
+	namedQueueCapacity.DeleteLabelValues(guildID, label)
+}
+
+// queueLabel is the queue label for the queue's metrics.
+func queueLabel(name string) string {
+	if name == "" {
+		return "default"
+	}
+	return name
+}
+
+func markActivity() {
+	queueLastActivity.Set(float64(time.Now().Unix()))
+}
+
+// Discord JSON error codes, see
+// https://discord.com/developers/docs/topics/opcodes-and-status-codes#json
+const (
+	discordCodeUnknownMessage      = 10008
+	discordCodeUnknownWebhook      = 10015
+	discordCodeUnknownInteraction  = 10062
+	discordCodeMissingPermissions  = 50013
+	discordCodeInvalidWebhookToken = 50027
+)
+
+// errorCountingTransport counts failed Discord API requests by reason, and
+// tells the reporter about them.
+type errorCountingTransport struct {
+	base     http.RoundTripper
+	reporter *errorReporter
+}
+
+func (t errorCountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		apiErrors.WithLabelValues("network").Inc()
+		t.reporter.apiFailure(req, "network", 0)
+		return resp, err
+	}
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+
+	// Read the body to find Discord's error code, then put it back for discordgo.
+	body, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if readErr != nil {
+		apiErrors.WithLabelValues("network").Inc()
+		t.reporter.apiFailure(req, "network", resp.StatusCode)
+		return resp, nil
+	}
+	var apiErr struct {
+		Code int `json:"code"`
+	}
+	_ = json.Unmarshal(body, &apiErr)
+	reason := errorReason(resp.StatusCode, apiErr.Code)
+	apiErrors.WithLabelValues(reason).Inc()
+	t.reporter.apiFailure(req, reason, resp.StatusCode)
+	return resp, nil
+}
+
+func errorReason(status, code int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return "rate_limited"
+	case code == discordCodeUnknownMessage:
+		return "unknown_message"
+	case code == discordCodeMissingPermissions:
+		return "missing_permissions"
+	case code == discordCodeUnknownInteraction, code == discordCodeUnknownWebhook, code == discordCodeInvalidWebhookToken:
+		return "token_expired"
+	case status >= 500:
+		return "server_error"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// mvpVoteDuration is how long players have to vote after a session ends.
+const mvpVoteDuration = 30 * time.Minute
+
+// mvpVote is the MVP vote for the session that just ended.
+type mvpVote struct {
+	channelID string
+	msgID     string
+	players   []*discordgo.User
+	// votes maps voter ID to the ID of the player they voted for
+	votes  map[string]string
+	endsAt time.Time
+}
+
+func (v *mvpVote) isPlayer(userID string) bool {
+	for _, p := range v.players {
+		if p.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// startMVPVoteLocked posts an MVP vote for the players of the last session
+// if it was played in the queue that is closing.
+// lock must be held
+func (q *queueState) startMVPVoteLocked(s *discordgo.Session) {
+	if len(q.sessions) == 0 || q.openedAt.IsZero() {
+		return
+	}
+	sess := q.sessions[len(q.sessions)-1]
+	if sess.FilledAt.Before(q.openedAt) || len(sess.Players) < 2 {
+		return
+	}
+	if q.mvp != nil {
+		q.finishMVPVoteLocked(s)
+	}
+
+	vote := &mvpVote{
+		channelID: q.channelID,
+		players:   sess.Players,
+		votes:     make(map[string]string),
+		endsAt:    time.Now().Add(mvpVoteDuration),
+	}
+	var rows []discordgo.MessageComponent
+	var row discordgo.ActionsRow
+	for _, p := range vote.players {
+		if len(rows) == 5 {
+			break
+		}
+		row.Components = append(row.Components, discordgo.Button{
+			Label:    p.Username,
+			Style:    discordgo.SecondaryButton,
+			CustomID: "mvp_vote:" + p.ID,
+		})
+		if len(row.Components) == 5 {
+			rows = append(rows, row)
+			row = discordgo.ActionsRow{}
+		}
+	}
+	if len(row.Components) > 0 && len(rows) < 5 {
+		rows = append(rows, row)
+	}
+	msg, err := s.ChannelMessageSendComplex(vote.channelID, &discordgo.MessageSend{
+		Content:    fmt.Sprintf("### Session MVP\nPlayers, who was the MVP of the last game? Voting closes <t:%d:R>.", vote.endsAt.Unix()),
+		Components: rows,
+	})
+	if err != nil {
+		log.Printf("error sending MVP vote: %v\n", err)
+		return
+	}
+	vote.msgID = msg.ID
+	q.mvp = vote
+}
+
+// checkMVPVoteLocked closes the vote once its time is up.
+// lock must be held
+func (q *queueState) checkMVPVoteLocked(s *discordgo.Session) {
+	if q.mvp != nil && time.Now().After(q.mvp.endsAt) {
+		q.finishMVPVoteLocked(s)
+	}
+}
+
+// finishMVPVoteLocked tallies the vote, credits the winners in their stats
+// and replaces the buttons with the result.
+// lock must be held
+func (q *queueState) finishMVPVoteLocked(s *discordgo.Session) {
+	vote := q.mvp
+	q.mvp = nil
+
+	tally := make(map[string]int)
+	for _, candidate := range vote.votes {
+		tally[candidate]++
+	}
+	most := 0
+	for _, n := range tally {
+		most = max(most, n)
+	}
+	var winners []string
+	for id, n := range tally {
+		if n == most {
+			winners = append(winners, id)
+		}
+	}
+	sort.Strings(winners)
+
+	content := "### Session MVP\nNobody voted this time."
+	if len(winners) > 0 {
+		mentions := make([]string, len(winners))
+		for i, id := range winners {
+			q.statsLocked(id).MVPCount++
+			mentions[i] = fmt.Sprintf("<@%s>", id)
+		}
+		q.pushLinkedRolesLocked(winners...)
+		content = fmt.Sprintf("### Session MVP\n%s with %d %s!", strings.Join(mentions, " and "), most, pluralize(most, "vote", "votes"))
+	}
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:              vote.msgID,
+		Channel:         vote.channelID,
+		Content:         &content,
+		Components:      &[]discordgo.MessageComponent{},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}); err != nil {
+		log.Printf("error editing MVP vote: %v\n", err)
+	}
+}
+
+func (q *queueState) handleMVPVote(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	candidateID := customIDArgs(i)[0]
+
+	voter := i.Member.User
+	switch {
+	case q.mvp == nil || q.mvp.msgID != i.Message.ID:
+		respondEphemeral(s, i, "This vote has closed.")
+		return
+	case !q.mvp.isPlayer(voter.ID):
+		respondEphemeral(s, i, "Only players from the session can vote.")
+		return
+	case voter.ID == candidateID:
+		respondEphemeral(s, i, "You can't vote for yourself.")
+		return
+	}
+
+	q.mvp.votes[voter.ID] = candidateID
+	respondEphemeral(s, i, fmt.Sprintf("Voted for <@%s>. You can change your vote until it closes.", candidateID))
+	if len(q.mvp.votes) == len(q.mvp.players) {
+		q.finishMVPVoteLocked(s)
+	}
+}
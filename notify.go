@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// notifyKind says what a notification is about, which decides whether the
+// user wants it and whether it's batched into a digest.
+type notifyKind string
+
+const (
+	notifyFill        notifyKind = "fill"
+	notifyPromote     notifyKind = "promote"
+	notifyReinvite    notifyKind = "reinvite"
+	notifyWatch       notifyKind = "watch"
+	notifyQueueOpened notifyKind = "queue_opened"
+	notifyRemoved     notifyKind = "removed"
+	notifyLobbyCode   notifyKind = "lobby_code"
+	notifyStaff       notifyKind = "staff"
+	notifyWaitlist    notifyKind = "waitlist"
+	notifyReminder    notifyKind = "reminder"
+	notifyPaused      notifyKind = "paused"
+)
+
+const (
+	// notifyDedupeWindow is how long an identical notification to the same
+	// user or channel is suppressed, e.g. when a queue flaps between full and
+	// one short.
+	notifyDedupeWindow = 10 * time.Minute
+	// digestWindow is how long digest notifications are collected before
+	// they're sent together.
+	digestWindow = 15 * time.Minute
+	// jobDigest sends a user's collected digest notifications.
+	jobDigest = "digest"
+)
+
+// digestKinds are batched instead of sent right away, since several can
+// happen in a short time and none are urgent.
+var digestKinds = map[notifyKind]string{
+	notifyQueueOpened: "queues opened while you were away",
+}
+
+// wantsLocked reports whether the user wants notifications of kind.
+// lock must be held
+func (q *queueState) wantsLocked(userID string, kind notifyKind) bool {
+	p := q.prefsLocked(userID)
+	switch kind {
+	case notifyFill, notifyPromote, notifyWaitlist:
+		return p.FillDMs
+	case notifyReinvite:
+		return p.Reinvites && !p.Paused
+	case notifyQueueOpened:
+		return p.OpenDMs && !p.Paused
+	case notifyReminder:
+		return !p.NoReminders
+	}
+	return true
+}
+
+// duplicateLocked reports whether key was notified within
+// notifyDedupeWindow, and otherwise records it as notified now.
+// lock must be held
+func (q *queueState) duplicateLocked(key string) bool {
+	now := time.Now()
+	for k, at := range q.notified {
+		if now.Sub(at) >= notifyDedupeWindow {
+			delete(q.notified, k)
+		}
+	}
+	if _, ok := q.notified[key]; ok {
+		return true
+	}
+	q.notified[key] = now
+	return false
+}
+
+// notifyLocked DMs content to the user if they want notifications of kind
+// and haven't just been sent the same thing. Digest kinds are held and sent
+// together after digestWindow. The error is only set if sending failed.
+// lock must be held
+func (q *queueState) notifyLocked(s *discordgo.Session, userID string, kind notifyKind, content string) error {
+	return q.notifyMessageLocked(s, userID, kind, &discordgo.MessageSend{Content: content})
+}
+
+// notifyMessageLocked is notifyLocked for a message with components.
+// Components are dropped from digest kinds.
+// lock must be held
+func (q *queueState) notifyMessageLocked(s *discordgo.Session, userID string, kind notifyKind, msg *discordgo.MessageSend) error {
+	if !q.wantsLocked(userID, kind) || q.duplicateLocked(userID+"|"+string(kind)+"|"+msg.Content) {
+		return nil
+	}
+	if _, ok := digestKinds[kind]; ok {
+		q.addToDigestLocked(userID, kind, msg.Content)
+		return nil
+	}
+	if err := sendDMComplex(s, userID, msg); err != nil {
+		log.Printf("error sending %s notification to %s: %v\n", kind, userID, err)
+		return err
+	}
+	return nil
+}
+
+// notifyChannelLocked posts content in the channel unless it was just
+// posted there.
+// lock must be held
+func (q *queueState) notifyChannelLocked(s *discordgo.Session, channelID, content string) {
+	if q.duplicateLocked(channelID + "|" + content) {
+		return
+	}
+	if _, err := s.ChannelMessageSend(channelID, content); err != nil {
+		log.Printf("error sending notification to channel %s: %v\n", channelID, err)
+	}
+}
+
+// addToDigestLocked adds content to the user's pending digest, kept as the
+// arguments of its job so it survives restarts.
+// lock must be held
+func (q *queueState) addToDigestLocked(userID string, kind notifyKind, content string) {
+	key := jobDigest + ":" + userID + ":" + string(kind)
+	at := time.Now().Add(digestWindow)
+	args := []string{userID, string(kind)}
+	if j, ok := q.scheduler.jobs[key]; ok {
+		at = j.At
+		args = j.Args
+	}
+	q.scheduler.scheduleLocked(jobDigest, key, at, append(args, content)...)
+}
+
+// runDigestJobLocked sends a user's collected notifications as one DM.
+// lock must be held
+func (q *queueState) runDigestJobLocked(s *discordgo.Session, j *job) {
+	userID, kind, items := j.Args[0], notifyKind(j.Args[1]), j.Args[2:]
+	if len(items) == 0 || !q.wantsLocked(userID, kind) {
+		return
+	}
+	content := items[0]
+	if len(items) > 1 {
+		content = fmt.Sprintf("%d %s:\n- %s", len(items), digestKinds[kind], strings.Join(items, "\n- "))
+	}
+	if err := sendDM(s, userID, content); err != nil {
+		log.Printf("error sending %s digest to %s: %v\n", kind, userID, err)
+	}
+}
+
+// notifyQueueOpenedLocked lets opted-in users know the selected queue opened.
+// lock must be held
+func (q *queueState) notifyQueueOpenedLocked(s *discordgo.Session) {
+	content := fmt.Sprintf("%s opened: https://discord.com/channels/%s/%s/%s", q.titleLocked(), q.guildID, q.channelID, q.currentMsgID)
+	for id, p := range q.prefs {
+		if !p.OpenDMs || q.openedBy != nil && id == q.openedBy.ID {
+			continue
+		}
+		q.notifyLocked(s, id, notifyQueueOpened, content)
+	}
+}
+
+// pingRoleLocked pings roleID about the newly opened queue. The ping is
+// deleted when the queue closes so it doesn't lead anyone to a stale queue.
+// lock must be held
+func (q *queueState) pingRoleLocked(s *discordgo.Session, roleID string) {
+	if roleID == "" {
+		return
+	}
+	m, err := s.ChannelMessageSendComplex(q.channelID, &discordgo.MessageSend{
+		Content:         fmt.Sprintf("<@&%s> %s is open!", roleID, q.titleLocked()),
+		AllowedMentions: &discordgo.MessageAllowedMentions{Roles: []string{roleID}},
+		Reference:       &discordgo.MessageReference{MessageID: q.currentMsgID, ChannelID: q.channelID},
+	})
+	if err != nil {
+		log.Printf("error sending role ping: %v\n", err)
+		return
+	}
+	q.pingMsgID = m.ID
+}
+
+// lock must be held
+func (q *queueState) deleteRolePingLocked(s *discordgo.Session) {
+	if q.pingMsgID == "" {
+		return
+	}
+	if err := s.ChannelMessageDelete(q.channelID, q.pingMsgID); err != nil {
+		log.Printf("error deleting role ping: %v\n", err)
+	}
+	q.pingMsgID = ""
+}
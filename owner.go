@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ownerCommands are registered globally and only usable by bot owners.
+var ownerCommands = []*discordgo.ApplicationCommand{
+	{
+		Name:        "standby-maintenance",
+		Description: "Bot owner command to toggle maintenance mode",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "message",
+				Description: "Message shown to users while in maintenance",
+			},
+		},
+	},
+	{
+		Name:        "standby-guilds",
+		Description: "Bot owner command to list guilds the bot is in",
+	},
+	{
+		Name:        "standby-globalstats",
+		Description: "Bot owner command to show how much each guild uses the bot",
+	},
+	{
+		Name:        "standby-reload",
+		Description: "Bot owner command to reload the config file and environment",
+	},
+}
+
+func isOwnerCommand(name string) bool {
+	for _, c := range ownerCommands {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isOwner(userID string) bool {
+	for _, id := range current(&OwnerIDs) {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// interactionUser returns the user behind an interaction in a guild or DM.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// maintenanceBlocked responds and returns true if the interaction should be
+// ignored because the bot is in maintenance mode. Owners are never blocked.
+func (g *guildStates) maintenanceBlocked(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	g.Lock()
+	message := g.maintenance
+	g.Unlock()
+
+	if message == "" || isOwner(interactionUser(i).ID) {
+		return false
+	}
+	respondEphemeral(s, i, message)
+	return true
+}
+
+func (g *guildStates) handleOwnerCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !isOwner(interactionUser(i).ID) {
+		respondEphemeral(s, i, "Only bot owners can use this command.")
+		return
+	}
+
+	data := i.ApplicationCommandData()
+	switch data.Name {
+	case "standby-maintenance":
+		g.Lock()
+		defer g.Unlock()
+
+		if g.maintenance != "" {
+			g.maintenance = ""
+			log.Printf("maintenance mode disabled by %s\n", interactionUser(i).ID)
+			respondEphemeral(s, i, "Maintenance mode is off.")
+			return
+		}
+		g.maintenance = "The standby bot is under maintenance, try again later."
+		if len(data.Options) > 0 {
+			g.maintenance = data.Options[0].StringValue()
+		}
+		log.Printf("maintenance mode enabled by %s\n", interactionUser(i).ID)
+		respondEphemeral(s, i, fmt.Sprintf("Maintenance mode is on: %s", g.maintenance))
+
+	case "standby-guilds":
+		guilds := make([]string, 0, len(s.State.Guilds))
+		for _, guild := range s.State.Guilds {
+			guilds = append(guilds, fmt.Sprintf("%s (%s) - %d members", guild.Name, guild.ID, guild.MemberCount))
+		}
+		sort.Strings(guilds)
+		respondEphemeral(s, i, fmt.Sprintf("### Guilds (%d)\n%s", len(guilds), strings.Join(guilds, "\n")))
+
+	case "standby-reload":
+		changed, needRestart, err := g.reloadConfig()
+		if err != nil {
+			respondEphemeral(s, i, fmt.Sprintf("The config wasn't reloaded, nothing changed:\n```\n%v\n```", err))
+			return
+		}
+		log.Printf("config reloaded by %s, changed %v\n", interactionUser(i).ID, changed)
+		reply := "Reloaded the config, nothing changed."
+		if len(changed) > 0 {
+			reply = "Reloaded the config, changed " + strings.Join(changed, ", ") + "."
+		}
+		if len(needRestart) > 0 {
+			reply += "\n-# " + strings.Join(needRestart, ", ") + " only change after a restart."
+		}
+		respondEphemeral(s, i, reply)
+
+	case "standby-globalstats":
+		activity := g.activity()
+		var opened, filled, active int
+		lines := make([]string, 0, len(activity))
+		for _, a := range activity {
+			opened += a.Opened
+			filled += a.Filled
+			active += a.ActiveUsers
+			if len(lines) == activityListed {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("**%s** (%s) - %d opened, %s filled, %d active %s",
+				a.Name, a.GuildID, a.Opened, fillRate(a.Filled, a.Opened), a.ActiveUsers, pluralize(a.ActiveUsers, "user", "users")))
+		}
+		reply := fmt.Sprintf("### Global stats, last %d days\nGuilds: %d\nQueues opened: %d\nQueues filled: %s\nActive users: %d\n%s",
+			activityDays, len(s.State.Guilds), opened, fillRate(filled, opened), active, strings.Join(lines, "\n"))
+		if more := len(activity) - len(lines); more > 0 {
+			reply += fmt.Sprintf("\n-# And %d more, see /debug/guilds.", more)
+		}
+		respondEphemeral(s, i, reply)
+	}
+}
+
+const (
+	// activityDays is how far back the owner's per-guild stats look.
+	activityDays = 30
+	// activityListed is how many guilds /standby-globalstats lists, the
+	// busiest ones, to stay under the message length limit.
+	activityListed = 20
+)
+
+// guildActivity summarizes how much a guild uses the bot.
+type guildActivity struct {
+	GuildID string `json:"guild_id"`
+	Name    string `json:"name"`
+	// Opened and Filled count queues closed within activityDays, from the
+	// history if there is one and since startup otherwise.
+	Opened int `json:"queues_opened"`
+	Filled int `json:"queues_filled"`
+	// ActiveUsers joined a queue within activityDays.
+	ActiveUsers int `json:"active_users"`
+}
+
+// activity returns every guild's activity, busiest first.
+func (g *guildStates) activity() []guildActivity {
+	since := time.Now().AddDate(0, 0, -activityDays)
+	var counts map[string]guildQueueCounts
+	if g.history != nil {
+		var err error
+		if counts, err = g.history.queryGuildCounts(since); err != nil {
+			log.Printf("error reading guild activity: %v\n", err)
+		}
+	}
+
+	states := g.all()
+	activity := make([]guildActivity, 0, len(states))
+	for _, q := range states {
+		a := guildActivity{GuildID: q.guildID, Name: q.guildID}
+		if guild, err := g.s.State.Guild(q.guildID); err == nil {
+			a.Name = guild.Name
+		}
+		q.Lock()
+		if counts != nil {
+			a.Opened, a.Filled = counts[q.guildID].Opened, counts[q.guildID].Filled
+		} else {
+			a.Opened, a.Filled = q.totals.opened, q.totals.filled
+		}
+		for _, ps := range q.stats {
+			if ps.LastJoined.After(since) {
+				a.ActiveUsers++
+			}
+		}
+		q.Unlock()
+		activity = append(activity, a)
+	}
+	sort.Slice(activity, func(a, b int) bool {
+		if activity[a].Opened != activity[b].Opened {
+			return activity[a].Opened > activity[b].Opened
+		}
+		return activity[a].ActiveUsers > activity[b].ActiveUsers
+	})
+	return activity
+}
+
+// handleActivity serves every guild's activity as JSON for owners who'd
+// rather not use Discord. It's served behind DebugToken, see requireToken.
+func (g *guildStates) handleActivity(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(g.activity()); err != nil {
+		log.Printf("error writing guild activity: %v\n", err)
+	}
+}
+
+// reloadConfig reloads the config, then reschedules the jobs that depend on
+// it in each guild in turn.
+func (g *guildStates) reloadConfig() (changed, needRestart []string, err error) {
+	if changed, needRestart, err = reloadConfig(); err != nil {
+		return nil, nil, err
+	}
+	for _, q := range g.all() {
+		q.Lock()
+		q.scheduleHistoryPurgeLocked()
+		q.schedulePruneLocked()
+		q.Unlock()
+	}
+	return changed, needRestart, nil
+}
+
+// reloadOnHangup reloads the config whenever the process gets SIGHUP, for
+// edits to the config file.
+func (g *guildStates) reloadOnHangup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		changed, needRestart, err := g.reloadConfig()
+		if err != nil {
+			log.Printf("error reloading config on SIGHUP, nothing changed: %v\n", err)
+			continue
+		}
+		log.Printf("config reloaded on SIGHUP, changed %v, needs restart %v\n", changed, needRestart)
+	}
+}
+
+// fillRate formats filled out of opened as a percentage.
+func fillRate(filled, opened int) string {
+	if opened == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d%%", 100*filled/opened)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type permission struct {
+	name string
+	bit  int64
+}
+
+var (
+	// queueChannelPermissions are needed in the queue channel to post and
+	// maintain the queue message and its notifications.
+	queueChannelPermissions = []permission{
+		{"View Channel", discordgo.PermissionViewChannel},
+		{"Send Messages", discordgo.PermissionSendMessages},
+		{"Embed Links", discordgo.PermissionEmbedLinks},
+		{"Read Message History", discordgo.PermissionReadMessageHistory},
+		{"Manage Messages (pin and delete)", discordgo.PermissionManageMessages},
+		{"Create Public Threads", discordgo.PermissionCreatePublicThreads},
+		{"Send Messages in Threads", discordgo.PermissionSendMessagesInThreads},
+		{"Move Members", discordgo.PermissionVoiceMoveMembers},
+		{"Manage Channels (stack voice channels)", discordgo.PermissionManageChannels},
+		{"Manage Roles", discordgo.PermissionManageRoles},
+	}
+	// staffChannelPermissions are needed in the staff channel for alerts.
+	staffChannelPermissions = []permission{
+		{"View Channel", discordgo.PermissionViewChannel},
+		{"Send Messages", discordgo.PermissionSendMessages},
+	}
+	// archiveChannelPermissions are needed in the archive channel for
+	// closed queue summaries.
+	archiveChannelPermissions = []permission{
+		{"View Channel", discordgo.PermissionViewChannel},
+		{"Send Messages", discordgo.PermissionSendMessages},
+		{"Embed Links", discordgo.PermissionEmbedLinks},
+	}
+)
+
+// missingPermissions returns the names of perms the bot lacks in channelID.
+func missingPermissions(s *discordgo.Session, channelID string, perms []permission) ([]string, error) {
+	have, err := s.UserChannelPermissions(s.State.User.ID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if have&discordgo.PermissionAdministrator != 0 {
+		return nil, nil
+	}
+	var missing []string
+	for _, p := range perms {
+		if have&p.bit == 0 {
+			missing = append(missing, p.name)
+		}
+	}
+	return missing, nil
+}
+
+func handlePermCheck(s *discordgo.Session, i *discordgo.InteractionCreate, cfg guildConfig) {
+	channels := []struct {
+		label string
+		id    string
+		perms []permission
+	}{
+		{"Queue channel", cfg.ChannelID, queueChannelPermissions},
+		{"Staff channel", cfg.StaffChannelID, staffChannelPermissions},
+		{"Archive channel", cfg.ArchiveChannelID, archiveChannelPermissions},
+	}
+
+	var sb strings.Builder
+	for _, c := range channels {
+		if c.id == "" {
+			continue
+		}
+		missing, err := missingPermissions(s, c.id, c.perms)
+		switch {
+		case err != nil:
+			log.Printf("error checking permissions in %s: %v\n", c.id, err)
+			sb.WriteString(fmt.Sprintf("❌ %s <#%s>: can't read permissions (%v)\n", c.label, c.id, err))
+		case len(missing) > 0:
+			sb.WriteString(fmt.Sprintf("❌ %s <#%s> is missing: %s\n", c.label, c.id, strings.Join(missing, ", ")))
+		default:
+			sb.WriteString(fmt.Sprintf("✅ %s <#%s>: all permissions present\n", c.label, c.id))
+		}
+	}
+	respondEphemeral(s, i, sb.String())
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// statusLineLocked states the open queue's status and how full it is, for
+// guilds with PlainStatus set, since screen readers skip embed colors and
+// read emoji by name.
+// lock must be held
+func (q *queueState) statusLineLocked() string {
+	status := "Open"
+	switch {
+	case q.closing != nil:
+		status = "Closing"
+	case q.readyCheck != nil:
+		status = "Full, ready check running"
+	case len(q.users) >= q.size:
+		status = "Full"
+	case !q.lastCallUntil.IsZero():
+		status = "Last call"
+	}
+	line := fmt.Sprintf("**Status: %s.** %d of %d players", status, len(q.users), q.size)
+	if left := q.size - len(q.users); left > 0 {
+		line += fmt.Sprintf(", %d %s left", left, pluralize(left, "spot", "spots"))
+	}
+	if len(q.waitlist) > 0 {
+		line += fmt.Sprintf(", %d on the waitlist", len(q.waitlist))
+	}
+	return line + "."
+}
+
+// closedStatusLocked prefixes the status a queue closed with for guilds with
+// PlainStatus set, so it reads as closed without the disabled buttons.
+// lock must be held
+func (q *queueState) closedStatusLocked(status string) string {
+	if !q.configs.get(q.guildID).PlainStatus {
+		return status
+	}
+	return "**Status: Closed.** " + status
+}
+
+func (q *queueState) configPlainStatus(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	enabled := opts["enabled"].BoolValue()
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		cfg.PlainStatus = enabled
+	}); err != nil {
+		return "", err
+	}
+	if !enabled {
+		return "Queue messages no longer spell out their status.", nil
+	}
+	return "Queue messages now start with their status in words, like \"Status: Full\", and /standby-prefs says On or Off instead of using checkboxes. An open queue picks this up at its next update.", nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// userPrefs are a user's notification and automation preferences. The zero
+// value is the default, so only users who changed something are stored.
+type userPrefs struct {
+	// FillDMs sends a DM when the user's queue fills or they're promoted.
+	FillDMs bool `json:"fill_dms,omitempty"`
+	// OpenDMs sends a DM, batched into digests, when a queue opens.
+	OpenDMs bool `json:"open_dms,omitempty"`
+	// Reinvites asks the user to fill the last slot of a stuck queue after
+	// they've played recently.
+	Reinvites bool `json:"reinvites,omitempty"`
+	// NoVoiceAutoJoin stops joining an auto-join voice channel from adding
+	// the user to the queue.
+	NoVoiceAutoJoin bool `json:"no_voice_auto_join,omitempty"`
+	// NoReminders stops the DM before a scheduled queue the user RSVP'd to.
+	NoReminders bool `json:"no_reminders,omitempty"`
+	// Paused holds back OpenDMs and Reinvites after the user stopped joining
+	// queues for PruneAfter, until they join again.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// prefOptions map /standby-prefs options to the preference they set.
+// Options that turn something off are inverted.
+var prefOptions = []struct {
+	name, description string
+	field             func(p *userPrefs) *bool
+	inverted          bool
+}{
+	{"fill_dms", "DM me when my queue fills or I'm promoted from the waitlist", func(p *userPrefs) *bool { return &p.FillDMs }, false},
+	{"open_dms", "DM me when a queue opens", func(p *userPrefs) *bool { return &p.OpenDMs }, false},
+	{"reinvites", "Ask me to fill the last slot after I've played recently", func(p *userPrefs) *bool { return &p.Reinvites }, false},
+	{"voice_auto_join", "Join the queue when I join its voice channel", func(p *userPrefs) *bool { return &p.NoVoiceAutoJoin }, true},
+	{"reminders", "Remind me before scheduled queues I RSVP'd to", func(p *userPrefs) *bool { return &p.NoReminders }, true},
+}
+
+var prefsCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-prefs",
+	Description: "Choose which notifications you get; leave everything empty to see your settings",
+	Options:     prefsCommandOptions(),
+}
+
+func prefsCommandOptions() []*discordgo.ApplicationCommandOption {
+	var opts []*discordgo.ApplicationCommandOption
+	for _, p := range prefOptions {
+		opts = append(opts, &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionBoolean,
+			Name:        p.name,
+			Description: p.description,
+		})
+	}
+	return append(opts, &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionBoolean,
+		Name:        "role_pings",
+		Description: "Get the role that's pinged when a queue opens",
+	})
+}
+
+// prefsLocked returns the user's preferences.
+// lock must be held
+func (q *queueState) prefsLocked(userID string) userPrefs {
+	if p, ok := q.prefs[userID]; ok {
+		return *p
+	}
+	return userPrefs{}
+}
+
+// updatePrefsLocked changes the user's preferences with fn, dropping them
+// once they're back to the defaults.
+// lock must be held
+func (q *queueState) updatePrefsLocked(userID string, fn func(p *userPrefs)) {
+	p := q.prefsLocked(userID)
+	fn(&p)
+	if p == (userPrefs{}) {
+		delete(q.prefs, userID)
+		return
+	}
+	q.prefs[userID] = &p
+}
+
+func (q *queueState) handlePrefs(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	userID := i.Member.User.ID
+	opts := optionMap(i.ApplicationCommandData().Options)
+	q.updatePrefsLocked(userID, func(p *userPrefs) {
+		for _, po := range prefOptions {
+			if opt, ok := opts[po.name]; ok {
+				*po.field(p) = opt.BoolValue() != po.inverted
+				p.Paused = false
+			}
+		}
+	})
+
+	var notes []string
+	pingRoleID := q.configs.get(q.guildID).PingRoleID
+	pinged := hasRole(i.Member, pingRoleID)
+	if opt, ok := opts["role_pings"]; ok && opt.BoolValue() != pinged {
+		if note := setPingRole(s, q.guildID, pingRoleID, userID, opt.BoolValue()); note != "" {
+			notes = append(notes, note)
+		} else {
+			pinged = opt.BoolValue()
+		}
+	}
+
+	plain := q.configs.get(q.guildID).PlainStatus
+	var sb strings.Builder
+	sb.WriteString("Your settings:\n")
+	p := q.prefsLocked(userID)
+	for _, po := range prefOptions {
+		sb.WriteString(fmt.Sprintf("%s %s\n", checkmark(*po.field(&p) != po.inverted, plain), po.description))
+	}
+	if pingRoleID != "" {
+		sb.WriteString(fmt.Sprintf("%s Get pinged with <@&%s> when a queue opens\n", checkmark(pinged, plain), pingRoleID))
+	}
+	if p.Paused {
+		notes = append(notes, "Queue opened DMs and reinvites are paused since you haven't joined a queue in a while. Join one or change a setting to resume them.")
+	}
+	for _, note := range notes {
+		sb.WriteString("-# " + note + "\n")
+	}
+	respondEphemeral(s, i, sb.String())
+}
+
+// setPingRole gives or takes the guild's ping role, returning why it
+// couldn't.
+func setPingRole(s *discordgo.Session, guildID, roleID, userID string, on bool) string {
+	if roleID == "" {
+		return "This server doesn't have a ping role set up."
+	}
+	var err error
+	if on {
+		err = s.GuildMemberRoleAdd(guildID, userID, roleID)
+	} else {
+		err = s.GuildMemberRoleRemove(guildID, userID, roleID)
+	}
+	if err != nil {
+		log.Printf("error changing ping role for %s: %v\n", userID, err)
+		return "Couldn't change your ping role, an admin may need to check /standby-permcheck."
+	}
+	return ""
+}
+
+func hasRole(m *discordgo.Member, roleID string) bool {
+	for _, r := range m.Roles {
+		if r == roleID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkmark marks a setting as on or off, in words if plain is set.
+func checkmark(on, plain bool) string {
+	switch {
+	case plain && on:
+		return "**On:**"
+	case plain:
+		return "**Off:**"
+	case on:
+		return "✅"
+	}
+	return "⬜"
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord drops presence updates sent more often than roughly 5 per minute,
+// so updates are coalesced and applied at most once per interval.
+const presenceUpdateInterval = 15 * time.Second
+
+type presenceWatcher struct {
+	s       *discordgo.Session
+	pending chan string
+}
+
+func newPresenceWatcher(s *discordgo.Session) *presenceWatcher {
+	return &presenceWatcher{
+		s:       s,
+		pending: make(chan string, 1),
+	}
+}
+
+// set schedules state to be shown as the bot's status, replacing any state
+// that has not been sent yet. An empty state shows the idle prompt.
+func (p *presenceWatcher) set(state string) {
+	select {
+	case <-p.pending:
+	default:
+	}
+	select {
+	case p.pending <- state:
+	default:
+	}
+}
+
+func (p *presenceWatcher) run() {
+	for state := range p.pending {
+		if err := p.update(state); err != nil {
+			log.Printf("error updating presence: %v\n", err)
+		}
+		time.Sleep(presenceUpdateInterval)
+	}
+}
+
+func (p *presenceWatcher) update(state string) error {
+	if state == "" {
+		return p.s.UpdateStatusComplex(discordgo.UpdateStatusData{
+			Status: "idle",
+			Activities: []*discordgo.Activity{
+				{
+					Name:  "Type /standby",
+					Type:  discordgo.ActivityTypeCustom,
+					State: "Type /standby to join",
+				},
+			},
+		})
+	}
+	return p.s.UpdateStatusComplex(discordgo.UpdateStatusData{
+		Status: "online",
+		Activities: []*discordgo.Activity{
+			{
+				Name:  state,
+				Type:  discordgo.ActivityTypeCustom,
+				State: state,
+			},
+		},
+	})
+}
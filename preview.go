@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var previewPromoteCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-preview-promote",
+	Description: "Admin command to see who the waitlist would promote, without changing anything",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "slots",
+			Description: "How many slots open up, 1 by default",
+			MinValue:    ptr(1.0),
+			MaxValue:    MaxQueueSizeOption,
+		},
+		queueNameOption("Queue to preview"),
+	},
+}
+
+// promotionPreviewLocked returns the waitlist units promoteLocked would move
+// into the queue, in order, if slots more slots opened.
+// lock must be held
+func (q *queueState) promotionPreviewLocked(slots int) [][]*queueMember {
+	free := max(q.size-len(q.users), 0) + slots
+	taken := make(map[string]bool)
+	var units [][]*queueMember
+	for free > 0 {
+		unit := q.pickPromotionLocked(free, taken)
+		if unit == nil {
+			break
+		}
+		for _, m := range unit {
+			taken[m.ID] = true
+		}
+		free -= len(unit)
+		units = append(units, unit)
+	}
+	return units
+}
+
+// handlePreviewPromote lists who would be promoted if slots opened, e.g.
+// before kicking someone.
+func (q *queueState) handlePreviewPromote(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !q.configs.get(q.guildID).isAdmin(i.Member) {
+		respondEphemeral(s, i, "Only admins can use this command.")
+		return
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	data := i.ApplicationCommandData()
+	opts := optionMap(data.Options)
+	q.selectQueueLocked(q.commandQueueLocked(i.ChannelID, data.Options))
+	if q.currentMsgID == "" {
+		respondEphemeral(s, i, "There is no active queue.")
+		return
+	}
+	slots := 1
+	if opt, ok := opts["slots"]; ok {
+		slots = int(opt.IntValue())
+	}
+
+	units := q.promotionPreviewLocked(slots)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("If %d %s opened in %s:\n", slots, pluralize(slots, "slot", "slots"), q.titleLocked()))
+	if len(units) == 0 {
+		sb.WriteString("Nobody on the waitlist would be promoted.\n")
+	}
+	promoted := 0
+	for n, unit := range units {
+		mentions := make([]string, len(unit))
+		for idx, m := range unit {
+			mentions[idx] = fmt.Sprintf("<@%s>", m.ID)
+		}
+		line := fmt.Sprintf("%d. %s", n+1, strings.Join(mentions, " and "))
+		if len(unit) > 1 {
+			line += " (duo)"
+		}
+		sb.WriteString(line + "\n")
+		promoted += len(unit)
+	}
+	if left := len(q.waitlist) - promoted; left > 0 {
+		sb.WriteString(fmt.Sprintf("%d would stay on the waitlist.\n", left))
+	}
+	sb.WriteString("-# Nothing was changed.")
+	respondEphemeral(s, i, sb.String())
+}
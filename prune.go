@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// jobPruneSubscriptions pauses the subscriptions of users who stopped
+	// joining queues.
+	jobPruneSubscriptions = "prune_subscriptions"
+	// pruneInterval is how often subscriptions are checked for inactivity.
+	pruneInterval = 24 * time.Hour
+)
+
+// subscribedLocked reports whether the user gets notifications without
+// being in a queue, the ones worth pausing once they've moved on.
+// lock must be held
+func (q *queueState) subscribedLocked(userID string) bool {
+	p := q.prefsLocked(userID)
+	return !p.Paused && (p.OpenDMs || p.Reinvites)
+}
+
+// markJoinedLocked records that the user joined a queue, which also resumes
+// their paused subscriptions.
+// lock must be held
+func (q *queueState) markJoinedLocked(userID string) {
+	q.statsLocked(userID).LastJoined = time.Now()
+	if q.prefsLocked(userID).Paused {
+		q.updatePrefsLocked(userID, func(p *userPrefs) {
+			p.Paused = false
+		})
+	}
+}
+
+// schedulePruneLocked makes sure the prune job is scheduled if PruneAfter is
+// set.
+// lock must be held
+func (q *queueState) schedulePruneLocked() {
+	if current(&PruneAfter) == 0 {
+		q.scheduler.cancelLocked(jobPruneSubscriptions)
+		return
+	}
+	if _, ok := q.scheduler.jobs[jobPruneSubscriptions]; !ok {
+		q.scheduler.scheduleLocked(jobPruneSubscriptions, jobPruneSubscriptions, time.Now())
+	}
+}
+
+// runPruneJobLocked pauses the subscriptions of users who haven't joined a
+// queue in PruneAfter and DMs them a button to resume. Users who haven't
+// joined since joins were first tracked get PruneAfter from now.
+// lock must be held
+func (q *queueState) runPruneJobLocked(s *discordgo.Session, j *job) {
+	pruneAfter := current(&PruneAfter)
+	if pruneAfter == 0 {
+		return
+	}
+	now := time.Now()
+	for id := range q.prefs {
+		if !q.subscribedLocked(id) {
+			continue
+		}
+		ps := q.statsLocked(id)
+		if ps.LastJoined.IsZero() {
+			ps.LastJoined = now
+			continue
+		}
+		if now.Sub(ps.LastJoined) < pruneAfter {
+			continue
+		}
+		q.updatePrefsLocked(id, func(p *userPrefs) {
+			p.Paused = true
+		})
+		log.Printf("paused subscriptions of %s, last joined %s\n", id, ps.LastJoined)
+		q.notifyMessageLocked(s, id, notifyPaused, &discordgo.MessageSend{
+			Content: fmt.Sprintf("You haven't joined a standby queue in %s, so I've paused your queue notifications. Joining a queue turns them back on too.",
+				humanDuration(now.Sub(ps.LastJoined))),
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Turn them back on",
+						Style:    discordgo.PrimaryButton,
+						CustomID: "resume_subs:" + id + ":" + q.guildID,
+					},
+				}},
+			},
+		})
+	}
+	q.scheduler.scheduleLocked(jobPruneSubscriptions, jobPruneSubscriptions, now.Add(pruneInterval))
+}
+
+// handleResumeSubscriptions unpauses the user's subscriptions. It's clicked
+// in a DM, so there's no member.
+func (q *queueState) handleResumeSubscriptions(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	user := interactionUser(i)
+	if customIDArgs(i)[0] != user.ID {
+		return
+	}
+	// Counting this as a join keeps them from being paused again tomorrow.
+	q.markJoinedLocked(user.ID)
+	log.Printf("%s (%s) resumed their subscriptions\n", user.Username, user.ID)
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    i.Message.Content + "\n✅ Your queue notifications are back on.",
+			Components: []discordgo.MessageComponent{},
+		},
+	}); err != nil {
+		log.Printf("error responding to resume subscriptions: %v\n", err)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ranks in ascending order. A player's rank is stored as its index + 1 so
+// the zero value means unranked, and a queue's bracket is unbounded.
+var ranks = []string{"Iron", "Bronze", "Silver", "Gold", "Platinum", "Diamond", "Ascendant", "Immortal", "Radiant"}
+
+func rankChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, len(ranks))
+	for i, name := range ranks {
+		choices[i] = &discordgo.ApplicationCommandOptionChoice{Name: name, Value: i + 1}
+	}
+	return choices
+}
+
+func rankName(rank int) string {
+	if rank < 1 || rank > len(ranks) {
+		return "Unranked"
+	}
+	return ranks[rank-1]
+}
+
+// rankDivisions is how many divisions each rank has, 1 being the lowest. The
+// top rank has none.
+const rankDivisions = 3
+
+// playerRank is a player's in-game rank.
+type playerRank struct {
+	// Tier is the index into ranks + 1.
+	Tier int `json:"tier"`
+	// Division is 1 to rankDivisions, or 0 if unknown or the top rank.
+	Division int `json:"division,omitempty"`
+	// SetBy is the admin who overrode the rank, in which case the player
+	// can't change it themselves.
+	SetBy string `json:"set_by,omitempty"`
+}
+
+func (r playerRank) String() string {
+	if r.Division == 0 {
+		return rankName(r.Tier)
+	}
+	return fmt.Sprintf("%s %d", rankName(r.Tier), r.Division)
+}
+
+// skill orders ranks including their divisions, counting an unknown division
+// as the lowest.
+func (r playerRank) skill() int {
+	return (r.Tier-1)*rankDivisions + max(r.Division, 1)
+}
+
+// rankFromSkill is the inverse of playerRank.skill.
+func rankFromSkill(skill int) playerRank {
+	r := playerRank{Tier: (skill-1)/rankDivisions + 1, Division: (skill-1)%rankDivisions + 1}
+	if r.Tier >= len(ranks) {
+		return playerRank{Tier: len(ranks)}
+	}
+	return r
+}
+
+// parseRank reads a rank like "Gold2", "gold 2" or "Radiant". The division
+// can be left out.
+func parseRank(s string) (playerRank, error) {
+	s = strings.ToLower(strings.ReplaceAll(s, " ", ""))
+	for i, name := range ranks {
+		rest, ok := strings.CutPrefix(s, strings.ToLower(name))
+		if !ok {
+			continue
+		}
+		r := playerRank{Tier: i + 1}
+		if rest == "" {
+			return r, nil
+		}
+		div, err := strconv.Atoi(rest)
+		if err != nil || div < 1 || div > rankDivisions || r.Tier == len(ranks) {
+			break
+		}
+		r.Division = div
+		return r, nil
+	}
+	return playerRank{}, fmt.Errorf("unknown rank %q", s)
+}
+
+func rankOption(description string, required bool) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "rank",
+		Description: description,
+		Required:    required,
+		MaxLength:   20,
+	}
+}
+
+var rankCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-rank",
+	Description: "Set your rank, used for rank restricted queues and balancing teams",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "set",
+			Description: "Set your current rank",
+			Options:     []*discordgo.ApplicationCommandOption{rankOption("Your rank, e.g. Gold2 or Radiant", true)},
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "clear",
+			Description: "Clear your rank",
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionSubCommand,
+			Name:        "override",
+			Description: "Admin command to set someone's rank so they can't change it",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Name:        "user",
+					Description: "Player whose rank to set",
+					Required:    true,
+				},
+				rankOption("Their rank, e.g. Gold2; empty clears it and lets them set it again", false),
+			},
+		},
+	},
+}
+
+// rankTierLocked returns the user's rank without the division, 0 if unranked.
+// lock must be held
+func (q *queueState) rankTierLocked(userID string) int {
+	if r, ok := q.ranks[userID]; ok {
+		return r.Tier
+	}
+	return 0
+}
+
+func (q *queueState) handleRank(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	data := i.ApplicationCommandData()
+	sub := data.Options[0]
+	opts := optionMap(sub.Options)
+	if sub.Name == "override" {
+		q.overrideRankLocked(s, i, resolvedUser(data, opts["user"]), opts)
+		return
+	}
+
+	user := i.Member.User
+	if r, ok := q.ranks[user.ID]; ok && r.SetBy != "" {
+		respondEphemeral(s, i, fmt.Sprintf("<@%s> set your rank to %s, ask an admin to change it.", r.SetBy, r))
+		return
+	}
+	if sub.Name == "clear" {
+		delete(q.ranks, user.ID)
+		respondEphemeral(s, i, "Cleared your rank.")
+		return
+	}
+	r, err := parseRank(opts["rank"].StringValue())
+	if err != nil {
+		respondEphemeral(s, i, "Ranks look like Gold2 or Radiant.")
+		return
+	}
+	q.ranks[user.ID] = &r
+	respondEphemeral(s, i, fmt.Sprintf("Your rank is now %s.", r))
+}
+
+// overrideRankLocked sets or clears another player's rank for an admin.
+// lock must be held
+func (q *queueState) overrideRankLocked(s *discordgo.Session, i *discordgo.InteractionCreate, user *discordgo.User, opts map[string]*discordgo.ApplicationCommandInteractionDataOption) {
+	admin := i.Member.User
+	if !q.configs.get(q.guildID).isAdmin(i.Member) {
+		respondEphemeral(s, i, "Only admins can override ranks.")
+		return
+	}
+	opt, ok := opts["rank"]
+	if !ok {
+		delete(q.ranks, user.ID)
+		log.Printf("%s (%s) cleared the rank of %s (%s)\n", admin.Username, admin.ID, user.Username, user.ID)
+		respondEphemeral(s, i, fmt.Sprintf("Cleared <@%s>'s rank, they can set it again.", user.ID))
+		return
+	}
+	r, err := parseRank(opt.StringValue())
+	if err != nil {
+		respondEphemeral(s, i, "Ranks look like Gold2 or Radiant.")
+		return
+	}
+	r.SetBy = admin.ID
+	q.ranks[user.ID] = &r
+	log.Printf("%s (%s) set the rank of %s (%s) to %s\n", admin.Username, admin.ID, user.Username, user.ID, r)
+	respondEphemeral(s, i, fmt.Sprintf("<@%s>'s rank is now %s.", user.ID, r))
+}
+
+// rankBracketLocked describes the queue's rank restriction, or "" if anyone
+// can join.
+// lock must be held
+func (q *queueState) rankBracketLocked() string {
+	switch {
+	case q.rankMin == 0 && q.rankMax == 0:
+		return ""
+	case q.rankMax == 0:
+		return rankName(q.rankMin) + " and up"
+	case q.rankMin == 0:
+		return rankName(q.rankMax) + " and below"
+	case q.rankMin == q.rankMax:
+		return rankName(q.rankMin) + " only"
+	default:
+		return rankName(q.rankMin) + "–" + rankName(q.rankMax)
+	}
+}
+
+// inRankBracketLocked reports whether the user's rank is inside the queue's
+// bracket. Unranked players are outside any bracket.
+// lock must be held
+func (q *queueState) inRankBracketLocked(userID string) bool {
+	if q.rankMin == 0 && q.rankMax == 0 {
+		return true
+	}
+	rank := q.rankTierLocked(userID)
+	return rank != 0 && rank >= q.rankMin && (q.rankMax == 0 || rank <= q.rankMax)
+}
+
+// rejectRank answers a join with an explanation and a waitlist button if
+// the user is outside the queue's rank bracket, reporting whether it did.
+// The waitlist isn't restricted, so they can still fill in if needed.
+func (q *queueState) rejectRank(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	name := interactionQueueName(i)
+	q.selectQueueLocked(q.queueLocked(name))
+	inBracket := q.inRankBracketLocked(i.Member.User.ID)
+	bracket := q.rankBracketLocked()
+	rank := rankName(q.rankTierLocked(i.Member.User.ID))
+	if inBracket {
+		return false
+	}
+	content := fmt.Sprintf("This queue is for %s and you're %s. You can still join the waitlist to fill in if needed.", bracket, rank)
+	if rank == rankName(0) {
+		content = fmt.Sprintf("This queue is for %s. Set your rank with /standby-rank set first, or join the waitlist to fill in if needed.", bracket)
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{
+							Label:    "Fill if needed",
+							Style:    discordgo.SecondaryButton,
+							CustomID: queueCustomID("waitlist_queue", name),
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Printf("error responding with rank bracket: %v\n", err)
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// actionInterval is how often a member gets another join, leave or
+	// waitlist click, and actionBurst how many they can save up, so a quick
+	// misclick can still be taken back right away.
+	actionInterval = 2 * time.Second
+	actionBurst    = 2
+	// renderInterval is the least time between edits of a queue message.
+	// Changes in between are coalesced into one edit when it's up.
+	renderInterval = time.Second
+	// jobRenderQueue edits a queue message with the changes coalesced since
+	// its last edit.
+	jobRenderQueue = "render_queue"
+)
+
+func renderJobKey(name string) string {
+	return jobRenderQueue + ":" + name
+}
+
+// actionLimiter is a token bucket per member for the queue buttons, so
+// spamming Join and Leave can't run the bot into Discord's rate limits. It
+// has its own lock so spam is turned away without waiting on the queue.
+type actionLimiter struct {
+	sync.Mutex
+	buckets map[string]*actionBucket
+}
+
+type actionBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+func newActionLimiter() *actionLimiter {
+	return &actionLimiter{buckets: make(map[string]*actionBucket)}
+}
+
+// allow takes a token from the user's bucket if there is one, and otherwise
+// returns how long until there will be.
+func (l *actionLimiter) allow(userID string, now time.Time) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	full := actionInterval * actionBurst
+	for id, b := range l.buckets {
+		if now.Sub(b.at) >= full {
+			delete(l.buckets, id)
+		}
+	}
+	b, ok := l.buckets[userID]
+	if !ok {
+		b = &actionBucket{tokens: actionBurst, at: now}
+		l.buckets[userID] = b
+	}
+	b.tokens = math.Min(actionBurst, b.tokens+float64(now.Sub(b.at))/float64(actionInterval))
+	b.at = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(actionInterval))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// limitActions runs next unless the member is clicking faster than the
+// limiter allows, in which case they're told to wait.
+func (q *queueState) limitActions(next interactionHandler) interactionHandler {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		user := interactionUser(i)
+		if ok, wait := q.limiter.allow(user.ID, time.Now()); !ok {
+			actionsLimited.Inc()
+			secs := int(math.Ceil(wait.Seconds()))
+			respondEphemeral(s, i, fmt.Sprintf("You're clicking too fast, try again in %d %s.", secs, pluralize(secs, "second", "seconds")))
+			return
+		}
+		next(s, i)
+	}
+}
+
+// renderLocked edits the queue message with the current state, at most once
+// per renderInterval. Changes sooner than that are left to a render job, and
+// only an edit made right away can return an error.
+// lock must be held
+func (q *queueState) renderLocked(s *discordgo.Session) error {
+	key := renderJobKey(q.name)
+	if _, pending := q.scheduler.jobs[key]; pending {
+		return nil
+	}
+	if next := q.renderedAt.Add(renderInterval); time.Now().Before(next) {
+		q.scheduler.scheduleLocked(jobRenderQueue, key, next, q.name)
+		return nil
+	}
+	q.renderedAt = time.Now()
+	err := q.editQueueMessageLocked(s, "")
+	if err != nil {
+		q.reconcileLocked(err, 0)
+	}
+	return err
+}
+
+// runRenderJobLocked edits the queue message with the coalesced changes, or
+// re-renders it after a failed edit, see retry.go. The second argument, if
+// any, counts the failed attempts.
+// lock must be held
+func (q *queueState) runRenderJobLocked(s *discordgo.Session, j *job) {
+	q.selectQueueLocked(q.queueLocked(j.Args[0]))
+	if q.currentMsgID == "" {
+		return
+	}
+	attempt := 0
+	if len(j.Args) > 1 {
+		attempt, _ = strconv.Atoi(j.Args[1])
+	}
+	q.renderedAt = time.Now()
+	if err := q.editQueueMessageLocked(s, ""); err != nil {
+		log.Printf("error editing queue message: %v\n", err)
+		q.reconcileLocked(err, attempt)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// readyCheckWindow is how long queued players have to confirm they're still
+// around once the queue fills.
+const readyCheckWindow = 2 * time.Minute
+
+// jobReadyCheck expires a ready check once readyCheckWindow is up.
+const jobReadyCheck = "ready_check"
+
+// readyCheck is a running ready check. Players who confirm are tracked in
+// queue.ready so a repeat check after promotions only asks the new ones.
+type readyCheck struct {
+	msgID    string
+	deadline time.Time
+}
+
+// allReadyLocked reports whether everyone in the queue has confirmed.
+// lock must be held
+func (q *queueState) allReadyLocked() bool {
+	for _, m := range q.users {
+		if !q.ready[m.ID] {
+			return false
+		}
+	}
+	return true
+}
+
+// lock must be held
+func (q *queueState) readyCheckContentLocked() string {
+	var waiting, ready []string
+	for _, m := range q.users {
+		if q.ready[m.ID] {
+			ready = append(ready, fmt.Sprintf("<@%s>", m.ID))
+		} else {
+			waiting = append(waiting, fmt.Sprintf("<@%s>", m.ID))
+		}
+	}
+	content := fmt.Sprintf("The queue is full! Ready check: %s, press Ready <t:%d:R> or you'll be dropped.", strings.Join(waiting, ", "), q.readyCheck.deadline.Unix())
+	if len(ready) > 0 {
+		content += "\n-# Ready: " + strings.Join(ready, ", ")
+	}
+	return content
+}
+
+// startReadyCheckLocked asks everyone who hasn't confirmed yet to press Ready
+// before the fill notification goes out. If a check is already running, its
+// message is updated for anyone promoted in the meantime.
+// lock must be held
+func (q *queueState) startReadyCheckLocked(s *discordgo.Session) {
+	if q.readyCheck != nil {
+		content := q.readyCheckContentLocked()
+		if _, err := s.ChannelMessageEdit(q.channelID, q.readyCheck.msgID, content); err != nil {
+			log.Printf("error editing ready check: %v\n", err)
+		}
+		return
+	}
+	check := &readyCheck{deadline: time.Now().Add(readyCheckWindow)}
+	q.readyCheck = check
+	msg := &discordgo.MessageSend{
+		Content: q.readyCheckContentLocked(),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Ready",
+					Style:    discordgo.SuccessButton,
+					CustomID: queueCustomID("ready_confirm", q.name),
+				},
+				discordgo.Button{
+					Label:    "Can't play",
+					Style:    discordgo.SecondaryButton,
+					CustomID: queueCustomID("ready_decline", q.name),
+				},
+			}},
+		},
+	}
+	if q.configs.get(q.guildID).NotifyStyle == notifyStyleSilent {
+		msg.AllowedMentions = &discordgo.MessageAllowedMentions{}
+	}
+	m, err := s.ChannelMessageSendComplex(q.channelID, msg)
+	if err != nil {
+		log.Printf("error sending ready check: %v\n", err)
+		q.readyCheck = nil
+		return
+	}
+	check.msgID = m.ID
+	q.scheduler.scheduleLocked(jobReadyCheck, readyCheckJobKey(q.name), check.deadline, q.name, check.msgID)
+}
+
+func readyCheckJobKey(name string) string {
+	return jobReadyCheck + ":" + name
+}
+
+// runReadyCheckJobLocked expires the ready check the job was scheduled for,
+// if it's still running.
+// lock must be held
+func (q *queueState) runReadyCheckJobLocked(s *discordgo.Session, j *job) {
+	q.selectQueueLocked(q.queueLocked(j.Args[0]))
+	if q.readyCheck != nil && q.readyCheck.msgID == j.Args[1] {
+		q.expireReadyCheckLocked(s)
+	}
+}
+
+// endReadyCheckLocked removes the ready check message, if one is running.
+// lock must be held
+func (q *queueState) endReadyCheckLocked(s *discordgo.Session) {
+	if q.readyCheck == nil {
+		return
+	}
+	if err := s.ChannelMessageDelete(q.channelID, q.readyCheck.msgID); err != nil {
+		log.Printf("error deleting ready check: %v\n", err)
+	}
+	q.readyCheck = nil
+	q.scheduler.cancelLocked(readyCheckJobKey(q.name))
+}
+
+// expireReadyCheckLocked drops everyone who didn't confirm in time and
+// promotes from the waitlist in their place.
+// lock must be held
+func (q *queueState) expireReadyCheckLocked(s *discordgo.Session) {
+	var dropped []*discordgo.User
+	for _, m := range q.users {
+		if !q.ready[m.ID] {
+			dropped = append(dropped, m.User)
+		}
+	}
+	for _, user := range dropped {
+		q.leaveLocked(user)
+		log.Printf("dropped %s (%s) from queue %s after a missed ready check\n", user.Username, user.ID, q.currentMsgID)
+		q.notifyLocked(s, user.ID, notifyRemoved, "You didn't confirm the ready check in time, so you were removed from the standby queue.")
+	}
+	q.endReadyCheckLocked(s)
+	q.promoteLocked()
+	q.refreshLocked(s)
+}
+
+func (q *queueState) handleReadyConfirm(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	user := i.Member.User
+	if q.readyCheck == nil || q.readyCheck.msgID != i.Message.ID {
+		respondEphemeral(s, i, "This ready check is over.")
+		return
+	}
+	if !q.inMainQueueLocked(user.ID) {
+		respondEphemeral(s, i, "You're not in the queue.")
+		return
+	}
+
+	q.ready[user.ID] = true
+	if !q.allReadyLocked() {
+		content := q.readyCheckContentLocked()
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:         content,
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			},
+		}); err != nil {
+			log.Printf("error updating ready check: %v\n", err)
+		}
+		return
+	}
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	q.refreshLocked(s)
+}
+
+func (q *queueState) handleReadyDecline(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if err := respondDeclineReasons(s, i, queueCustomID("ready_reason", interactionQueueName(i))); err != nil {
+		log.Printf("error responding with decline reasons: %v\n", err)
+	}
+}
+
+func (q *queueState) handleReadyReason(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	reason := i.MessageComponentData().Values[0]
+	if reason == "later" {
+		if err := respondDeclineLater(s, i, queueCustomID("ready_later", interactionQueueName(i))); err != nil {
+			log.Printf("error responding with decline modal: %v\n", err)
+		}
+		return
+	}
+	q.readyDecline(s, i, reason)
+}
+
+func (q *queueState) handleReadyLater(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	reason := "later"
+	if when := strings.TrimSpace(modalValue(i.ModalSubmitData(), "when")); when != "" {
+		reason = "later " + when
+	}
+	q.readyDecline(s, i, reason)
+}
+
+// readyDecline takes the player out of a full queue with a reason, letting the
+// waitlist move up without waiting for the ready check to run out.
+func (q *queueState) readyDecline(s *discordgo.Session, i *discordgo.InteractionCreate, reason string) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	if err := respondDeclineRecorded(s, i, reason); err != nil {
+		log.Printf("error responding to decline: %v\n", err)
+	}
+	user := i.Member.User
+	if q.currentMsgID == "" || !q.inMainQueueLocked(user.ID) {
+		return
+	}
+	q.leaveLocked(user)
+	q.recordDeclineLocked(user, reason)
+	q.promoteLocked()
+	q.refreshLocked(s)
+}
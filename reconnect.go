@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// handleReady reconciles after the gateway starts a new session, which it
+// also does at startup, before any guild state exists.
+func (g *guildStates) handleReady(s *discordgo.Session, r *discordgo.Ready) {
+	g.reconcile(s)
+}
+
+// handleResumed reconciles after the gateway resumed a dropped session.
+// Events missed while it was down are replayed, but interactions and edits
+// made in the meantime may not have gone through.
+func (g *guildStates) handleResumed(s *discordgo.Session, r *discordgo.Resumed) {
+	g.reconcile(s)
+}
+
+// reconcile brings every guild's open queue messages back in line with the
+// state, and registers the slash commands in guilds where that failed, e.g.
+// because the bot was disconnected at the time.
+func (g *guildStates) reconcile(s *discordgo.Session) {
+	for _, q := range g.all() {
+		q.reconcileQueues(s)
+		g.registerCommands(q.guildID)
+	}
+}
+
+// reconcileQueues fetches each open queue's message again. Queues whose
+// message was deleted while the bot was away are closed, and the others are
+// re-rendered from the state, along with their channel's game board.
+func (q *queueState) reconcileQueues(s *discordgo.Session) {
+	q.Lock()
+	defer q.Unlock()
+
+	for _, qu := range q.openQueuesLocked() {
+		q.selectQueueLocked(qu)
+		if _, err := s.ChannelMessage(q.channelID, q.currentMsgID); err != nil {
+			if messageGone(err) {
+				log.Printf("closing queue %s after reconnecting, its message is gone: %v\n", q.currentMsgID, err)
+				q.closeQueueAsLocked(s, "Queue closed, its message was deleted", waitlistClosed)
+				continue
+			}
+			log.Printf("error fetching queue message %s after reconnecting: %v\n", q.currentMsgID, err)
+			q.reconcileLocked(err, 0)
+			continue
+		}
+		q.renderedAt = time.Now()
+		q.updateBoardLocked()
+		if err := q.editQueueMessageLocked(s, ""); err != nil {
+			log.Printf("error re-rendering queue message %s after reconnecting: %v\n", q.currentMsgID, err)
+			q.reconcileLocked(err, 0)
+		}
+	}
+	q.saveStateLocked()
+}
+
+// messageGone reports whether err is Discord saying the message or its
+// channel no longer exists.
+func messageGone(err error) bool {
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) || restErr.Message == nil {
+		return false
+	}
+	return restErr.Message.Code == discordgo.ErrCodeUnknownMessage || restErr.Message.Code == discordgo.ErrCodeUnknownChannel
+}
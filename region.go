@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// regions players can pick from. Regions in the same area play together with
+// reasonable ping, so only stacks spanning areas get a warning.
+var regions = []struct {
+	value, name, area string
+}{
+	{"na-east", "NA East", "na"},
+	{"na-west", "NA West", "na"},
+	{"sa", "South America", "sa"},
+	{"eu-west", "EU West", "eu"},
+	{"eu-east", "EU East", "eu"},
+	{"asia", "Asia", "asia"},
+	{"oce", "Oceania", "oce"},
+}
+
+var regionCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-region",
+	Description: "Set the region you play from, used to warn about high ping stacks",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "region",
+			Description: "Your region",
+			Required:    true,
+			Choices:     regionChoices(),
+		},
+	},
+}
+
+func regionChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(regions)+1)
+	for _, r := range regions {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: r.name, Value: r.value})
+	}
+	return append(choices, &discordgo.ApplicationCommandOptionChoice{Name: "Clear", Value: "none"})
+}
+
+func regionName(value string) string {
+	for _, r := range regions {
+		if r.value == value {
+			return r.name
+		}
+	}
+	return value
+}
+
+func regionArea(value string) string {
+	for _, r := range regions {
+		if r.value == value {
+			return r.area
+		}
+	}
+	return value
+}
+
+func (q *queueState) handleRegion(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	region := i.ApplicationCommandData().Options[0].StringValue()
+	user := i.Member.User
+	if region == "none" {
+		delete(q.regions, user.ID)
+		respondEphemeral(s, i, "Cleared your region.")
+		return
+	}
+	q.regions[user.ID] = region
+	respondEphemeral(s, i, fmt.Sprintf("Your region is now %s.", regionName(region)))
+}
+
+// regionWarningLocked groups the queued players by region and returns a
+// warning if they span more than one area, or "" if the stack should have
+// reasonable ping. Players without a region are left out.
+// lock must be held
+func (q *queueState) regionWarningLocked() string {
+	groups := make(map[string][]string)
+	areas := make(map[string]bool)
+	for _, m := range q.users {
+		region, ok := q.regions[m.ID]
+		if !ok {
+			continue
+		}
+		groups[region] = append(groups[region], fmt.Sprintf("<@%s>", m.ID))
+		areas[regionArea(region)] = true
+	}
+	if len(areas) < 2 {
+		return ""
+	}
+
+	var parts []string
+	for region, mentions := range groups {
+		parts = append(parts, fmt.Sprintf("%s: %s", regionName(region), strings.Join(mentions, ", ")))
+	}
+	sort.Strings(parts)
+	return "Heads up, this stack mixes regions so some players may have high ping. " + strings.Join(parts, "; ")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maxSessions is how many filled sessions are remembered.
+	maxSessions = 20
+	// reinviteSessions is how many of the latest sessions count as recent
+	// when looking for players to re-invite.
+	reinviteSessions = 3
+)
+
+// session is a queue that filled up.
+type session struct {
+	Players  []*discordgo.User `json:"players"`
+	FilledAt time.Time         `json:"filled_at"`
+}
+
+// lock must be held
+func (q *queueState) recordSessionLocked() {
+	players := make([]*discordgo.User, len(q.users))
+	for i, user := range q.users {
+		players[i] = user.User
+	}
+	q.sessions = append(q.sessions, session{Players: players, FilledAt: time.Now()})
+	if len(q.sessions) > maxSessions {
+		q.sessions = q.sessions[len(q.sessions)-maxSessions:]
+	}
+}
+
+// checkReinviteLocked DMs opted-in recent players once the queue has been one
+// short for ReinviteAfter.
+// lock must be held
+func (q *queueState) checkReinviteLocked(s *discordgo.Session) {
+	if q.currentMsgID == "" || q.reinvited || q.oneMoreSince.IsZero() || time.Since(q.oneMoreSince) < current(&ReinviteAfter) {
+		return
+	}
+	q.reinvited = true
+
+	recent := q.sessions
+	if len(recent) > reinviteSessions {
+		recent = recent[len(recent)-reinviteSessions:]
+	}
+	invited := make(map[string]bool)
+	for _, sess := range recent {
+		for _, p := range sess.Players {
+			if invited[p.ID] || q.isQueuedLocked(p.ID) {
+				continue
+			}
+			invited[p.ID] = true
+			content := fmt.Sprintf("The queue has been one short for a while. Want the last slot? https://discord.com/channels/%s/%s/%s", q.guildID, q.channelID, q.currentMsgID)
+			q.notifyLocked(s, p.ID, notifyReinvite, content)
+		}
+	}
+}
+
+func (q *queueState) handleReinviteToggle(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	userID := i.Member.User.ID
+	optIn := !q.prefsLocked(userID).Reinvites
+	q.updatePrefsLocked(userID, func(p *userPrefs) {
+		p.Reinvites = optIn
+	})
+	if !optIn {
+		respondEphemeral(s, i, "You will no longer be asked to fill the last slot.")
+		return
+	}
+	respondEphemeral(s, i, "You'll get a DM when a queue is stuck one short after you've played recently.")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// reopenWithin is how long after a queue closes it can be reopened with
+	// its players, for undoing an accidental close.
+	reopenWithin = 30 * time.Minute
+	// reopenOptOutWindow is how long carried over players have to opt out
+	// of a reopened queue before the button goes away.
+	reopenOptOutWindow = 2 * time.Minute
+	// jobReopenOptOut ends the opt-out window of a reopened queue.
+	jobReopenOptOut = "reopen_opt_out"
+)
+
+func reopenJobKey(name string) string {
+	return jobReopenOptOut + ":" + name
+}
+
+// closedQueue is what a queue had when it closed, so it can be reopened.
+// It's only kept in memory, so a restart forgets it.
+type closedQueue struct {
+	// Users are the queued players then the waitlist, in order.
+	Users    []*discordgo.User
+	Size     int
+	Note     string
+	Title    string
+	Game     string
+	ClosedAt time.Time
+}
+
+// rememberClosedLocked keeps the selected queue's players and settings as it
+// closes.
+// lock must be held
+func (q *queueState) rememberClosedLocked() {
+	c := &closedQueue{
+		Size:     q.size,
+		Note:     q.note,
+		Title:    q.title,
+		Game:     q.game,
+		ClosedAt: time.Now(),
+	}
+	for _, m := range append(q.users, q.waitlist...) {
+		c.Users = append(c.Users, m.User)
+	}
+	q.lastClosed = c
+}
+
+// handleReopen opens the queue again with the players it had when it
+// closed, if that was within reopenWithin, and otherwise like the Open
+// button. Carried over players get a chance to opt out.
+func (q *queueState) handleReopen(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	opener := i.Member.User
+	if q.currentMsgID == "" {
+		last := q.lastClosed
+		if last == nil || time.Since(last.ClosedAt) > reopenWithin {
+			last = &closedQueue{}
+		}
+		q.setOpenOptionsLocked(openOptions{note: last.Note, title: last.Title, game: last.Game})
+		if err := q.openQueueLocked(s, opener, true, last.Size, i.ChannelID); err != nil {
+			q.setOpenOptionsLocked(openOptions{})
+			log.Printf("error reopening queue: %v", err)
+			return
+		}
+		q.lastClosed = nil
+		var carried []*discordgo.User
+		for _, user := range last.Users {
+			if user.ID != opener.ID && !q.isQueuedLocked(user.ID) {
+				carried = append(carried, user)
+			}
+		}
+		if len(carried) > 0 {
+			q.addUsersLocked(carried, joinSourceReopen)
+			q.startReopenOptOutLocked(s, carried)
+			log.Printf("queue %s reopened by %s (%s) with %d players carried over\n", q.currentMsgID, opener.Username, opener.ID, len(carried))
+			q.refreshLocked(s)
+		}
+	}
+
+	if err := s.ChannelMessageDelete(i.ChannelID, i.Message.ID); err != nil {
+		log.Printf("error deleting active message: %v\n", err)
+	}
+}
+
+// startReopenOptOutLocked lets the carried over players know they're back in
+// the queue, with a button to opt out for reopenOptOutWindow.
+// lock must be held
+func (q *queueState) startReopenOptOutLocked(s *discordgo.Session, carried []*discordgo.User) {
+	q.reopened = make(map[string]bool)
+	ids := make([]string, len(carried))
+	for idx, user := range carried {
+		q.reopened[user.ID] = true
+		ids[idx] = user.ID
+	}
+	until := time.Now().Add(reopenOptOutWindow)
+	m, err := s.ChannelMessageSendComplex(q.channelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("↩️ The queue is back with %s from last time. Not playing after all? Opt out <t:%d:R>.",
+			userMentions(carried), until.Unix()),
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: ids},
+		Reference:       &discordgo.MessageReference{MessageID: q.currentMsgID, ChannelID: q.channelID},
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Count me out",
+					Style:    discordgo.SecondaryButton,
+					CustomID: queueCustomID("reopen_out", q.name),
+				},
+			}},
+		},
+	})
+	if err != nil {
+		log.Printf("error sending reopen notice: %v\n", err)
+		return
+	}
+	q.reopenMsgID = m.ID
+	q.scheduler.scheduleLocked(jobReopenOptOut, reopenJobKey(q.name), until, q.name)
+}
+
+// handleReopenOut takes a carried over player back out of the reopened
+// queue.
+func (q *queueState) handleReopenOut(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	user := i.Member.User
+	if !q.reopened[user.ID] {
+		respondEphemeral(s, i, "Only players brought back from the last queue can opt out here, use Leave instead.")
+		return
+	}
+	delete(q.reopened, user.ID)
+	if q.isQueuedLocked(user.ID) {
+		q.leaveLocked(user)
+		q.promoteLocked()
+		q.refreshLocked(s)
+	}
+	log.Printf("%s (%s) opted out of reopened queue %s\n", user.Username, user.ID, q.currentMsgID)
+	respondEphemeral(s, i, "You're out of the queue.")
+}
+
+// endReopenOptOutLocked removes the opt-out button once the window is over
+// or the queue closed.
+// lock must be held
+func (q *queueState) endReopenOptOutLocked(s *discordgo.Session) {
+	q.scheduler.cancelLocked(reopenJobKey(q.name))
+	q.reopened = nil
+	if q.reopenMsgID == "" {
+		return
+	}
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         q.reopenMsgID,
+		Channel:    q.channelID,
+		Components: &[]discordgo.MessageComponent{},
+	}); err != nil {
+		log.Printf("error ending reopen opt-out: %v\n", err)
+	}
+	q.reopenMsgID = ""
+}
+
+// lock must be held
+func (q *queueState) runReopenOptOutJobLocked(s *discordgo.Session, j *job) {
+	q.selectQueueLocked(q.queueLocked(j.Args[0]))
+	q.endReopenOptOutLocked(s)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// apiFailureThreshold failures of a Discord API route within
+	// apiFailureWindow are reported, and then not again for the window.
+	apiFailureThreshold = 5
+	apiFailureWindow    = 5 * time.Minute
+	// reportTimeout bounds sending a report so a slow sink can't pile up
+	// goroutines.
+	reportTimeout = 10 * time.Second
+)
+
+// errorReporter sends errors to a Sentry compatible sink like Sentry or
+// GlitchTip. A nil reporter drops everything, so callers needn't check
+// whether reporting is set up.
+type errorReporter struct {
+	storeURL string
+	auth     string
+	client   *http.Client
+
+	sync.Mutex
+	// failures are recent API failures by route, and reported when each
+	// route was last reported
+	failures map[string][]apiFailure
+	reported map[string]time.Time
+	// interactions maps recent interactions' tokens to them, so failures
+	// responding to one can say which it was, see trackInteraction
+	interactions map[string]trackedInteraction
+}
+
+type apiFailure struct {
+	at time.Time
+	// ref is the reference of the interaction the request answered, if any
+	ref string
+}
+
+type trackedInteraction struct {
+	ref     string
+	command string
+	at      time.Time
+}
+
+// newErrorReporter parses a DSN like https://key@host/project. It returns
+// nil if dsn is empty.
+func newErrorReporter(dsn string) (*errorReporter, error) {
+	if dsn == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parsing error DSN: %w", err)
+	}
+	project := strings.TrimPrefix(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || project == "" || u.Host == "" {
+		return nil, fmt.Errorf("error DSN should look like https://key@host/project")
+	}
+	prefix := ""
+	if idx := strings.LastIndex(project, "/"); idx >= 0 {
+		prefix, project = "/"+project[:idx], project[idx+1:]
+	}
+	return &errorReporter{
+		storeURL:     fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project),
+		auth:         fmt.Sprintf("Sentry sentry_version=7, sentry_client=discord-standby-bot/1.0, sentry_key=%s", u.User.Username()),
+		client:       &http.Client{Timeout: reportTimeout},
+		failures:     make(map[string][]apiFailure),
+		reported:     make(map[string]time.Time),
+		interactions: make(map[string]trackedInteraction),
+	}, nil
+}
+
+// reportEvent is the part of Sentry's event payload the bot fills in.
+type reportEvent struct {
+	EventID   string            `json:"event_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Level     string            `json:"level"`
+	Platform  string            `json:"platform"`
+	Logger    string            `json:"logger"`
+	Message   string            `json:"message"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Extra     map[string]any    `json:"extra,omitempty"`
+}
+
+// capture sends message in the background.
+func (r *errorReporter) capture(level, message string, tags map[string]string, extra map[string]any) {
+	if r == nil {
+		return
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	event := reportEvent{
+		EventID:   hex.EncodeToString(id),
+		Timestamp: time.Now().UTC(),
+		Level:     level,
+		Platform:  "go",
+		Logger:    "discord-standby-bot",
+		Message:   message,
+		Tags:      tags,
+		Extra:     extra,
+	}
+	go func() {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("error encoding error report: %v\n", err)
+			return
+		}
+		req, err := http.NewRequest(http.MethodPost, r.storeURL, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("error sending error report: %v\n", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Sentry-Auth", r.auth)
+		resp, err := r.client.Do(req)
+		if err != nil {
+			log.Printf("error sending error report: %v\n", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("error sending error report: %s\n", resp.Status)
+		}
+	}()
+}
+
+// recoverInteraction reports a panic while handling the interaction, with
+// what the interaction was, and lets the bot keep running. It must be
+// deferred.
+func (r *errorReporter) recoverInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	stack := string(debug.Stack())
+	ref := interactionRef(i)
+	log.Printf("interaction %s: panic: %v\n%s", ref, p, stack)
+
+	tags := map[string]string{
+		"ref":              ref,
+		"guild":            interactionGuildID(i),
+		"interaction_type": i.Type.String(),
+	}
+	if user := interactionUser(i); user != nil {
+		tags["user"] = user.ID
+	}
+	extra := map[string]any{"stack": stack, "channel": i.ChannelID}
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		extra["command"] = i.ApplicationCommandData().Name
+	case discordgo.InteractionMessageComponent:
+		extra["custom_id"] = i.MessageComponentData().CustomID
+	case discordgo.InteractionModalSubmit:
+		extra["custom_id"] = i.ModalSubmitData().CustomID
+	}
+	r.capture("fatal", fmt.Sprintf("panic: %v", p), tags, extra)
+	respondError(s, i, "Something went wrong, try again.")
+}
+
+// recoverBackground reports a panic in work outside an interaction, like the
+// scheduler or a gateway event, and lets the bot keep running. It must be
+// deferred, after the lock the work holds so the lock is released too.
+func (r *errorReporter) recoverBackground(what string, tags map[string]string) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	stack := string(debug.Stack())
+	log.Printf("%s: panic: %v\n%s", what, p, stack)
+	r.capture("fatal", fmt.Sprintf("panic in %s: %v", what, p), tags, map[string]any{"stack": stack})
+}
+
+// trackInteraction remembers the interaction's token until it expires, so
+// API failures on its responses and followups, whose paths carry the token,
+// are reported with its reference.
+func (r *errorReporter) trackInteraction(i *discordgo.InteractionCreate) {
+	if r == nil {
+		return
+	}
+	t := trackedInteraction{ref: interactionRef(i), at: time.Now()}
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		t.command = i.ApplicationCommandData().Name
+	case discordgo.InteractionMessageComponent:
+		t.command = i.MessageComponentData().CustomID
+	case discordgo.InteractionModalSubmit:
+		t.command = i.ModalSubmitData().CustomID
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	for token, tracked := range r.interactions {
+		if t.at.Sub(tracked.at) > interactionTokenTTL {
+			delete(r.interactions, token)
+		}
+	}
+	r.interactions[i.Token] = t
+}
+
+// interactionForLocked returns the tracked interaction whose token is in
+// the path.
+// lock must be held
+func (r *errorReporter) interactionForLocked(path string) (trackedInteraction, bool) {
+	for _, part := range strings.Split(path, "/") {
+		if t, ok := r.interactions[part]; ok {
+			return t, true
+		}
+	}
+	return trackedInteraction{}, false
+}
+
+// snowflakePattern matches IDs in API paths, so failures are grouped by
+// route rather than by message or channel.
+var snowflakePattern = regexp.MustCompile(`/\d{15,}`)
+
+// apiFailure records a failed Discord API request and reports it once its
+// route has failed apiFailureThreshold times within apiFailureWindow.
+func (r *errorReporter) apiFailure(req *http.Request, reason string, status int) {
+	if r == nil {
+		return
+	}
+	route := req.Method + " " + snowflakePattern.ReplaceAllString(req.URL.Path, "/:id")
+	now := time.Now()
+
+	r.Lock()
+	var recent []apiFailure
+	for _, f := range r.failures[route] {
+		if now.Sub(f.at) < apiFailureWindow {
+			recent = append(recent, f)
+		}
+	}
+	failure := apiFailure{at: now}
+	if t, ok := r.interactionForLocked(req.URL.Path); ok {
+		failure.ref = t.ref
+		if t.command != "" {
+			failure.ref += " " + t.command
+		}
+	}
+	recent = append(recent, failure)
+	r.failures[route] = recent
+	report := len(recent) >= apiFailureThreshold && now.Sub(r.reported[route]) >= apiFailureWindow
+	if report {
+		r.reported[route] = now
+	}
+	r.Unlock()
+
+	if !report {
+		return
+	}
+	extra := map[string]any{"failures": len(recent), "window": apiFailureWindow.String(), "status": status}
+	// Which interactions the failing requests answered, with what was
+	// used, to look up in the logs by reference.
+	var refs []string
+	for _, f := range recent {
+		if f.ref != "" {
+			refs = append(refs, f.ref)
+		}
+	}
+	if len(refs) > 0 {
+		extra["interactions"] = refs
+	}
+	r.capture("error", fmt.Sprintf("Discord API %s failing: %s", route, reason),
+		map[string]string{"route": route, "reason": reason}, extra)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// apiRetryDelay is about how long a failed Discord API request waits
+	// before its retry, plus up to as much again of jitter. A Retry-After
+	// from Discord is waited instead, unless it's longer than
+	// maxAPIRetryAfter, in which case the request isn't retried.
+	apiRetryDelay    = 250 * time.Millisecond
+	maxAPIRetryAfter = time.Second
+	// reconcileAttempts is how many times a queue message that couldn't be
+	// edited is re-rendered from the state, waiting reconcileBackoff, then
+	// twice that and so on in between.
+	reconcileAttempts = 5
+	reconcileBackoff  = 5 * time.Second
+)
+
+// retryTransport retries a Discord API request once, after a short delay,
+// when it failed in a way that's likely to pass: a dropped connection or a
+// server error. The delay is kept short since requests are mostly sent
+// with the guild lock held; a queue message that still couldn't be edited
+// is re-rendered later by reconcileLocked instead. Creating things isn't
+// retried, since Discord may have created it before failing and a retry
+// would post it twice. discordgo already retries rate limits and
+// immediately retries bad gateways.
+type retryTransport struct {
+	base http.RoundTripper
+	// sleep waits d unless ctx is done first, time.After if nil.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if !retryableRequest(req, resp, err) || req.Context().Err() != nil {
+		return resp, err
+	}
+	delay, ok := retryDelay(resp, time.Now())
+	if !ok {
+		return resp, err
+	}
+	try := req
+	if req.GetBody != nil {
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return resp, err
+		}
+		try = req.Clone(req.Context())
+		try.Body = body
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	sleep := t.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	if err := sleep(req.Context(), delay); err != nil {
+		return nil, err
+	}
+	apiRetried.Inc()
+	return t.base.RoundTrip(try)
+}
+
+// retryDelay returns how long to wait before retrying after resp: its
+// Retry-After if it has a valid one, or apiRetryDelay with jitter. It reports false
+// if Discord asked to wait longer than maxAPIRetryAfter.
+func retryDelay(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp != nil {
+		v := resp.Header.Get("Retry-After")
+		after, parsed := time.Duration(0), false
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			after, parsed = time.Duration(secs*float64(time.Second)), true
+		} else if at, err := http.ParseTime(v); err == nil {
+			after, parsed = at.Sub(now), true
+		}
+		if parsed {
+			return max(after, 0), after <= maxAPIRetryAfter
+		}
+	}
+	return apiRetryDelay + rand.N(apiRetryDelay), true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func retryableRequest(req *http.Request, resp *http.Response, err error) bool {
+	if req.Method == http.MethodPost || (req.Body != nil && req.GetBody == nil) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// transientAPIError reports whether err might not happen again, as opposed
+// to Discord refusing the request, e.g. because the message was deleted.
+func transientAPIError(err error) bool {
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil {
+		status := restErr.Response.StatusCode
+		return status >= 500 || status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// reconcileLocked schedules re-rendering the queue message from the state
+// after it couldn't be edited, so a transient failure doesn't leave it out
+// of date. attempt counts the re-renders that already failed.
+// lock must be held
+func (q *queueState) reconcileLocked(err error, attempt int) {
+	if !transientAPIError(err) {
+		return
+	}
+	if attempt >= reconcileAttempts {
+		log.Printf("giving up re-rendering queue message %s after %d attempts: %v\n", q.currentMsgID, attempt, err)
+		return
+	}
+	q.scheduler.scheduleLocked(jobRenderQueue, renderJobKey(q.name), time.Now().Add(reconcileBackoff<<attempt), q.name, strconv.Itoa(attempt+1))
+}
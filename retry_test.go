@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyTransport fails the first request with status and then succeeds.
+type flakyTransport struct {
+	status     int
+	retryAfter string
+	calls      int
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls++
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(strings.NewReader(""))}
+	if f.calls == 1 {
+		resp.StatusCode = f.status
+		if f.retryAfter != "" {
+			resp.Header.Set("Retry-After", f.retryAfter)
+		}
+	}
+	return resp, nil
+}
+
+func TestRetryTransportWaits(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		retryAfter string
+		min, max   time.Duration
+		calls      int
+	}{
+		{name: "jitter", min: apiRetryDelay, max: 2 * apiRetryDelay, calls: 2},
+		{name: "retry after", retryAfter: "0.5", min: 500 * time.Millisecond, max: 500 * time.Millisecond, calls: 2},
+		{name: "retry after too long", retryAfter: "30", calls: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			base := &flakyTransport{status: http.StatusServiceUnavailable, retryAfter: tt.retryAfter}
+			var waited []time.Duration
+			rt := retryTransport{base: base, sleep: func(ctx context.Context, d time.Duration) error {
+				waited = append(waited, d)
+				return nil
+			}}
+			req, _ := http.NewRequest(http.MethodPatch, "https://discord.com/api/v10/channels/1/messages/2", nil)
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if base.calls != tt.calls {
+				t.Errorf("sent %d requests, want %d", base.calls, tt.calls)
+			}
+			if tt.calls == 1 {
+				if len(waited) != 0 || resp.StatusCode != http.StatusServiceUnavailable {
+					t.Errorf("waited %v and got status %d, want no wait and the 503", waited, resp.StatusCode)
+				}
+				return
+			}
+			if len(waited) != 1 || waited[0] < tt.min || waited[0] > tt.max {
+				t.Errorf("waited %v, want one wait between %s and %s", waited, tt.min, tt.max)
+			}
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("got status %d after the retry, want 200", resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var roleCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-role",
+	Description: "Set the role you main in queues with a role composition",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "role",
+			Description: "Your main role, e.g. tank; empty means you'll play anything",
+			MaxLength:   50,
+		},
+	},
+}
+
+// roleAssignment is who plays what once a queue with a role composition
+// fills.
+type roleAssignment struct {
+	// roles maps user IDs to the role they play
+	roles map[string]string
+	// flexed are the players who couldn't play their main role
+	flexed []string
+}
+
+// assignRoles gives each player a slot in comp. Players keep their main role
+// while it has slots left, those who flexed most recently going first, so
+// the turn to flex goes to whoever flexed longest ago. Everyone else plays
+// the slots that are left over.
+func assignRoles(comp []string, players []*discordgo.User, mains map[string]string, lastFlexed map[string]time.Time) roleAssignment {
+	open := make(map[string]int)
+	for _, r := range comp {
+		open[strings.ToLower(r)]++
+	}
+	order := append([]*discordgo.User(nil), players...)
+	sort.SliceStable(order, func(a, b int) bool {
+		return lastFlexed[order[a].ID].After(lastFlexed[order[b].ID])
+	})
+
+	a := roleAssignment{roles: make(map[string]string)}
+	var rest []*discordgo.User
+	for _, p := range order {
+		main := strings.ToLower(mains[p.ID])
+		if open[main] > 0 {
+			open[main]--
+			a.roles[p.ID] = main
+			continue
+		}
+		if main != "" {
+			a.flexed = append(a.flexed, p.ID)
+		}
+		rest = append(rest, p)
+	}
+	for _, r := range comp {
+		r = strings.ToLower(r)
+		for ; open[r] > 0 && len(rest) > 0; open[r]-- {
+			a.roles[rest[0].ID] = r
+			rest = rest[1:]
+		}
+	}
+	return a
+}
+
+// rolesLineLocked describes who plays what in the selected queue if it has
+// a role composition the size of the queue, and returns who flexed so
+// recordFlexLocked can remember them once it's posted.
+// lock must be held
+func (q *queueState) rolesLineLocked(cfg guildConfig) (string, []string) {
+	comp := cfg.QueueRoles[q.name]
+	if len(comp) != q.size || len(q.users) != q.size {
+		return "", nil
+	}
+	players := make([]*discordgo.User, len(q.users))
+	for idx, m := range q.users {
+		players[idx] = m.User
+	}
+	a := assignRoles(comp, players, q.mainRoles, q.lastFlexed)
+
+	var (
+		parts []string
+		seen  = make(map[string]bool)
+	)
+	for _, r := range comp {
+		r = strings.ToLower(r)
+		if seen[r] {
+			continue
+		}
+		seen[r] = true
+		var who []*discordgo.User
+		for _, p := range players {
+			if a.roles[p.ID] == r {
+				who = append(who, p)
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s %s", r, userMentions(who)))
+	}
+	line := "**Roles:** " + strings.Join(parts, " · ")
+	if len(a.flexed) > 0 {
+		mentions := make([]string, len(a.flexed))
+		for idx, id := range a.flexed {
+			mentions[idx] = fmt.Sprintf("<@%s>", id)
+		}
+		line += fmt.Sprintf("\n-# %s %s this time, it's their turn.", strings.Join(mentions, ", "), pluralize(len(mentions), "flexes", "flex"))
+	}
+	return line, a.flexed
+}
+
+// recordFlexLocked remembers that the players flexed, so they keep their
+// main role next time.
+// lock must be held
+func (q *queueState) recordFlexLocked(userIDs []string) {
+	now := time.Now()
+	for _, id := range userIDs {
+		q.lastFlexed[id] = now
+	}
+}
+
+func (q *queueState) handleRole(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	user := i.Member.User
+	opt, ok := optionMap(i.ApplicationCommandData().Options)["role"]
+	if !ok || strings.TrimSpace(opt.StringValue()) == "" {
+		delete(q.mainRoles, user.ID)
+		respondEphemeral(s, i, "You'll play whatever role is left."+q.lastFlexedNoteLocked(user.ID))
+		return
+	}
+	role := strings.ToLower(strings.TrimSpace(opt.StringValue()))
+	known := q.configuredRolesLocked()
+	if !known[role] {
+		if len(known) == 0 {
+			respondEphemeral(s, i, "No queue here has a role composition.")
+			return
+		}
+		names := make([]string, 0, len(known))
+		for r := range known {
+			names = append(names, r)
+		}
+		sort.Strings(names)
+		respondEphemeral(s, i, fmt.Sprintf("Pick one of %s.", strings.Join(names, ", ")))
+		return
+	}
+	q.mainRoles[user.ID] = role
+	log.Printf("%s (%s) set their main role to %s\n", user.Username, user.ID, role)
+	respondEphemeral(s, i, fmt.Sprintf("Your main role is %s.", role)+q.lastFlexedNoteLocked(user.ID))
+}
+
+// configuredRolesLocked returns the roles in every queue's composition.
+// lock must be held
+func (q *queueState) configuredRolesLocked() map[string]bool {
+	known := make(map[string]bool)
+	for _, comp := range q.configs.get(q.guildID).QueueRoles {
+		for _, r := range comp {
+			known[strings.ToLower(r)] = true
+		}
+	}
+	return known
+}
+
+// lock must be held
+func (q *queueState) lastFlexedNoteLocked(userID string) string {
+	at, ok := q.lastFlexed[userID]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("\n-# You last flexed <t:%d:R>.", at.Unix())
+}
+
+func (q *queueState) configRoles(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	var name string
+	if opt, ok := opts["name"]; ok {
+		name = normalizeQueueName(opt.StringValue())
+	}
+	var comp []string
+	if opt, ok := opts["roles"]; ok {
+		comp = splitList(strings.ToLower(opt.StringValue()))
+	}
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		if len(comp) == 0 {
+			delete(cfg.QueueRoles, name)
+			return
+		}
+		if cfg.QueueRoles == nil {
+			cfg.QueueRoles = make(map[string][]string)
+		}
+		cfg.QueueRoles[name] = comp
+	}); err != nil {
+		return "", err
+	}
+	if len(comp) == 0 {
+		return "The queue no longer has a role composition.", nil
+	}
+	return fmt.Sprintf("The queue needs %s. Once a queue of %d fills, players get their /standby-role and take turns flexing.",
+		strings.Join(comp, ", "), len(comp)), nil
+}
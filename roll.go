@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// rollMemory is how long a pick from /standby-roll lowers the odds of being
+// picked again.
+const rollMemory = 7 * 24 * time.Hour
+
+var rollCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-roll",
+	Description: "Pick a random player from the full queue, e.g. to host or fill",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "for",
+			Description: "What they're picked for, e.g. \"hosts\" or \"buys pizza\"",
+			MaxLength:   100,
+		},
+		queueNameOption("Queue to pick from"),
+	},
+}
+
+// rollWeights gives each player a weight of 1 / (1 + picks), counting their
+// picks within rollMemory, so whoever was picked least lately is likeliest.
+func rollWeights(players []*discordgo.User, picks map[string][]time.Time, now time.Time) []float64 {
+	weights := make([]float64, len(players))
+	for idx, p := range players {
+		recent := 0
+		for _, at := range picks[p.ID] {
+			if now.Sub(at) < rollMemory {
+				recent++
+			}
+		}
+		weights[idx] = 1 / float64(1+recent)
+	}
+	return weights
+}
+
+// weightedPick returns a random index into weights, each chosen in
+// proportion to its weight.
+func weightedPick(weights []float64) int {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	r := rand.Float64() * total
+	for idx, w := range weights {
+		if r < w {
+			return idx
+		}
+		r -= w
+	}
+	return len(weights) - 1
+}
+
+// handleRoll picks one of the queued players for something, weighted away
+// from whoever was picked recently. Anyone in the full queue, its opener
+// and admins can roll.
+func (q *queueState) handleRoll(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	data := i.ApplicationCommandData()
+	opts := optionMap(data.Options)
+	q.selectQueueLocked(q.commandQueueLocked(i.ChannelID, data.Options))
+	user := i.Member.User
+	if q.currentMsgID == "" || len(q.users) < q.size {
+		respondEphemeral(s, i, "The queue needs to be full to roll.")
+		return
+	}
+	if q.queuedMemberLocked(user.ID) == nil && !q.canManageLocked(i.Member) {
+		respondEphemeral(s, i, "Only players in the queue can roll.")
+		return
+	}
+	what := "is picked"
+	if opt, ok := opts["for"]; ok && strings.TrimSpace(opt.StringValue()) != "" {
+		what = strings.TrimSpace(opt.StringValue())
+	}
+
+	now := time.Now()
+	q.pruneRollPicksLocked(now)
+	players := make([]*discordgo.User, len(q.users))
+	for idx, m := range q.users {
+		players[idx] = m.User
+	}
+	weights := rollWeights(players, q.rollPicks, now)
+	picked := players[weightedPick(weights)]
+	q.rollPicks[picked.ID] = append(q.rollPicks[picked.ID], now)
+
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	order := make([]int, len(players))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return weights[order[a]] > weights[order[b]]
+	})
+	odds := make([]string, len(order))
+	for n, idx := range order {
+		odds[n] = fmt.Sprintf("<@%s> %.0f%%", players[idx].ID, 100*weights[idx]/total)
+	}
+
+	log.Printf("%s (%s) rolled %s (%s) on queue %s\n", user.Username, user.ID, picked.Username, picked.ID, q.currentMsgID)
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:         fmt.Sprintf("🎲 <@%s> %s!\n-# Odds: %s", picked.ID, what, strings.Join(odds, ", ")),
+			AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{picked.ID}},
+		},
+	}); err != nil {
+		log.Printf("error posting roll: %v\n", err)
+	}
+	q.saveStateLocked()
+}
+
+// pruneRollPicksLocked forgets picks older than rollMemory.
+// lock must be held
+func (q *queueState) pruneRollPicksLocked(now time.Time) {
+	for id, picks := range q.rollPicks {
+		kept := picks[:0]
+		for _, at := range picks {
+			if now.Sub(at) < rollMemory {
+				kept = append(kept, at)
+			}
+		}
+		if len(kept) == 0 {
+			delete(q.rollPicks, id)
+			continue
+		}
+		q.rollPicks[id] = kept
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// interactionHandler handles a component or modal interaction. Arguments
+// encoded in the custom ID are read with customIDArgs.
+type interactionHandler func(s *discordgo.Session, i *discordgo.InteractionCreate)
+
+// interactionRouter dispatches interactions by the namespace of their custom
+// ID, the part before the first ":". The rest holds arguments separated by
+// ":", e.g. "veto:<match>:<map>" or "join_queue:<queue name>".
+type interactionRouter map[string]interactionHandler
+
+func (r interactionRouter) handle(namespace string, h interactionHandler) {
+	if _, ok := r[namespace]; ok {
+		panic("duplicate interaction route " + namespace)
+	}
+	r[namespace] = h
+}
+
+func (r interactionRouter) dispatch(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	customID := interactionCustomID(i)
+	namespace, _, _ := strings.Cut(customID, ":")
+	h, ok := r[namespace]
+	if !ok {
+		log.Printf("no route for interaction %q\n", customID)
+		return
+	}
+	if i.Type == discordgo.InteractionMessageComponent {
+		componentClicks.WithLabelValues(namespace).Inc()
+	}
+	h(s, i)
+}
+
+// interactionCustomID returns the custom ID of a component or modal
+// interaction.
+func interactionCustomID(i *discordgo.InteractionCreate) string {
+	switch i.Type {
+	case discordgo.InteractionMessageComponent:
+		return i.MessageComponentData().CustomID
+	case discordgo.InteractionModalSubmit:
+		return i.ModalSubmitData().CustomID
+	}
+	return ""
+}
+
+// customIDArgs returns the arguments after the custom ID's namespace. There
+// is always at least one, empty if the custom ID has no arguments.
+func customIDArgs(i *discordgo.InteractionCreate) []string {
+	_, args, _ := strings.Cut(interactionCustomID(i), ":")
+	return strings.Split(args, ":")
+}
+
+// registerRoutes sets up the component and modal routes. Custom IDs already
+// posted in channels must keep routing, so namespaces are never renamed.
+func (q *queueState) registerRoutes() {
+	q.componentRoutes = make(interactionRouter)
+	r := q.componentRoutes
+	r.handle("close_queue", func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if !q.rejectClose(s, i) {
+			q.handleQueueButton(s, i)
+		}
+	})
+	r.handle("open_queue", q.guardJoin(q.handleQueueButton))
+	r.handle("join_queue", q.limitActions(q.guardJoin(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if !q.rejectRank(s, i) {
+			q.handleQueueButton(s, i)
+		}
+	})))
+	r.handle("waitlist_queue", q.limitActions(q.guardJoin(q.handleQueueButton)))
+	r.handle("leave_queue", q.limitActions(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if !q.handleLeaveButton(s, i) {
+			q.handleQueueButton(s, i)
+		}
+	}))
+	r.handle("leave_handoff", q.handleLeaveHandoff)
+	r.handle("decline_queue", q.limitActions(q.handleDeclineButton))
+	r.handle("decline_reason", q.handleDeclineReason)
+	r.handle("join_if_select", q.handleJoinIfSelect)
+	r.handle("bring_duo", q.limitActions(q.handleBringDuo))
+	r.handle("share_lobby_code", q.handleLobbyCodeButton)
+	r.handle("split_teams", q.handleSplitTeams)
+	r.handle("last_call", q.handleLastCall)
+	r.handle("reopen_queue", q.guardJoin(q.handleReopen))
+	r.handle("reopen_out", q.handleReopenOut)
+	r.handle("undo_close", q.handleUndoClose)
+	r.handle("help_page", q.handleHelpPage)
+	r.handle("map_vote", q.handleMapVote)
+	r.handle("rsvp", q.handleRSVP)
+	r.handle("rsvp_join", q.handleRSVPJoin)
+	r.handle("ready_confirm", q.handleReadyConfirm)
+	r.handle("ready_decline", q.handleReadyDecline)
+	r.handle("ready_reason", q.handleReadyReason)
+	r.handle("mvp_vote", q.handleMVPVote)
+	r.handle("score_confirm", q.handleScoreButton)
+	r.handle("score_dispute", q.handleScoreButton)
+	r.handle("veto", q.handleVetoButton)
+	r.handle("notify_settings", q.handleNotifySettings)
+	r.handle("notify_toggle", q.handleNotifyToggle)
+	r.handle("resume_subs", q.handleResumeSubscriptions)
+	for _, id := range []string{"setup_channel", "setup_admin_roles", "setup_notify", "setup_size", "setup_save"} {
+		r.handle(id, q.setupRoute(id))
+	}
+
+	q.modalRoutes = make(interactionRouter)
+	m := q.modalRoutes
+	m.handle("decline_later", q.handleDeclineLater)
+	m.handle("setup_size", q.setupRoute("setup_size_submit"))
+	m.handle("lobby_code", q.handleLobbyCode)
+	m.handle("ready_later", q.handleReadyLater)
+}
+
+// guardJoin runs next unless the user doesn't meet the queue's requirements
+// to join, in which case they've already been told why.
+func (q *queueState) guardJoin(next interactionHandler) interactionHandler {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if reason := q.joinBlocked(s, i); reason != "" {
+			respondEphemeral(s, i, "This queue "+reason+".")
+			return
+		}
+		next(s, i)
+	}
+}
+
+// joinBlocked is joinBlockedLocked for the interaction's user and queue.
+func (q *queueState) joinBlocked(s *discordgo.Session, i *discordgo.InteractionCreate) string {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	return q.joinBlockedLocked(s, i.Member.User.ID)
+}
+
+// joinBlockedLocked is joinRuleLocked plus the voice rule, for joins someone
+// asked for: the user needs to be in the queue's voice channel if it has one.
+// lock must be held
+func (q *queueState) joinBlockedLocked(s *discordgo.Session, userID string) string {
+	if reason := q.joinRuleLocked(userID); reason != "" {
+		return reason
+	}
+	vq := q.configs.get(q.guildID).VoiceQueues[q.name]
+	if vq == nil {
+		return ""
+	}
+	if vs, err := s.State.VoiceState(q.guildID, userID); err == nil && vs.ChannelID == vq.ChannelID {
+		return ""
+	}
+	return fmt.Sprintf("needs players in <#%s> first", vq.ChannelID)
+}
+
+func (q *queueState) setupRoute(customID string) interactionHandler {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		q.handleSetupComponent(s, i, customID)
+	}
+}
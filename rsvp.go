@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// jobScheduleReminder DMs a scheduled queue's RSVPs ReminderLead before it
+// opens.
+const jobScheduleReminder = "schedule_reminder"
+
+// rsvpButtons are shown on a scheduled queue's countdown message.
+func rsvpButtons() []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "RSVP",
+				Style:    discordgo.PrimaryButton,
+				CustomID: "rsvp",
+				Emoji:    &discordgo.ComponentEmoji{Name: "📅"},
+			},
+		}},
+	}
+}
+
+// scheduledQueueLocked returns the scheduled queue with the countdown
+// message, or nil if it already opened.
+// lock must be held
+func (q *queueState) scheduledQueueLocked(messageID string) *scheduledQueue {
+	for _, sq := range q.schedules {
+		if sq.MessageID == messageID {
+			return sq
+		}
+	}
+	return nil
+}
+
+// handleRSVP adds or removes the user from the RSVPs on the countdown.
+func (q *queueState) handleRSVP(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	sq := q.scheduledQueueLocked(i.Message.ID)
+	if sq == nil {
+		respondEphemeral(s, i, "This queue already opened.")
+		return
+	}
+	user := i.Member.User
+	idx := slices.IndexFunc(sq.RSVPs, func(u *discordgo.User) bool { return u.ID == user.ID })
+	var content string
+	if idx >= 0 {
+		sq.RSVPs = slices.Delete(sq.RSVPs, idx, idx+1)
+		sq.Joining = slices.DeleteFunc(sq.Joining, func(id string) bool { return id == user.ID })
+		content = "Removed your RSVP."
+	} else {
+		sq.RSVPs = append(sq.RSVPs, user)
+		content = fmt.Sprintf("You're going! The queue opens <t:%d:R>.", sq.At.Unix())
+		if lead := current(&ReminderLead); lead > 0 && !q.prefsLocked(user.ID).NoReminders {
+			content += fmt.Sprintf(" I'll DM you %s before.", humanDuration(lead))
+		}
+	}
+	if _, err := s.ChannelMessageEditEmbed(sq.ChannelID, sq.MessageID, createCountdownEmbed(sq, q.configs.get(q.guildID).Embed)); err != nil {
+		log.Printf("error updating countdown message: %v\n", err)
+	}
+	respondEphemeral(s, i, content)
+}
+
+// scheduleReminderLocked schedules the RSVP reminder for sq, unless it opens
+// sooner than ReminderLead.
+// lock must be held
+func (q *queueState) scheduleReminderLocked(sq *scheduledQueue) {
+	lead := current(&ReminderLead)
+	at := sq.At.Add(-lead)
+	if lead <= 0 || at.Before(time.Now()) {
+		return
+	}
+	q.scheduler.scheduleLocked(jobScheduleReminder, jobScheduleReminder+":"+sq.MessageID, at, sq.MessageID)
+}
+
+// runScheduleReminderJobLocked DMs the RSVPs of the scheduled queue the job
+// was scheduled for, with a button to be added as soon as it opens.
+// lock must be held
+func (q *queueState) runScheduleReminderJobLocked(s *discordgo.Session, j *job) {
+	sq := q.scheduledQueueLocked(j.Args[0])
+	if sq == nil {
+		return
+	}
+	msg := &discordgo.MessageSend{
+		Content: fmt.Sprintf("%s opens <t:%d:R>. https://discord.com/channels/%s/%s/%s",
+			sq.title(), sq.At.Unix(), q.guildID, sq.ChannelID, sq.MessageID),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Join when it opens",
+					Style:    discordgo.SuccessButton,
+					CustomID: "rsvp_join:" + sq.MessageID + ":" + q.guildID,
+				},
+			}},
+		},
+	}
+	for _, u := range sq.RSVPs {
+		q.notifyMessageLocked(s, u.ID, notifyReminder, msg)
+	}
+}
+
+// handleRSVPJoin marks the user to be added to the queue as soon as it opens.
+// It's clicked in a DM, so there's no member.
+func (q *queueState) handleRSVPJoin(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	user := interactionUser(i)
+	content := i.Message.Content + "\n✅ You'll be added to the queue as soon as it opens."
+	sq := q.scheduledQueueLocked(customIDArgs(i)[0])
+	switch {
+	case sq == nil:
+		content = i.Message.Content + "\nThe queue already opened, join it from the channel."
+	case !slices.ContainsFunc(sq.RSVPs, func(u *discordgo.User) bool { return u.ID == user.ID }):
+		content = i.Message.Content + "\nYou're no longer on the RSVP list."
+	case !slices.Contains(sq.Joining, user.ID):
+		sq.Joining = append(sq.Joining, user.ID)
+	}
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	}); err != nil {
+		log.Printf("error responding to RSVP join: %v\n", err)
+	}
+}
+
+// joinRSVPsLocked adds the RSVPs who asked to join to the scheduled queue
+// that just opened. Anyone the Join button would turn away, or everyone if
+// the queue needs its voice channel, is sent the link instead.
+// lock must be held
+func (q *queueState) joinRSVPsLocked(s *discordgo.Session, sq *scheduledQueue) {
+	if len(sq.Joining) == 0 {
+		return
+	}
+	cfg := q.configs.get(q.guildID)
+	link := fmt.Sprintf("https://discord.com/channels/%s/%s/%s", q.guildID, q.channelID, q.currentMsgID)
+	for _, u := range sq.RSVPs {
+		if !slices.Contains(sq.Joining, u.ID) || q.isQueuedLocked(u.ID) {
+			continue
+		}
+		if cfg.VoiceQueues[q.name] != nil || !q.canJoinLocked(u.ID) {
+			q.notifyLocked(s, u.ID, notifyReminder, "The queue is open, but I couldn't add you automatically. Join here: "+link)
+			continue
+		}
+		q.addUsersLocked(q.withDuoLocked(u), joinSourceRSVP)
+		log.Printf("%s (%s) joined queue %s from an RSVP\n", u.Username, u.ID, q.currentMsgID)
+	}
+	q.refreshLocked(s)
+}
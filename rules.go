@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// printAlertRules writes Prometheus alerting and recording rules for the
+// bot's metrics, ready to be loaded with rule_files.
+func printAlertRules(w io.Writer) error {
+	_, err := fmt.Fprintf(w, `groups:
+  - name: discord-standby-bot.rules
+    rules:
+      - record: standby:%[6]s:rate5m
+        expr: sum(rate(%[6]s[5m]))
+      - record: standby:%[6]s_by_reason:rate5m
+        expr: sum(rate(%[6]s[5m])) by (reason)
+      - record: standby:%[7]s:p95
+        expr: histogram_quantile(0.95, sum(rate(%[7]s_bucket[5m])) by (le))
+  - name: discord-standby-bot.alerts
+    rules:
+      - alert: StandbyBotDown
+        expr: absent(%[5]s)
+        for: 5m
+        labels:
+          severity: critical
+        annotations:
+          summary: Standby bot is not reporting metrics
+      - alert: StandbyGatewayDown
+        expr: %[5]s == 0
+        for: 5m
+        labels:
+          severity: critical
+        annotations:
+          summary: Standby bot is disconnected from the Discord gateway
+      - alert: StandbyQueueStuck
+        expr: %[1]s == 1 and %[2]s == %[3]s - 1
+        for: 30m
+        labels:
+          severity: info
+        annotations:
+          summary: Standby queue {{ $labels.queue }} in guild {{ $labels.guild }} has been one short for 30 minutes
+      - alert: StandbyQueueIdle
+        expr: %[1]s == 1 and on() time() - %[4]s > 7200
+        labels:
+          severity: info
+        annotations:
+          summary: Standby queue {{ $labels.queue }} in guild {{ $labels.guild }} has been open for 2 hours without activity
+      - alert: StandbyDiscordErrorRateHigh
+        expr: standby:%[6]s:rate5m > 0.1
+        for: 10m
+        labels:
+          severity: warning
+        annotations:
+          summary: Discord API requests are failing
+      - alert: StandbyMissingPermissions
+        expr: standby:%[6]s_by_reason:rate5m{reason="missing_permissions"} > 0
+        for: 5m
+        labels:
+          severity: warning
+        annotations:
+          summary: Standby bot is missing Discord permissions, run /standby-permcheck
+      - alert: StandbyRateLimited
+        expr: standby:%[6]s_by_reason:rate5m{reason="rate_limited"} > 0.05
+        for: 10m
+        labels:
+          severity: warning
+        annotations:
+          summary: Standby bot is being rate limited by Discord
+`,
+		metricNamedQueueOpen,
+		metricNamedQueueUsers,
+		metricNamedQueueCap,
+		metricQueueLastActivity,
+		metricGatewayConnected,
+		metricAPIErrors,
+		metricCommandDuration,
+	)
+	return err
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	// Embed the timezone database so /standby-schedule works in minimal images.
+	_ "time/tzdata"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// jobScheduledOpen opens a scheduled queue.
+const jobScheduledOpen = "scheduled_open"
+
+var scheduleCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-schedule",
+	Description: "Admin command to open a queue automatically at a set time",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "time",
+			Description: "When to open the queue, e.g. 21:00; tomorrow if it's already passed today",
+			Required:    true,
+			MaxLength:   5,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "tz",
+			Description: "IANA timezone, e.g. America/Toronto; defaults to the server's, or UTC",
+			MaxLength:   64,
+		},
+		queueNameOption("Name of the queue to open"),
+		{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "size",
+			Description: "Number of players needed to fill the queue",
+			MinValue:    ptr(float64(MinQueueSize)),
+			MaxValue:    MaxQueueSizeOption,
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        "note",
+			Description: "Note shown on the queue",
+			MaxLength:   200,
+		},
+	},
+}
+
+// scheduledQueue is a queue waiting to be opened by the scheduler. Its
+// countdown message stays up until then.
+type scheduledQueue struct {
+	Name      string          `json:"name"`
+	Size      int             `json:"size"`
+	Note      string          `json:"note,omitempty"`
+	At        time.Time       `json:"at"`
+	By        *discordgo.User `json:"by"`
+	ChannelID string          `json:"channel_id"`
+	MessageID string          `json:"message_id"`
+	// RSVPs are reminded before the queue opens, see rsvp.go.
+	RSVPs []*discordgo.User `json:"rsvps,omitempty"`
+	// Joining are the RSVPs who asked to be added as soon as it opens.
+	Joining []string `json:"joining,omitempty"`
+}
+
+// nextOccurrence returns the next time clock ("15:04") happens in loc after now.
+func nextOccurrence(clock string, loc *time.Location, now time.Time) (time.Time, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	now = now.In(loc)
+	at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at, nil
+}
+
+func createCountdownEmbed(sq *scheduledQueue, style embedStyle) *discordgo.MessageEmbed {
+	desc := fmt.Sprintf("Opens <t:%d:R> (<t:%d:t>), scheduled by <@%s>.", sq.At.Unix(), sq.At.Unix(), sq.By.ID)
+	if sq.Note != "" {
+		desc += "\n" + sq.Note
+	}
+	if len(sq.RSVPs) > 0 {
+		desc += "\n\n**Going:** " + userMentions(sq.RSVPs)
+	}
+	return createQueueEmbed(sq.title(), desc, style)
+}
+
+// title is the scheduled queue's title. A queue opened per channel is
+// scheduled in its channel, so its name is left out rather than showing
+// the channel's ID.
+func (sq *scheduledQueue) title() string {
+	if strings.HasPrefix(sq.Name, channelQueuePrefix) {
+		return queueTitle("", sq.Size)
+	}
+	return queueTitle(sq.Name, sq.Size)
+}
+
+func (q *queueState) handleSchedule(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	cfg := q.configs.get(q.guildID)
+	if !cfg.isAdmin(i.Member) {
+		respondEphemeral(s, i, "Only admins can use this command.")
+		return
+	}
+
+	opts := optionMap(i.ApplicationCommandData().Options)
+	tz := cfg.Timezone
+	if tz == "" {
+		tz = "UTC"
+	}
+	if opt, ok := opts["tz"]; ok {
+		tz = opt.StringValue()
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("I don't know the timezone %q, try something like America/Toronto.", tz))
+		return
+	}
+	at, err := nextOccurrence(opts["time"].StringValue(), loc, time.Now())
+	if err != nil {
+		respondEphemeral(s, i, "Times look like 21:00.")
+		return
+	}
+
+	sq := &scheduledQueue{
+		Size:      cfg.QueueSize,
+		At:        at,
+		By:        i.Member.User,
+		ChannelID: cfg.ChannelID,
+	}
+	if cfg.ChannelQueues {
+		sq.ChannelID = i.ChannelID
+		sq.Name = channelQueueName(i.ChannelID)
+	}
+	if opt, ok := opts["name"]; ok {
+		sq.Name = normalizeQueueName(opt.StringValue())
+	}
+	if opt, ok := opts["size"]; ok {
+		sq.Size = int(opt.IntValue())
+	}
+	if opt, ok := opts["note"]; ok {
+		sq.Note = opt.StringValue()
+	}
+
+	m, err := s.ChannelMessageSendComplex(sq.ChannelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{createCountdownEmbed(sq, q.configs.get(q.guildID).Embed)},
+		Components: rsvpButtons(),
+	})
+	if err != nil {
+		log.Printf("interaction %s: error sending countdown message: %v\n", interactionRef(i), err)
+		respondError(s, i, "Couldn't post the countdown, check my permissions with /standby-permcheck.")
+		return
+	}
+	sq.MessageID = m.ID
+
+	q.Lock()
+	defer q.Unlock()
+
+	q.schedules = append(q.schedules, sq)
+	q.scheduler.scheduleLocked(jobScheduledOpen, jobScheduledOpen+":"+sq.MessageID, sq.At, sq.MessageID)
+	q.scheduleReminderLocked(sq)
+	log.Printf("queue %q scheduled for %s by %s (%s)\n", sq.Name, sq.At, sq.By.Username, sq.By.ID)
+	respondEphemeral(s, i, fmt.Sprintf("The queue will open <t:%d:F>.", sq.At.Unix()))
+}
+
+// runScheduledOpenJobLocked opens the scheduled queue whose countdown
+// message the job was scheduled for.
+// lock must be held
+func (q *queueState) runScheduledOpenJobLocked(s *discordgo.Session, j *job) {
+	for _, sq := range q.schedules {
+		if sq.MessageID == j.Args[0] {
+			q.openScheduledLocked(s, sq)
+			return
+		}
+	}
+}
+
+// openScheduledLocked replaces the countdown with the queue, unless a queue
+// with the same name was opened by hand in the meantime.
+// lock must be held
+func (q *queueState) openScheduledLocked(s *discordgo.Session, sq *scheduledQueue) {
+	for idx, other := range q.schedules {
+		if other == sq {
+			q.schedules = append(q.schedules[:idx], q.schedules[idx+1:]...)
+			break
+		}
+	}
+	if err := s.ChannelMessageDelete(sq.ChannelID, sq.MessageID); err != nil {
+		log.Printf("error deleting countdown message: %v\n", err)
+	}
+
+	q.selectQueueLocked(q.queueLocked(sq.Name))
+	if q.currentMsgID != "" {
+		log.Printf("scheduled queue %q was already open\n", sq.Name)
+		return
+	}
+	q.setOpenOptionsLocked(openOptions{note: sq.Note})
+	if err := q.openQueueLocked(s, sq.By, false, sq.Size, sq.ChannelID); err != nil {
+		q.setOpenOptionsLocked(openOptions{})
+		log.Printf("error opening scheduled queue: %v\n", err)
+		return
+	}
+	q.joinRSVPsLocked(s, sq)
+}
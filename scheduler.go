@@ -0,0 +1,198 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// job is deferred work that's saved with the rest of the state, so it still
+// runs if the bot restarts before it's due. Jobs that came due while the bot
+// was down run right after startup.
+type job struct {
+	// Kind picks the handler registered with handleJob.
+	Kind string `json:"kind"`
+	// Key identifies the job, scheduling another job with the same key
+	// replaces it.
+	Key  string    `json:"key"`
+	At   time.Time `json:"at"`
+	Args []string  `json:"args,omitempty"`
+}
+
+// jobHandler runs a due job.
+// lock must be held
+type jobHandler func(s *discordgo.Session, j *job)
+
+// scheduler runs persisted jobs when they're due and tickers every
+// timerInterval, all with the queueState lock held.
+type scheduler struct {
+	jobs     map[string]*job
+	handlers map[string]jobHandler
+	tickers  []func(s *discordgo.Session)
+	// wake interrupts the run loop when an earlier job is scheduled.
+	wake chan struct{}
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		jobs:     make(map[string]*job),
+		handlers: make(map[string]jobHandler),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func (sc *scheduler) handleJob(kind string, h jobHandler) {
+	sc.handlers[kind] = h
+}
+
+// every runs fn on each tick.
+func (sc *scheduler) every(fn func(s *discordgo.Session)) {
+	sc.tickers = append(sc.tickers, fn)
+}
+
+// scheduleLocked runs the kind's handler with args at the given time.
+// lock must be held
+func (sc *scheduler) scheduleLocked(kind, key string, at time.Time, args ...string) {
+	sc.jobs[key] = &job{Kind: kind, Key: key, At: at, Args: args}
+	select {
+	case sc.wake <- struct{}{}:
+	default:
+	}
+}
+
+// cancelLocked drops the job with key, if it hasn't run yet.
+// lock must be held
+func (sc *scheduler) cancelLocked(key string) {
+	delete(sc.jobs, key)
+}
+
+// lock must be held
+func (sc *scheduler) nextLocked() time.Time {
+	var next time.Time
+	for _, j := range sc.jobs {
+		if next.IsZero() || j.At.Before(next) {
+			next = j.At
+		}
+	}
+	return next
+}
+
+// dueLocked removes and returns the jobs due by now, oldest first.
+// lock must be held
+func (sc *scheduler) dueLocked(now time.Time) []*job {
+	var due []*job
+	for key, j := range sc.jobs {
+		if !j.At.After(now) {
+			due = append(due, j)
+			delete(sc.jobs, key)
+		}
+	}
+	sort.Slice(due, func(a, b int) bool {
+		return due[a].At.Before(due[b].At)
+	})
+	return due
+}
+
+// lock must be held
+func (sc *scheduler) snapshotLocked() []*job {
+	jobs := make([]*job, 0, len(sc.jobs))
+	for _, j := range sc.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].At.Before(jobs[b].At)
+	})
+	return jobs
+}
+
+// runScheduler runs tickers and due jobs until the process exits.
+func (q *queueState) runScheduler(s *discordgo.Session) {
+	tick := time.NewTicker(timerInterval)
+	defer tick.Stop()
+	for {
+		q.Lock()
+		next := q.scheduler.nextLocked()
+		q.Unlock()
+
+		timer := time.NewTimer(time.Hour)
+		if !next.IsZero() {
+			timer.Reset(time.Until(next))
+		}
+		select {
+		case <-tick.C:
+			q.runTickers(s)
+		case <-timer.C:
+			q.runDueJobs(s)
+		case <-q.scheduler.wake:
+		}
+		timer.Stop()
+	}
+}
+
+// runTickers runs the tickers. A panic is reported and skips the rest until
+// the next tick.
+func (q *queueState) runTickers(s *discordgo.Session) {
+	q.Lock()
+	defer q.Unlock()
+	defer q.reporter.recoverBackground("tickers", map[string]string{"guild": q.guildID})
+
+	for _, fn := range q.scheduler.tickers {
+		fn(s)
+	}
+	q.saveStateLocked()
+}
+
+// runDueJobs runs the jobs that are due.
+func (q *queueState) runDueJobs(s *discordgo.Session) {
+	q.Lock()
+	defer q.Unlock()
+
+	for _, j := range q.scheduler.dueLocked(time.Now()) {
+		h, ok := q.scheduler.handlers[j.Kind]
+		if !ok {
+			log.Printf("dropping job %s with unknown kind %q\n", j.Key, j.Kind)
+			continue
+		}
+		q.runJobLocked(s, h, j)
+	}
+	q.saveStateLocked()
+}
+
+// runJobLocked runs a job, reporting a panic so the other due jobs still
+// run. A job that panics isn't retried.
+// lock must be held
+func (q *queueState) runJobLocked(s *discordgo.Session, h jobHandler, j *job) {
+	defer q.reporter.recoverBackground("job "+j.Key, map[string]string{"guild": q.guildID, "job": j.Kind})
+	h(s, j)
+}
+
+// registerJobs sets up the tickers and job handlers.
+func (q *queueState) registerJobs() {
+	q.scheduler.every(func(s *discordgo.Session) {
+		for _, qu := range q.queues {
+			q.selectQueueLocked(qu)
+			q.checkReinviteLocked(s)
+			q.checkStaleLocked(s)
+			q.checkBrbLocked(s)
+			q.checkExpiryLocked(s)
+			q.checkMapVoteLocked(s)
+		}
+		q.checkMVPVoteLocked(s)
+		q.cleanupStackVoiceLocked(s)
+		q.expireReactionsLocked()
+	})
+	q.scheduler.handleJob(jobReadyCheck, q.runReadyCheckJobLocked)
+	q.scheduler.handleJob(jobScheduledOpen, q.runScheduledOpenJobLocked)
+	q.scheduler.handleJob(jobDigest, q.runDigestJobLocked)
+	q.scheduler.handleJob(jobHistoryPurge, q.runHistoryPurgeJobLocked)
+	q.scheduler.handleJob(jobPruneSubscriptions, q.runPruneJobLocked)
+	q.scheduler.handleJob(jobLaunch, q.runLaunchJobLocked)
+	q.scheduler.handleJob(jobScheduleReminder, q.runScheduleReminderJobLocked)
+	q.scheduler.handleJob(jobLastCall, q.runLastCallJobLocked)
+	q.scheduler.handleJob(jobReopenOptOut, q.runReopenOptOutJobLocked)
+	q.scheduler.handleJob(jobUndoClose, q.runUndoCloseJobLocked)
+	q.scheduler.handleJob(jobRenderQueue, q.runRenderJobLocked)
+	q.scheduler.handleJob(jobRenderBoard, q.runBoardJobLocked)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var scoreCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-score",
+	Description: "Captains: report the score of your bracket match for the other captain to confirm",
+	Options: []*discordgo.ApplicationCommandOption{
+		{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "score",
+			Description: "Your team's score",
+			Required:    true,
+			MinValue:    ptr(0.0),
+		},
+		{
+			Type:        discordgo.ApplicationCommandOptionInteger,
+			Name:        "opponent_score",
+			Description: "The other team's score",
+			Required:    true,
+			MinValue:    ptr(0.0),
+		},
+	},
+}
+
+// scoreReport is a score one captain reported that the other has to confirm.
+type scoreReport struct {
+	by     int
+	scores map[int]int
+	msgID  string
+}
+
+// captainTeam returns the team the user captains, or noTeam. The first
+// player seeded into a team is its captain.
+func (b *bracket) captainTeam(userID string) int {
+	for i, team := range b.teams {
+		if team[0].ID == userID {
+			return i
+		}
+	}
+	return noTeam
+}
+
+// currentMatch returns the team's undecided match and its number, if it has
+// an opponent yet.
+func (b *bracket) currentMatch(team int) (*bracketMatch, int) {
+	number := 0
+	for _, round := range b.rounds {
+		for _, m := range round {
+			number++
+			if m.winner == noTeam && m.a != noTeam && m.b != noTeam && (m.a == team || m.b == team) {
+				return m, number
+			}
+		}
+	}
+	return nil, 0
+}
+
+func (m *bracketMatch) opponent(team int) int {
+	if m.a == team {
+		return m.b
+	}
+	return m.a
+}
+
+func (q *queueState) handleScore(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	b := q.bracket
+	if b == nil {
+		respondEphemeral(s, i, "There is no bracket running.")
+		return
+	}
+	team := b.captainTeam(i.Member.User.ID)
+	if team == noTeam {
+		respondEphemeral(s, i, "Only team captains can report scores.")
+		return
+	}
+	m, number := b.currentMatch(team)
+	if m == nil {
+		respondEphemeral(s, i, "Your team has no match to report right now.")
+		return
+	}
+	opts := optionMap(i.ApplicationCommandData().Options)
+	score, oppScore := int(opts["score"].IntValue()), int(opts["opponent_score"].IntValue())
+	if score == oppScore {
+		respondEphemeral(s, i, "Bracket matches can't end in a draw.")
+		return
+	}
+
+	opp := m.opponent(team)
+	msg, err := s.ChannelMessageSendComplex(b.channelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("%s reports %d-%d against %s in match %d. <@%s>, is that right?",
+			teamName(team), score, oppScore, teamName(opp), number, b.teams[opp][0].ID),
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Confirm",
+					Style:    discordgo.SuccessButton,
+					CustomID: "score_confirm:" + strconv.Itoa(number),
+				},
+				discordgo.Button{
+					Label:    "Dispute",
+					Style:    discordgo.DangerButton,
+					CustomID: "score_dispute:" + strconv.Itoa(number),
+				},
+			}},
+		},
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{b.teams[opp][0].ID}},
+	})
+	if err != nil {
+		log.Printf("interaction %s: error sending score report: %v\n", interactionRef(i), err)
+		respondError(s, i, "Couldn't post the score report.")
+		return
+	}
+	if m.report != nil {
+		q.resolveScoreReportLocked(s, m, "Replaced by a newer report.")
+	}
+	m.report = &scoreReport{
+		by:     team,
+		scores: map[int]int{team: score, opp: oppScore},
+		msgID:  msg.ID,
+	}
+	respondEphemeral(s, i, fmt.Sprintf("Score reported, waiting for %s's captain to confirm.", teamName(opp)))
+}
+
+// handleScoreButton lets the opposing captain confirm or dispute a report.
+// Only a confirmed score is recorded in the bracket.
+func (q *queueState) handleScoreButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	action, numberStr, _ := strings.Cut(interactionCustomID(i), ":")
+	number, _ := strconv.Atoi(numberStr)
+	b := q.bracket
+	var m *bracketMatch
+	if b != nil {
+		m = b.match(number)
+	}
+	if m == nil || m.report == nil || m.report.msgID != i.Message.ID {
+		respondEphemeral(s, i, "This report is no longer open.")
+		return
+	}
+	if b.captainTeam(i.Member.User.ID) != m.opponent(m.report.by) {
+		respondEphemeral(s, i, "Only the other team's captain can confirm this score.")
+		return
+	}
+
+	if action == "score_dispute" {
+		q.resolveScoreReportLocked(s, m, fmt.Sprintf("Disputed by <@%s>. Captains, sort it out and report again, or ask an admin.", i.Member.User.ID))
+		respondEphemeral(s, i, "Score disputed.")
+		return
+	}
+
+	scores := m.report.scores
+	m.scoreA, m.scoreB = scores[m.a], scores[m.b]
+	m.winner = m.a
+	if m.scoreB > m.scoreA {
+		m.winner = m.b
+	}
+	q.resolveScoreReportLocked(s, m, fmt.Sprintf("Confirmed by <@%s>.", i.Member.User.ID))
+	b.advance()
+	q.editBracketLocked(s)
+	respondEphemeral(s, i, "Score confirmed.")
+}
+
+// resolveScoreReportLocked closes the match's open report with status.
+// lock must be held
+func (q *queueState) resolveScoreReportLocked(s *discordgo.Session, m *bracketMatch, status string) {
+	report := m.report
+	m.report = nil
+	msg, err := s.ChannelMessage(q.bracket.channelID, report.msgID)
+	if err != nil {
+		log.Printf("error fetching score report: %v\n", err)
+		return
+	}
+	content := msg.Content + "\n" + status
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:              report.msgID,
+		Channel:         q.bracket.channelID,
+		Content:         &content,
+		Components:      &[]discordgo.MessageComponent{},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}); err != nil {
+		log.Printf("error editing score report: %v\n", err)
+	}
+}
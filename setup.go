@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// canSetup reports whether the member may change guild config: configured
+// admins, or anyone with Manage Server so a fresh guild can be set up.
+func canSetup(cfg guildConfig, m *discordgo.Member) bool {
+	return cfg.isAdmin(m) || m.Permissions&discordgo.PermissionManageServer != 0
+}
+
+// setupComponents renders the wizard for draft.
+func setupComponents(draft guildConfig) []discordgo.MessageComponent {
+	var channels, roles []discordgo.SelectMenuDefaultValue
+	if draft.ChannelID != "" {
+		channels = append(channels, discordgo.SelectMenuDefaultValue{ID: draft.ChannelID, Type: discordgo.SelectMenuDefaultValueChannel})
+	}
+	for _, id := range draft.AdminRoleIDs {
+		roles = append(roles, discordgo.SelectMenuDefaultValue{ID: id, Type: discordgo.SelectMenuDefaultValueRole})
+	}
+	notify := []discordgo.SelectMenuOption{
+		{Label: "Mention players when the queue fills", Value: notifyStyleMention, Default: draft.NotifyStyle == notifyStyleMention},
+		{Label: "List players without pinging", Value: notifyStyleSilent, Default: draft.NotifyStyle == notifyStyleSilent},
+	}
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:      discordgo.ChannelSelectMenu,
+				CustomID:      "setup_channel",
+				Placeholder:   "Queue channel",
+				DefaultValues: channels,
+				ChannelTypes:  []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+			},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:      discordgo.RoleSelectMenu,
+				CustomID:      "setup_admin_roles",
+				Placeholder:   "Admin roles",
+				DefaultValues: roles,
+				MaxValues:     5,
+			},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:    discordgo.StringSelectMenu,
+				CustomID:    "setup_notify",
+				Placeholder: "Notification style",
+				Options:     notify,
+			},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    fmt.Sprintf("Queue size: %d", draft.QueueSize),
+				Style:    discordgo.SecondaryButton,
+				CustomID: "setup_size",
+			},
+			discordgo.Button{
+				Label:    "Save",
+				Style:    discordgo.SuccessButton,
+				CustomID: "setup_save",
+			},
+		}},
+	}
+}
+
+func setupContent(draft guildConfig) string {
+	roles := make([]string, len(draft.AdminRoleIDs))
+	for i, id := range draft.AdminRoleIDs {
+		roles[i] = fmt.Sprintf("<@&%s>", id)
+	}
+	if len(roles) == 0 {
+		roles = []string{"none"}
+	}
+	channel := "none"
+	if draft.ChannelID != "" {
+		channel = fmt.Sprintf("<#%s>", draft.ChannelID)
+	}
+	return fmt.Sprintf("### Standby setup\nQueue channel: %s\nAdmin roles: %s\nDefault queue size: %d\nNotifications: %s\n\nPick the settings below and press Save.",
+		channel, strings.Join(roles, ", "), draft.QueueSize, draft.NotifyStyle)
+}
+
+func (q *queueState) handleSetup(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	cfg := q.configs.get(q.guildID)
+	if !canSetup(cfg, i.Member) {
+		respondEphemeral(s, i, "Only admins can use this command.")
+		return
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	q.setupDrafts[i.Member.User.ID] = &cfg
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:         setupContent(cfg),
+			Components:      setupComponents(cfg),
+			Flags:           discordgo.MessageFlagsEphemeral,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	}); err != nil {
+		log.Printf("error responding with setup wizard: %v\n", err)
+	}
+}
+
+// handleSetupComponent applies a wizard interaction to the user's draft.
+func (q *queueState) handleSetupComponent(s *discordgo.Session, i *discordgo.InteractionCreate, customID string) {
+	q.Lock()
+	defer q.Unlock()
+
+	draft, ok := q.setupDrafts[i.Member.User.ID]
+	if !ok {
+		respondEphemeral(s, i, "This setup has expired, run /standby-setup again.")
+		return
+	}
+
+	switch customID {
+	case "setup_channel":
+		draft.ChannelID = i.MessageComponentData().Values[0]
+	case "setup_admin_roles":
+		draft.AdminRoleIDs = i.MessageComponentData().Values
+	case "setup_notify":
+		draft.NotifyStyle = i.MessageComponentData().Values[0]
+	case "setup_size":
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseModal,
+			Data: &discordgo.InteractionResponseData{
+				CustomID: "setup_size",
+				Title:    "Default queue size",
+				Components: []discordgo.MessageComponent{
+					discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+						discordgo.TextInput{
+							CustomID:  "size",
+							Label:     "Players needed for a game",
+							Style:     discordgo.TextInputShort,
+							Value:     strconv.Itoa(draft.QueueSize),
+							Required:  true,
+							MaxLength: 2,
+						},
+					}},
+				},
+			},
+		}); err != nil {
+			log.Printf("error responding with setup modal: %v\n", err)
+		}
+		return
+	case "setup_size_submit":
+		size, err := strconv.Atoi(strings.TrimSpace(modalValue(i.ModalSubmitData(), "size")))
+		if err != nil || size < 2 {
+			respondEphemeral(s, i, "Queue size must be a number of at least 2.")
+			return
+		}
+		draft.QueueSize = size
+	case "setup_save":
+		if draft.ChannelID == "" {
+			respondEphemeral(s, i, "Pick a queue channel first.")
+			return
+		}
+		saved := *draft
+		if err := q.configs.update(q.guildID, func(cfg *guildConfig) { *cfg = saved }); err != nil {
+			log.Printf("interaction %s: error saving guild config: %v\n", interactionRef(i), err)
+			respondError(s, i, "Couldn't save the settings, try again.")
+			return
+		}
+		delete(q.setupDrafts, i.Member.User.ID)
+		log.Printf("guild config updated by %s (%s): %+v\n", i.Member.User.Username, i.Member.User.ID, saved)
+		if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:         setupContent(saved) + "\n\nSaved! Changes apply to the next queue.",
+				Components:      []discordgo.MessageComponent{},
+				AllowedMentions: &discordgo.MessageAllowedMentions{},
+			},
+		}); err != nil {
+			log.Printf("error responding to setup save: %v\n", err)
+		}
+		return
+	}
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:         setupContent(*draft),
+			Components:      setupComponents(*draft),
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	}); err != nil {
+		log.Printf("error updating setup wizard: %v\n", err)
+	}
+}
+
+// promptSetup DMs the guild owner on first run if the guild has no config
+// yet. GuildCreate comes again on every reconnect, so they're only asked
+// once.
+func (q *queueState) promptSetup(s *discordgo.Session, g *discordgo.GuildCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.setupPrompted || q.configs.configured(g.ID) {
+		return
+	}
+	content := fmt.Sprintf("Thanks for adding the standby bot to %s! Run /standby-setup in the server to pick the queue channel, admin roles, queue size and notification style.", g.Name)
+	if err := sendDM(s, g.OwnerID, content); err != nil {
+		log.Printf("error sending setup prompt: %v\n", err)
+		return
+	}
+	q.setupPrompted = true
+	q.saveStateLocked()
+}
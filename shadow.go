@@ -0,0 +1,177 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The waitlist promotion orders and team balancers PromotionOrder and
+// TeamBalance pick from.
+const (
+	promotionWaitlist = "waitlist"
+	promotionRotation = "rotation"
+	teamsGreedy       = "greedy"
+	teamsSwap         = "swap"
+)
+
+// rotationSessions is how many of the latest sessions the rotation order
+// counts when looking for who played least.
+const rotationSessions = 5
+
+// promotionOrders return the next waitlist unit that fits in free slots,
+// skipping members in taken, or nil if none does.
+var promotionOrders = map[string]func(q *queueState, free int, taken map[string]bool) []*queueMember{
+	promotionWaitlist: (*queueState).nextPromotionLocked,
+	promotionRotation: (*queueState).nextRotationLocked,
+}
+
+// teamBalancers split players into two teams of equal size.
+var teamBalancers = map[string]func(players []*discordgo.User, rating func(userID string) int) [2][]*discordgo.User{
+	teamsGreedy: splitTeams,
+	teamsSwap:   splitTeamsSwap,
+}
+
+// pickPromotionLocked returns the unit the live promotion order promotes
+// next.
+// lock must be held
+func (q *queueState) pickPromotionLocked(free int, taken map[string]bool) []*queueMember {
+	return promotionOrders[current(&PromotionOrder)](q, free, taken)
+}
+
+// nextRotationLocked is the rotation order: of the waitlist units that fit,
+// the one whose members played the fewest of the latest rotationSessions,
+// in waitlist order among ties.
+// lock must be held
+func (q *queueState) nextRotationLocked(free int, taken map[string]bool) []*queueMember {
+	recent := q.sessions
+	if len(recent) > rotationSessions {
+		recent = recent[len(recent)-rotationSessions:]
+	}
+	played := make(map[string]int)
+	for _, sess := range recent {
+		for _, p := range sess.Players {
+			played[p.ID]++
+		}
+	}
+
+	var (
+		best      []*queueMember
+		bestCount int
+	)
+	seen := make(map[string]bool)
+	for _, m := range q.waitlist {
+		if taken[m.ID] || seen[m.ID] {
+			continue
+		}
+		unit := q.waitlistUnitLocked(m)
+		count := 0
+		for _, u := range unit {
+			seen[u.ID] = true
+			count += played[u.ID]
+		}
+		if len(unit) > free {
+			continue
+		}
+		// A duo is compared by how much each of them played on average.
+		if best == nil || count*len(best) < bestCount*len(unit) {
+			best, bestCount = unit, count
+		}
+	}
+	return best
+}
+
+// shadowPromotionLocked compares the unit the live order is promoting into
+// free slots with what the other orders would promote, if ShadowAlgorithms
+// is set.
+// lock must be held
+func (q *queueState) shadowPromotionLocked(free int, live []*queueMember) {
+	if !current(&ShadowAlgorithms) {
+		return
+	}
+	liveOrder := current(&PromotionOrder)
+	for name, pick := range promotionOrders {
+		if name == liveOrder {
+			continue
+		}
+		shadowRuns.WithLabelValues("promotion", name).Inc()
+		if shadow := pick(q, free, nil); unitIDs(shadow) != unitIDs(live) {
+			shadowDivergences.WithLabelValues("promotion", name).Inc()
+			log.Printf("shadow: promotion order %s would promote %q instead of %q in queue %s\n",
+				name, unitIDs(shadow), unitIDs(live), q.currentMsgID)
+		}
+	}
+}
+
+func unitIDs(unit []*queueMember) string {
+	ids := make([]string, len(unit))
+	for idx, m := range unit {
+		ids[idx] = m.ID
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// balanceTeamsLocked splits players with the live team balancer. If
+// ShadowAlgorithms is set the other balancers split them too, and their
+// skill gaps are compared with the live one.
+// lock must be held
+func (q *queueState) balanceTeamsLocked(players []*discordgo.User) [2][]*discordgo.User {
+	live := current(&TeamBalance)
+	teams := teamBalancers[live](players, q.skillLocked)
+	score := teamScorer(players, q.skillLocked)
+	gap := teamGap(teams, score)
+	teamSkillGap.WithLabelValues(live).Observe(float64(gap))
+	if !current(&ShadowAlgorithms) {
+		return teams
+	}
+	for name, balance := range teamBalancers {
+		if name == live {
+			continue
+		}
+		shadowRuns.WithLabelValues("teams", name).Inc()
+		shadowGap := teamGap(balance(players, q.skillLocked), score)
+		teamSkillGap.WithLabelValues(name).Observe(float64(shadowGap))
+		if shadowGap != gap {
+			shadowDivergences.WithLabelValues("teams", name).Inc()
+			log.Printf("shadow: team balancer %s would leave a skill gap of %d instead of %d in queue %s\n",
+				name, shadowGap, gap, q.currentMsgID)
+		}
+	}
+	return teams
+}
+
+// splitTeamsSwap starts from splitTeams, then swaps players between the
+// teams for as long as a swap narrows the gap between their totals.
+func splitTeamsSwap(players []*discordgo.User, rating func(userID string) int) [2][]*discordgo.User {
+	teams := splitTeams(players, rating)
+	score := teamScorer(players, rating)
+	gap := teamGap(teams, score)
+	for improved := true; improved && gap > 0; {
+		improved = false
+		for a := range teams[0] {
+			for b := range teams[1] {
+				teams[0][a], teams[1][b] = teams[1][b], teams[0][a]
+				if g := teamGap(teams, score); g < gap {
+					gap, improved = g, true
+					continue
+				}
+				teams[0][a], teams[1][b] = teams[1][b], teams[0][a]
+			}
+		}
+	}
+	return teams
+}
+
+// teamGap is the difference between the teams' total scores.
+func teamGap(teams [2][]*discordgo.User, score func(p *discordgo.User) int) int {
+	var totals [2]int
+	for t, team := range teams {
+		for _, p := range team {
+			totals[t] += score(p)
+		}
+	}
+	return max(totals[0]-totals[1], totals[1]-totals[0])
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// createStackVoiceLocked creates a voice channel for the full queue next to
+// the queue channel and moves everyone already in voice into it.
+// lock must be held
+func (q *queueState) createStackVoiceLocked(s *discordgo.Session) {
+	if q.stackVoiceID != "" {
+		return
+	}
+	data := discordgo.GuildChannelCreateData{
+		Name: fmt.Sprintf("%d-Stack #%d", q.size, q.totals.filled),
+		Type: discordgo.ChannelTypeGuildVoice,
+	}
+	if q.name != "" {
+		data.Name = q.name + " " + data.Name
+	}
+	if parent, err := s.State.Channel(q.channelID); err == nil {
+		data.ParentID = parent.ParentID
+	}
+	ch, err := s.GuildChannelCreateComplex(q.guildID, data)
+	if err != nil {
+		log.Printf("error creating stack voice channel: %v\n", err)
+		return
+	}
+	q.stackVoiceID = ch.ID
+
+	for _, m := range q.users {
+		if _, err := s.State.VoiceState(q.guildID, m.ID); err != nil {
+			continue
+		}
+		if err := s.GuildMemberMove(q.guildID, m.ID, &ch.ID); err != nil {
+			log.Printf("error moving %s into stack voice channel: %v\n", m.ID, err)
+		}
+	}
+}
+
+// releaseStackVoiceLocked hands the queue's voice channel over to be deleted
+// once everyone has left it, so a closed queue doesn't cut a game short.
+// lock must be held
+func (q *queueState) releaseStackVoiceLocked() {
+	if q.stackVoiceID == "" {
+		return
+	}
+	q.staleVoiceIDs = append(q.staleVoiceIDs, q.stackVoiceID)
+	q.stackVoiceID = ""
+}
+
+// cleanupStackVoiceLocked deletes released voice channels that are empty.
+// lock must be held
+func (q *queueState) cleanupStackVoiceLocked(s *discordgo.Session) {
+	if len(q.staleVoiceIDs) == 0 {
+		return
+	}
+	occupied := make(map[string]bool)
+	if g, err := s.State.Guild(q.guildID); err == nil {
+		for _, vs := range g.VoiceStates {
+			occupied[vs.ChannelID] = true
+		}
+	}
+	var keep []string
+	for _, id := range q.staleVoiceIDs {
+		if occupied[id] {
+			keep = append(keep, id)
+			continue
+		}
+		if _, err := s.ChannelDelete(id); err != nil {
+			log.Printf("error deleting stack voice channel %s: %v\n", id, err)
+		}
+	}
+	q.staleVoiceIDs = keep
+}
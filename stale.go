@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// checkStaleLocked alerts admins once the queue has been one short for
+// StaleAfter, so someone can rally the last player or close it.
+// lock must be held
+func (q *queueState) checkStaleLocked(s *discordgo.Session) {
+	staleAfter := current(&StaleAfter)
+	if staleAfter <= 0 || q.currentMsgID == "" || q.staleAlerted || q.oneMoreSince.IsZero() || time.Since(q.oneMoreSince) < staleAfter {
+		return
+	}
+	q.staleAlerted = true
+
+	content := fmt.Sprintf("The standby queue has been at %d/%d for %s. https://discord.com/channels/%s/%s/%s",
+		len(q.users), q.size, time.Since(q.oneMoreSince).Round(time.Minute), q.guildID, q.channelID, q.currentMsgID)
+	if staffChannelID := q.configs.get(q.guildID).StaffChannelID; staffChannelID != "" {
+		q.notifyChannelLocked(s, staffChannelID, content)
+	}
+	if q.guildID != GuildID {
+		// AlertUserIDs are the home guild's admins
+		return
+	}
+	for _, id := range current(&AlertUserIDs) {
+		q.notifyLocked(s, id, notifyStaff, content)
+	}
+}
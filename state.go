@@ -0,0 +1,486 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// queueSnapshot is the persisted form of a queue.
+type queueSnapshot struct {
+	Name          string               `json:"name,omitempty"`
+	ChannelID     string               `json:"channel_id"`
+	Size          int                  `json:"size"`
+	MessageID     string               `json:"message_id"`
+	Components    bool                 `json:"components,omitempty"`
+	OpenedBy      *discordgo.User      `json:"opened_by,omitempty"`
+	OpenedAt      time.Time            `json:"opened_at"`
+	NotifyMsgID   string               `json:"notify_message_id,omitempty"`
+	OneMoreMsgID  string               `json:"one_more_message_id,omitempty"`
+	OneMoreSince  time.Time            `json:"one_more_since"`
+	OneMoreLangs  []string             `json:"one_more_langs,omitempty"`
+	Note          string               `json:"note,omitempty"`
+	Title         string               `json:"title,omitempty"`
+	Game          string               `json:"game,omitempty"`
+	RankMin       int                  `json:"rank_min,omitempty"`
+	RankMax       int                  `json:"rank_max,omitempty"`
+	StackVoiceID  string               `json:"stack_voice_id,omitempty"`
+	PingMsgID     string               `json:"ping_message_id,omitempty"`
+	LastCallUntil time.Time            `json:"last_call_until"`
+	LastCallMsgID string               `json:"last_call_message_id,omitempty"`
+	ClosingUntil  time.Time            `json:"closing_until"`
+	Reopened      map[string]bool      `json:"reopened,omitempty"`
+	ReopenMsgID   string               `json:"reopen_message_id,omitempty"`
+	Counts        queueCounts          `json:"counts"`
+	Participants  []*participant       `json:"participants,omitempty"`
+	Reinvited     bool                 `json:"reinvited,omitempty"`
+	StaleAlerted  bool                 `json:"stale_alerted,omitempty"`
+	LastUser      *discordgo.User      `json:"last_user,omitempty"`
+	LastAction    string               `json:"last_action,omitempty"`
+	Actions       []actionSnapshot     `json:"actions,omitempty"`
+	Users         []*queueMember       `json:"users"`
+	Waitlist      []*queueMember       `json:"waitlist"`
+	Conditional   []*conditionalMember `json:"conditional,omitempty"`
+	Declines      []*decline           `json:"declines,omitempty"`
+	Watchers      []*discordgo.User    `json:"watchers,omitempty"`
+	MapVote       *mapVoteSnapshot     `json:"map_vote,omitempty"`
+	Label         string               `json:"label,omitempty"`
+	ReadyCheck    *readyCheckSnapshot  `json:"ready_check,omitempty"`
+	// Ready is who confirmed the ready check, kept between checks like
+	// queue.ready.
+	Ready []string `json:"ready,omitempty"`
+}
+
+// readyCheckSnapshot is the persisted form of a running ready check. Its
+// expiry job is persisted with the other jobs.
+type readyCheckSnapshot struct {
+	MessageID string    `json:"message_id"`
+	Deadline  time.Time `json:"deadline"`
+}
+
+type actionSnapshot struct {
+	Kind string          `json:"kind"`
+	User *discordgo.User `json:"user"`
+	At   time.Time       `json:"at"`
+}
+
+// mapVoteSnapshot is the persisted form of a running map vote, see
+// mapvote.go.
+type mapVoteSnapshot struct {
+	MessageID string            `json:"message_id"`
+	Options   []string          `json:"options"`
+	Players   []string          `json:"players"`
+	Votes     map[string]string `json:"votes,omitempty"`
+	EndsAt    time.Time         `json:"ends_at"`
+}
+
+func (v *mapVote) snapshot() *mapVoteSnapshot {
+	if v == nil {
+		return nil
+	}
+	return &mapVoteSnapshot{MessageID: v.msgID, Options: v.options, Players: v.players, Votes: v.votes, EndsAt: v.endsAt}
+}
+
+func (vs *mapVoteSnapshot) restore() *mapVote {
+	if vs == nil {
+		return nil
+	}
+	v := &mapVote{msgID: vs.MessageID, options: vs.Options, players: vs.Players, votes: vs.Votes, endsAt: vs.EndsAt}
+	if v.votes == nil {
+		v.votes = make(map[string]string)
+	}
+	return v
+}
+
+// mvpVoteSnapshot is the persisted form of a running MVP vote, see mvp.go.
+type mvpVoteSnapshot struct {
+	ChannelID string            `json:"channel_id"`
+	MessageID string            `json:"message_id"`
+	Players   []*discordgo.User `json:"players"`
+	Votes     map[string]string `json:"votes,omitempty"`
+	EndsAt    time.Time         `json:"ends_at"`
+}
+
+func (v *mvpVote) snapshot() *mvpVoteSnapshot {
+	if v == nil {
+		return nil
+	}
+	return &mvpVoteSnapshot{ChannelID: v.channelID, MessageID: v.msgID, Players: v.players, Votes: v.votes, EndsAt: v.endsAt}
+}
+
+func (vs *mvpVoteSnapshot) restore() *mvpVote {
+	if vs == nil {
+		return nil
+	}
+	v := &mvpVote{channelID: vs.ChannelID, msgID: vs.MessageID, players: vs.Players, votes: vs.Votes, endsAt: vs.EndsAt}
+	if v.votes == nil {
+		v.votes = make(map[string]string)
+	}
+	return v
+}
+
+// bracketSnapshot is the persisted form of a running bracket, see
+// bracket.go, with its matches' score reports and map vetoes.
+type bracketSnapshot struct {
+	ChannelID string              `json:"channel_id"`
+	MessageID string              `json:"message_id"`
+	Teams     [][]*discordgo.User `json:"teams"`
+	Subs      []*discordgo.User   `json:"subs,omitempty"`
+	Rounds    [][]matchSnapshot   `json:"rounds"`
+}
+
+type matchSnapshot struct {
+	A      int `json:"a"`
+	B      int `json:"b"`
+	Winner int `json:"winner"`
+	ScoreA int `json:"score_a,omitempty"`
+	ScoreB int `json:"score_b,omitempty"`
+	// Report is a score waiting for the other captain, see score.go.
+	Report *scoreReportSnapshot `json:"report,omitempty"`
+	Veto   *vetoSnapshot        `json:"veto,omitempty"`
+}
+
+type scoreReportSnapshot struct {
+	By        int         `json:"by"`
+	Scores    map[int]int `json:"scores"`
+	MessageID string      `json:"message_id"`
+}
+
+type vetoSnapshot struct {
+	MessageID string      `json:"message_id"`
+	Number    int         `json:"number"`
+	Pool      []string    `json:"pool"`
+	Banned    map[int]int `json:"banned,omitempty"`
+	Order     []int       `json:"order,omitempty"`
+	Turn      int         `json:"turn"`
+	Side      string      `json:"side,omitempty"`
+}
+
+func (b *bracket) snapshot() *bracketSnapshot {
+	if b == nil {
+		return nil
+	}
+	bs := &bracketSnapshot{ChannelID: b.channelID, MessageID: b.msgID, Teams: b.teams, Subs: b.subs}
+	for _, round := range b.rounds {
+		var matches []matchSnapshot
+		for _, m := range round {
+			ms := matchSnapshot{A: m.a, B: m.b, Winner: m.winner, ScoreA: m.scoreA, ScoreB: m.scoreB}
+			if r := m.report; r != nil {
+				ms.Report = &scoreReportSnapshot{By: r.by, Scores: r.scores, MessageID: r.msgID}
+			}
+			if v := m.veto; v != nil {
+				ms.Veto = &vetoSnapshot{MessageID: v.msgID, Number: v.number, Pool: v.pool, Banned: v.banned, Order: v.order, Turn: v.turn, Side: v.side}
+			}
+			matches = append(matches, ms)
+		}
+		bs.Rounds = append(bs.Rounds, matches)
+	}
+	return bs
+}
+
+func (bs *bracketSnapshot) restore() *bracket {
+	if bs == nil {
+		return nil
+	}
+	b := &bracket{channelID: bs.ChannelID, msgID: bs.MessageID, teams: bs.Teams, subs: bs.Subs}
+	for _, matches := range bs.Rounds {
+		var round []*bracketMatch
+		for _, ms := range matches {
+			m := &bracketMatch{a: ms.A, b: ms.B, winner: ms.Winner, scoreA: ms.ScoreA, scoreB: ms.ScoreB}
+			if r := ms.Report; r != nil {
+				m.report = &scoreReport{by: r.By, scores: r.Scores, msgID: r.MessageID}
+			}
+			if v := ms.Veto; v != nil {
+				m.veto = &mapVeto{msgID: v.MessageID, number: v.Number, pool: v.Pool, banned: v.Banned, order: v.Order, turn: v.Turn, side: v.Side}
+				if m.veto.banned == nil {
+					m.veto.banned = make(map[int]int)
+				}
+			}
+			round = append(round, m)
+		}
+		b.rounds = append(b.rounds, round)
+	}
+	return b
+}
+
+// stateSnapshot is everything that should survive a restart: open queues and
+// the player data built up over time.
+type stateSnapshot struct {
+	Queues   []queueSnapshot              `json:"queues"`
+	Accounts map[string]map[string]string `json:"accounts,omitempty"`
+	Alts     map[string]*altFlag          `json:"alts,omitempty"`
+	Regions  map[string]string            `json:"regions,omitempty"`
+	Duos     map[string]*discordgo.User   `json:"duos,omitempty"`
+	Queuers  map[string]map[string]bool   `json:"queuers,omitempty"`
+	Boards   map[string]string            `json:"boards,omitempty"`
+	Prefs    map[string]*userPrefs        `json:"prefs,omitempty"`
+	// Ranks is only read, from state saved before ranks had divisions.
+	Ranks        map[string]int          `json:"ranks,omitempty"`
+	PlayerRanks  map[string]*playerRank  `json:"player_ranks,omitempty"`
+	RollPicks    map[string][]time.Time  `json:"roll_picks,omitempty"`
+	MainRoles    map[string]string       `json:"main_roles,omitempty"`
+	LastFlexed   map[string]time.Time    `json:"last_flexed,omitempty"`
+	Celebrations map[string]*celebration `json:"celebrations,omitempty"`
+	// ReinviteOptIn is only read, from state saved before prefs existed.
+	ReinviteOptIn map[string]bool         `json:"reinvite_opt_in,omitempty"`
+	Stats         map[string]*playerStats `json:"stats,omitempty"`
+	Sessions      []session               `json:"sessions,omitempty"`
+	Promotions    []promotionWait         `json:"promotion_waits,omitempty"`
+	Schedules     []*scheduledQueue       `json:"schedules,omitempty"`
+	StaleVoiceIDs []string                `json:"stale_voice_ids,omitempty"`
+	SetupPrompted bool                    `json:"setup_prompted,omitempty"`
+	MVPVote       *mvpVoteSnapshot        `json:"mvp_vote,omitempty"`
+	Bracket       *bracketSnapshot        `json:"bracket,omitempty"`
+	Jobs          []*job                  `json:"jobs,omitempty"`
+}
+
+// lock must be held
+func (q *queueState) snapshotLocked() stateSnapshot {
+	snap := stateSnapshot{
+		Accounts:      q.accounts,
+		Alts:          q.alts,
+		PlayerRanks:   q.ranks,
+		RollPicks:     q.rollPicks,
+		MainRoles:     q.mainRoles,
+		LastFlexed:    q.lastFlexed,
+		Celebrations:  q.celebrations,
+		Regions:       q.regions,
+		Duos:          q.duos,
+		Queuers:       q.queuers,
+		Boards:        q.boards,
+		Prefs:         q.prefs,
+		Stats:         q.stats,
+		Sessions:      q.sessions,
+		Promotions:    q.promotionWaits,
+		Schedules:     q.schedules,
+		StaleVoiceIDs: q.staleVoiceIDs,
+		SetupPrompted: q.setupPrompted,
+		MVPVote:       q.mvp.snapshot(),
+		Bracket:       q.bracket.snapshot(),
+		Jobs:          q.scheduler.snapshotLocked(),
+	}
+	for _, qu := range q.openQueuesLocked() {
+		qs := queueSnapshot{
+			Name:          qu.name,
+			ChannelID:     qu.channelID,
+			Size:          qu.size,
+			MessageID:     qu.currentMsgID,
+			Components:    qu.components,
+			OpenedBy:      qu.openedBy,
+			OpenedAt:      qu.openedAt,
+			NotifyMsgID:   qu.notifyMsgID,
+			OneMoreMsgID:  qu.oneMoreMsgID,
+			OneMoreSince:  qu.oneMoreSince,
+			OneMoreLangs:  qu.oneMoreLangs,
+			Note:          qu.note,
+			Title:         qu.title,
+			Game:          qu.game,
+			RankMin:       qu.rankMin,
+			RankMax:       qu.rankMax,
+			StackVoiceID:  qu.stackVoiceID,
+			PingMsgID:     qu.pingMsgID,
+			LastCallUntil: qu.lastCallUntil,
+			LastCallMsgID: qu.lastCallMsgID,
+			Reopened:      qu.reopened,
+			ReopenMsgID:   qu.reopenMsgID,
+			Counts:        qu.counts,
+			Reinvited:     qu.reinvited,
+			StaleAlerted:  qu.staleAlerted,
+			LastUser:      qu.lastUser,
+			LastAction:    qu.lastAction,
+			Users:         qu.users,
+			Waitlist:      qu.waitlist,
+			Conditional:   qu.conditional,
+			Declines:      qu.declines,
+			MapVote:       qu.mapVote.snapshot(),
+			Label:         qu.label,
+		}
+		if qu.closing != nil {
+			qs.ClosingUntil = qu.closing.until
+		}
+		if qu.readyCheck != nil {
+			qs.ReadyCheck = &readyCheckSnapshot{MessageID: qu.readyCheck.msgID, Deadline: qu.readyCheck.deadline}
+		}
+		for id, ready := range qu.ready {
+			if ready {
+				qs.Ready = append(qs.Ready, id)
+			}
+		}
+		for _, a := range qu.actions {
+			qs.Actions = append(qs.Actions, actionSnapshot{Kind: a.kind, User: a.user, At: a.at})
+		}
+		for _, w := range qu.watchers {
+			qs.Watchers = append(qs.Watchers, w)
+		}
+		for _, p := range qu.participants {
+			qs.Participants = append(qs.Participants, p)
+		}
+		snap.Queues = append(snap.Queues, qs)
+	}
+	return snap
+}
+
+// saveStateLocked writes the current state to the guild's statePath.
+// lock must be held
+func (q *queueState) saveStateLocked() {
+	if err := writeJSONFile(statePath(q.guildID), q.snapshotLocked()); err != nil {
+		log.Printf("error saving queue state: %v\n", err)
+	}
+}
+
+func (q *queueState) saveState() {
+	q.Lock()
+	defer q.Unlock()
+
+	q.saveStateLocked()
+}
+
+// restoreState loads the state saved before the last shutdown. Queues whose
+// message was deleted in the meantime are dropped; the rest are re-rendered
+// so their buttons pick up where they left off.
+func (q *queueState) restoreState(s *discordgo.Session) error {
+	b, err := os.ReadFile(statePath(q.guildID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snap stateSnapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return err
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	for id, accounts := range snap.Accounts {
+		q.accounts[id] = accounts
+	}
+	for id, flag := range snap.Alts {
+		q.alts[id] = flag
+	}
+	for id, tier := range snap.Ranks {
+		q.ranks[id] = &playerRank{Tier: tier}
+	}
+	for id, r := range snap.PlayerRanks {
+		q.ranks[id] = r
+	}
+	for id, picks := range snap.RollPicks {
+		q.rollPicks[id] = picks
+	}
+	for id, role := range snap.MainRoles {
+		q.mainRoles[id] = role
+	}
+	for id, at := range snap.LastFlexed {
+		q.lastFlexed[id] = at
+	}
+	for id, c := range snap.Celebrations {
+		q.celebrations[id] = c
+	}
+	for id, region := range snap.Regions {
+		q.regions[id] = region
+	}
+	for id, partner := range snap.Duos {
+		q.duos[id] = partner
+	}
+	for id, queuers := range snap.Queuers {
+		q.queuers[id] = queuers
+	}
+	for channelID, msgID := range snap.Boards {
+		q.boards[channelID] = msgID
+	}
+	for id, p := range snap.Prefs {
+		q.prefs[id] = p
+	}
+	for id, optIn := range snap.ReinviteOptIn {
+		q.updatePrefsLocked(id, func(p *userPrefs) {
+			p.Reinvites = p.Reinvites || optIn
+		})
+	}
+	for id, ps := range snap.Stats {
+		q.stats[id] = ps
+	}
+	q.sessions = snap.Sessions
+	q.promotionWaits = snap.Promotions
+	q.schedules = snap.Schedules
+	q.staleVoiceIDs = snap.StaleVoiceIDs
+	q.setupPrompted = snap.SetupPrompted
+	q.mvp = snap.MVPVote.restore()
+	q.bracket = snap.Bracket.restore()
+	for _, j := range snap.Jobs {
+		q.scheduler.jobs[j.Key] = j
+	}
+
+	for _, qs := range snap.Queues {
+		if _, err := s.ChannelMessage(qs.ChannelID, qs.MessageID); err != nil {
+			log.Printf("dropping saved queue %q, its message is gone: %v\n", qs.Name, err)
+			continue
+		}
+		qu := newQueue(qs.Name)
+		q.queues[qs.Name] = qu
+		q.selectQueueLocked(qu)
+		q.channelID = qs.ChannelID
+		q.size = qs.Size
+		q.currentMsgID = qs.MessageID
+		q.components = qs.Components
+		q.openedBy = qs.OpenedBy
+		q.openedAt = qs.OpenedAt
+		q.notifyMsgID = qs.NotifyMsgID
+		q.oneMoreMsgID = qs.OneMoreMsgID
+		q.oneMoreSince = qs.OneMoreSince
+		q.oneMoreLangs = qs.OneMoreLangs
+		q.note = qs.Note
+		q.title = qs.Title
+		q.game = qs.Game
+		q.rankMin = qs.RankMin
+		q.rankMax = qs.RankMax
+		q.stackVoiceID = qs.StackVoiceID
+		q.pingMsgID = qs.PingMsgID
+		q.lastCallUntil = qs.LastCallUntil
+		q.lastCallMsgID = qs.LastCallMsgID
+		if !qs.ClosingUntil.IsZero() {
+			q.closing = &pendingClose{until: qs.ClosingUntil}
+		}
+		q.reopened = qs.Reopened
+		q.reopenMsgID = qs.ReopenMsgID
+		q.counts = qs.Counts
+		for _, p := range qs.Participants {
+			q.participants[p.ID] = p
+		}
+		q.reinvited = qs.Reinvited
+		q.staleAlerted = qs.StaleAlerted
+		q.lastUser = qs.LastUser
+		q.lastAction = qs.LastAction
+		q.users = qs.Users
+		q.waitlist = qs.Waitlist
+		q.conditional = qs.Conditional
+		q.declines = qs.Declines
+		for _, a := range qs.Actions {
+			q.actions = append(q.actions, queueAction{kind: a.Kind, user: a.User, at: a.At})
+		}
+		for _, w := range qs.Watchers {
+			q.watchers[w.ID] = w
+		}
+		q.mapVote = qs.MapVote.restore()
+		q.label = qs.Label
+		if rc := qs.ReadyCheck; rc != nil {
+			q.readyCheck = &readyCheck{msgID: rc.MessageID, deadline: rc.Deadline}
+		}
+		for _, id := range qs.Ready {
+			q.ready[id] = true
+		}
+		if err := q.editQueueMessageLocked(s, ""); err != nil {
+			log.Printf("error re-rendering restored queue %s: %v\n", q.currentMsgID, err)
+		}
+		log.Printf("restored queue %s with %d users\n", q.currentMsgID, len(q.users))
+	}
+	q.selectQueueLocked(q.queues[""])
+	q.updatePresenceLocked()
+	return nil
+}
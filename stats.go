@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// reactionWindow is how long after a fill ping showing up still counts as a
+// reaction to it.
+const reactionWindow = time.Hour
+
+type playerStats struct {
+	ReactionTotal time.Duration `json:"reaction_total"`
+	ReactionCount int           `json:"reaction_count"`
+
+	// QueuedTotal is the lifetime time spent waiting in queues, from joining
+	// until the queue filled or the player left.
+	QueuedTotal time.Duration `json:"queued_total"`
+
+	// MVPCount is how many session MVP votes the player has won.
+	MVPCount int `json:"mvp_count"`
+
+	// LastJoined is when the player last joined a queue or its waitlist.
+	LastJoined time.Time `json:"last_joined,omitempty"`
+}
+
+func (p *playerStats) averageReaction() time.Duration {
+	if p.ReactionCount == 0 {
+		return 0
+	}
+	return p.ReactionTotal / time.Duration(p.ReactionCount)
+}
+
+// lock must be held
+func (q *queueState) statsLocked(userID string) *playerStats {
+	ps, ok := q.stats[userID]
+	if !ok {
+		ps = &playerStats{}
+		q.stats[userID] = ps
+	}
+	return ps
+}
+
+// recordWaitLocked adds the member's time in the queue to their stats. It
+// only counts once per member, when they leave or the queue fills or closes.
+// lock must be held
+func (q *queueState) recordWaitLocked(m *queueMember) {
+	if m.waited {
+		return
+	}
+	m.waited = true
+	q.statsLocked(m.ID).QueuedTotal += time.Since(m.JoinedAt)
+}
+
+// startReactionTimersLocked starts timing how long each queued user takes to
+// show up after the fill ping. Users already in voice showed up right away,
+// since there's no voice update to wait for.
+// lock must be held
+func (q *queueState) startReactionTimersLocked(s *discordgo.Session) {
+	now := time.Now()
+	for _, user := range q.users {
+		q.pendingReactions[user.ID] = now
+		if vs, err := s.State.VoiceState(q.guildID, user.ID); err == nil && vs.ChannelID != "" {
+			q.recordReactionLocked(user.ID)
+		}
+	}
+}
+
+// recordReactionLocked stops the user's reaction timer, if one is running.
+// lock must be held
+func (q *queueState) recordReactionLocked(userID string) {
+	pingedAt, ok := q.pendingReactions[userID]
+	if !ok {
+		return
+	}
+	delete(q.pendingReactions, userID)
+	if d := time.Since(pingedAt); d <= reactionWindow {
+		ps := q.statsLocked(userID)
+		ps.ReactionTotal += d
+		ps.ReactionCount++
+	}
+}
+
+// expireReactionsLocked drops reaction timers for users who never showed up.
+// lock must be held
+func (q *queueState) expireReactionsLocked() {
+	for userID, pingedAt := range q.pendingReactions {
+		if time.Since(pingedAt) > reactionWindow {
+			delete(q.pendingReactions, userID)
+		}
+	}
+}
+
+func (q *queueState) handleVoiceStateUpdate(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	if v.GuildID != q.guildID || v.ChannelID == "" {
+		return
+	}
+	if v.BeforeUpdate != nil && v.BeforeUpdate.ChannelID != "" {
+		return
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	if _, ok := q.pendingReactions[v.UserID]; ok {
+		q.recordReactionLocked(v.UserID)
+		q.saveStateLocked()
+	}
+}
+
+func (q *queueState) handleStats(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	var ids []string
+	for id, ps := range q.stats {
+		if ps.ReactionCount > 0 {
+			ids = append(ids, id)
+		}
+	}
+	own := q.stats[i.Member.User.ID]
+	leaderboard := q.leaderboardLocked()
+	if leaderboard == "" && len(ids) == 0 && (own == nil || own.QueuedTotal < time.Minute && own.MVPCount == 0) {
+		respondEphemeral(s, i, "No stats yet.")
+		return
+	}
+	sort.Slice(ids, func(a, b int) bool {
+		return q.stats[ids[a]].averageReaction() < q.stats[ids[b]].averageReaction()
+	})
+
+	var sb strings.Builder
+	sb.WriteString(leaderboard)
+	if len(ids) > 0 {
+		sb.WriteString("### Average time to show up after the fill ping\n")
+	}
+	for idx, id := range ids {
+		ps := q.stats[id]
+		sb.WriteString(fmt.Sprintf("%d. <@%s> %s (%d %s)\n", idx+1, id, ps.averageReaction().Round(time.Second), ps.ReactionCount, pluralize(ps.ReactionCount, "game", "games")))
+	}
+	if own != nil && own.QueuedTotal >= time.Minute {
+		sb.WriteString(fmt.Sprintf("\n<@%s> has spent %s waiting in queues.\n", i.Member.User.ID, humanDuration(own.QueuedTotal)))
+	}
+	if own != nil && own.MVPCount > 0 {
+		sb.WriteString(fmt.Sprintf("<@%s> has been session MVP %d %s.\n", i.Member.User.ID, own.MVPCount, pluralize(own.MVPCount, "time", "times")))
+	}
+
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:         sb.String(),
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	}); err != nil {
+		log.Printf("error responding with stats: %v\n", err)
+	}
+}
+
+// humanDuration formats d in whole hours, or minutes when under an hour.
+func humanDuration(d time.Duration) string {
+	if d < time.Hour {
+		m := int(d / time.Minute)
+		return fmt.Sprintf("%d %s", m, pluralize(m, "minute", "minutes"))
+	}
+	h := int(d / time.Hour)
+	return fmt.Sprintf("%d %s", h, pluralize(h, "hour", "hours"))
+}
+
+// queueCounts tracks how a single queue went while it was open.
+type queueCounts struct {
+	Peak   int `json:"peak"`
+	Joins  int `json:"joins"`
+	Leaves int `json:"leaves"`
+	// FilledAt is zero if the queue never filled.
+	FilledAt time.Time `json:"filled_at"`
+}
+
+// closedStatsLocked sums up the queue for its closed message.
+// lock must be held
+func (q *queueState) closedStatsLocked() string {
+	filled := "didn't fill"
+	if !q.counts.FilledAt.IsZero() {
+		filled = "filled"
+	}
+	return fmt.Sprintf("-# Open for %s · peak %d/%d · %d %s, %d %s · %s",
+		humanDuration(time.Since(q.openedAt)), q.counts.Peak, q.size,
+		q.counts.Joins, pluralize(q.counts.Joins, "join", "joins"),
+		q.counts.Leaves, pluralize(q.counts.Leaves, "leave", "leaves"),
+		filled)
+}
+
+// leaderboardSize is how many players the /standby-stats leaderboard lists.
+const leaderboardSize = 10
+
+// leaderboardLocked lists the most active players from the queue history,
+// or returns "" if there's no history yet.
+// lock must be held
+func (q *queueState) leaderboardLocked() string {
+	if q.history == nil {
+		return ""
+	}
+	board, err := q.history.leaderboard(q.guildID, leaderboardSize)
+	if err != nil {
+		log.Printf("error reading leaderboard: %v\n", err)
+		return ""
+	}
+	if len(board) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("### Most active players\n")
+	for idx, r := range board {
+		sb.WriteString(fmt.Sprintf("%d. <@%s> %d %s played, queued %d %s", idx+1, r.UserID,
+			r.Played, pluralize(r.Played, "game", "games"), r.Queued, pluralize(r.Queued, "time", "times")))
+		if r.Flaked > 0 {
+			sb.WriteString(fmt.Sprintf(", left a full queue %d %s", r.Flaked, pluralize(r.Flaked, "time", "times")))
+		}
+		sb.WriteString("\n")
+	}
+	avg, filled, err := q.history.averageFill(q.guildID)
+	if err != nil {
+		log.Printf("error reading average fill time: %v\n", err)
+	} else if filled > 0 {
+		sb.WriteString(fmt.Sprintf("-# Queues take %s to fill on average, over %d %s.\n", humanDuration(avg), filled, pluralize(filled, "game", "games")))
+	}
+	games, err := q.history.games(q.guildID, leaderboardSize)
+	if err != nil {
+		log.Printf("error reading most played games: %v\n", err)
+	} else if len(games) > 0 {
+		parts := make([]string, len(games))
+		for idx, g := range games {
+			parts[idx] = fmt.Sprintf("%s %d", g.Game, g.Played)
+		}
+		sb.WriteString("-# Most played: " + strings.Join(parts, " · ") + "\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxSuggestions is how many players the one-more message mentions.
+const maxSuggestions = 3
+
+// suggestLastSlotLocked returns a line naming the online players who most
+// often played on this weekday in past sessions, or "" if there are none.
+// lock must be held
+func (q *queueState) suggestLastSlotLocked(s *discordgo.Session) string {
+	weekday := time.Now().Weekday()
+	counts := make(map[string]int)
+	for _, sess := range q.sessions {
+		if sess.FilledAt.Weekday() != weekday {
+			continue
+		}
+		for _, p := range sess.Players {
+			counts[p.ID]++
+		}
+	}
+
+	var candidates []string
+	for id := range counts {
+		if q.isQueuedLocked(id) || !isOnline(s, q.guildID, id) {
+			continue
+		}
+		candidates = append(candidates, id)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if counts[candidates[i]] != counts[candidates[j]] {
+			return counts[candidates[i]] > counts[candidates[j]]
+		}
+		return candidates[i] < candidates[j]
+	})
+	if len(candidates) > maxSuggestions {
+		candidates = candidates[:maxSuggestions]
+	}
+
+	mentions := make([]string, len(candidates))
+	for i, id := range candidates {
+		mentions[i] = fmt.Sprintf("<@%s>", id)
+	}
+	var who string
+	if len(mentions) == 1 {
+		who = mentions[0] + " usually plays"
+	} else {
+		who = strings.Join(mentions[:len(mentions)-1], ", ") + " and " + mentions[len(mentions)-1] + " usually play"
+	}
+	return fmt.Sprintf("%s on %ss and %s online", who, weekday, pluralize(len(mentions), "is", "are"))
+}
+
+// isOnline reports whether the user's cached presence is anything but offline.
+// Presences are only cached with the guild presences intent.
+func isOnline(s *discordgo.Session, guildID, userID string) bool {
+	p, err := s.State.Presence(guildID, userID)
+	if err != nil {
+		return false
+	}
+	return p.Status != discordgo.StatusOffline && p.Status != discordgo.StatusInvisible
+}
+
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
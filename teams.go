@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fillButtons are shown on the fill notification. Queues with an even size
+// can also be split into two teams.
+func fillButtons(name string, size int) []discordgo.MessageComponent {
+	buttons := lobbyCodeButton(name)
+	if size%2 != 0 {
+		return buttons
+	}
+	row := buttons[0].(discordgo.ActionsRow)
+	row.Components = append(row.Components, discordgo.Button{
+		Label:    "Split teams",
+		Style:    discordgo.SecondaryButton,
+		CustomID: queueCustomID("split_teams", name),
+		Emoji:    &discordgo.ComponentEmoji{Name: "⚖️"},
+	})
+	buttons[0] = row
+	return buttons
+}
+
+// splitTeams divides players into two teams of equal size. If anyone has a
+// rating, each player in turn from the highest rated goes to the team with
+// the lower total, and players without one count as the average. Otherwise
+// the teams are random.
+func splitTeams(players []*discordgo.User, rating func(userID string) int) [2][]*discordgo.User {
+	players = append([]*discordgo.User(nil), players...)
+	rand.Shuffle(len(players), func(i, j int) { players[i], players[j] = players[j], players[i] })
+
+	score := teamScorer(players, rating)
+	sort.SliceStable(players, func(a, b int) bool {
+		return score(players[a]) > score(players[b])
+	})
+
+	var (
+		teams  [2][]*discordgo.User
+		totals [2]int
+	)
+	half := (len(players) + 1) / 2
+	for _, p := range players {
+		t := 0
+		if len(teams[0]) == half || (len(teams[1]) < half && totals[1] < totals[0]) {
+			t = 1
+		}
+		teams[t] = append(teams[t], p)
+		totals[t] += score(p)
+	}
+	return teams
+}
+
+// teamScorer returns the players' ratings for balancing teams, with players
+// without one counting as the average.
+func teamScorer(players []*discordgo.User, rating func(userID string) int) func(p *discordgo.User) int {
+	total, rated := 0, 0
+	for _, p := range players {
+		if r := rating(p.ID); r != 0 {
+			total += r
+			rated++
+		}
+	}
+	return func(p *discordgo.User) int {
+		if r := rating(p.ID); r != 0 {
+			return r
+		}
+		if rated == 0 {
+			return 0
+		}
+		return total / rated
+	}
+}
+
+// handleSplitTeams posts two teams made from the full queue. Only the
+// opener and admins can split, and splitting again reshuffles.
+func (q *queueState) handleSplitTeams(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	user := i.Member.User
+	if !q.canManageLocked(i.Member) {
+		respondEphemeral(s, i, "Only whoever opened the queue or an admin can split the teams.")
+		return
+	}
+	if q.currentMsgID == "" || len(q.users) < q.size || len(q.users)%2 != 0 {
+		respondEphemeral(s, i, "The queue needs to be full to split the teams.")
+		return
+	}
+
+	players := make([]*discordgo.User, len(q.users))
+	for idx, m := range q.users {
+		players[idx] = m.User
+	}
+	teams := q.balanceTeamsLocked(players)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("### Teams for %s\n", q.titleLocked()))
+	for t, team := range teams {
+		sb.WriteString(fmt.Sprintf("**%s**", teamName(t)))
+		if avg := q.averageSkillLocked(team); avg != "" {
+			sb.WriteString(" (avg " + avg + ")")
+		}
+		sb.WriteString(": " + userMentions(team) + "\n")
+	}
+	log.Printf("%s (%s) split queue %s into teams\n", user.Username, user.ID, q.currentMsgID)
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content:         sb.String(),
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	}); err != nil {
+		log.Printf("error posting teams: %v\n", err)
+	}
+}
+
+// skillLocked returns the user's rating for balancing teams, 0 if unknown.
+// lock must be held
+func (q *queueState) skillLocked(userID string) int {
+	if r, ok := q.ranks[userID]; ok {
+		return r.skill()
+	}
+	return 0
+}
+
+// averageSkillLocked describes the team's average rating, or "" if nobody
+// on it has one.
+// lock must be held
+func (q *queueState) averageSkillLocked(team []*discordgo.User) string {
+	total, rated := 0, 0
+	for _, u := range team {
+		if r := q.skillLocked(u.ID); r != 0 {
+			total += r
+			rated++
+		}
+	}
+	if rated == 0 {
+		return ""
+	}
+	return rankFromSkill((total + rated/2) / rated).String()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	templateFill    = "fill"
+	templatePromote = "promote"
+)
+
+var defaultTemplates = map[string]string{
+	templateFill:    "There are enough users for a game{{with .Game}} of {{.}}{{end}}! {{.Players}}",
+	templatePromote: "{{.Player}} a spot opened up, you've been promoted from the waitlist!",
+}
+
+// templateData is available to announcement templates.
+type templateData struct {
+	// Players mentions everyone in the queue, comma separated.
+	Players string
+	// Player mentions the user the message is about, e.g. who was promoted.
+	Player string
+	// Game is the queue's game, or its name if it has none, empty for the
+	// default queue.
+	Game string
+	Note string
+}
+
+func parseAnnouncementTemplate(text string) (*template.Template, error) {
+	t, err := template.New("announcement").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// Catch references to fields that don't exist before saving.
+	if err := t.Execute(&strings.Builder{}, templateData{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// renderTemplate renders the guild's template for kind, falling back to the
+// default if the custom one fails.
+func renderTemplate(cfg guildConfig, kind string, data templateData) string {
+	if text, ok := cfg.Templates[kind]; ok {
+		t, err := parseAnnouncementTemplate(text)
+		if err == nil {
+			var sb strings.Builder
+			if err = t.Execute(&sb, data); err == nil {
+				return sb.String()
+			}
+		}
+		log.Printf("error rendering %s template, using default: %v\n", kind, err)
+	}
+	var sb strings.Builder
+	template.Must(parseAnnouncementTemplate(defaultTemplates[kind])).Execute(&sb, data)
+	return sb.String()
+}
+
+// lock must be held
+func (q *queueState) templateDataLocked() templateData {
+	mentions := make([]string, len(q.users))
+	for i, user := range q.users {
+		mentions[i] = fmt.Sprintf("<@%s>", user.ID)
+	}
+	game := q.game
+	if game == "" {
+		game = q.name
+	}
+	return templateData{
+		Players: strings.Join(mentions, ", "),
+		Game:    game,
+		Note:    q.note,
+	}
+}
+
+// announcePromotionsLocked posts a message for each user promoted from the
+// waitlist since the last call.
+// lock must be held
+func (q *queueState) announcePromotionsLocked(s *discordgo.Session) {
+	cfg := q.configs.get(q.guildID)
+	for _, user := range q.promoted {
+		data := q.templateDataLocked()
+		data.Player = fmt.Sprintf("<@%s>", user.ID)
+		if _, err := s.ChannelMessageSend(q.channelID, renderTemplate(cfg, templatePromote, data)); err != nil {
+			log.Printf("error sending promotion message: %v\n", err)
+		}
+		q.dmPromotedLocked(s, user)
+	}
+	q.promoted = nil
+}
+
+func (q *queueState) configTemplate(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	kind := opts["kind"].StringValue()
+	var text string
+	if opt, ok := opts["template"]; ok {
+		text = opt.StringValue()
+	}
+	if text != "" {
+		if _, err := parseAnnouncementTemplate(text); err != nil {
+			return fmt.Sprintf("That template doesn't work: %v\nAvailable fields are {{.Players}}, {{.Player}}, {{.Game}} and {{.Note}}.", err), nil
+		}
+	}
+
+	err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		if text == "" {
+			delete(cfg.Templates, kind)
+			return
+		}
+		if cfg.Templates == nil {
+			cfg.Templates = make(map[string]string)
+		}
+		cfg.Templates[kind] = text
+	})
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return fmt.Sprintf("The %s message is back to the default: `%s`", kind, defaultTemplates[kind]), nil
+	}
+	return fmt.Sprintf("The %s message is now: `%s`", kind, text), nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// undoCloseWindow is how long whoever pressed Close has to undo it.
+	undoCloseWindow = 30 * time.Second
+	// jobUndoClose closes a queue once its undo window is over.
+	jobUndoClose = "undo_close"
+)
+
+func undoCloseJobKey(name string) string {
+	return jobUndoClose + ":" + name
+}
+
+// pendingClose is a close pressed on the Close button that hasn't happened
+// yet. The queue stays open with its buttons hidden until then, so undoing
+// the close has nothing to take back.
+type pendingClose struct {
+	until time.Time
+	// interaction and msgID are the ephemeral message with the Undo button,
+	// unset for a close restored from the state.
+	interaction *discordgo.Interaction
+	msgID       string
+}
+
+// closeQueuePendingLocked hides the queue's buttons for the Close button and
+// sends whoever pressed it an Undo button. The queue closes when
+// jobUndoClose runs undoCloseWindow later, unless it's undone first. The
+// interaction must already have been responded to.
+// lock must be held
+func (q *queueState) closeQueuePendingLocked(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	p := &pendingClose{
+		until:       time.Now().Add(undoCloseWindow),
+		interaction: i.Interaction,
+	}
+	q.closing = p
+	q.scheduler.scheduleLocked(jobUndoClose, undoCloseJobKey(q.name), p.until, q.name)
+	q.refreshLocked(s)
+
+	m, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: fmt.Sprintf("The queue closes <t:%d:R>. Pressed Close by mistake? Undo it before then.", p.until.Unix()),
+		Flags:   discordgo.MessageFlagsEphemeral,
+		Components: []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Undo",
+					Style:    discordgo.PrimaryButton,
+					Emoji:    &discordgo.ComponentEmoji{Name: "↩️"},
+					CustomID: queueCustomID("undo_close", q.name),
+				},
+			}},
+		},
+	})
+	if err != nil {
+		log.Printf("error sending close undo: %v\n", err)
+		return
+	}
+	p.msgID = m.ID
+}
+
+// handleUndoClose keeps the queue open, showing its buttons again.
+func (q *queueState) handleUndoClose(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.selectQueueLocked(q.queueLocked(interactionQueueName(i)))
+	if q.closing == nil {
+		q.respondUndoLocked(s, i, "It's too late to undo closing the queue.")
+		return
+	}
+	q.scheduler.cancelLocked(undoCloseJobKey(q.name))
+	q.closing = nil
+	q.refreshLocked(s)
+
+	log.Printf("%s (%s) undid closing queue %s\n", i.Member.User.Username, i.Member.User.ID, q.currentMsgID)
+	q.respondUndoLocked(s, i, "The queue stays open with everyone in it.")
+}
+
+// respondUndoLocked replaces the undo message with content.
+// lock must be held
+func (q *queueState) respondUndoLocked(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	}); err != nil {
+		log.Printf("interaction %s: error responding to undo: %v\n", interactionRef(i), err)
+	}
+}
+
+// endPendingCloseLocked drops the selected queue's pending close as it
+// closes, and takes the Undo button away.
+// lock must be held
+func (q *queueState) endPendingCloseLocked(s *discordgo.Session) {
+	p := q.closing
+	if p == nil {
+		return
+	}
+	q.scheduler.cancelLocked(undoCloseJobKey(q.name))
+	q.closing = nil
+	if p.msgID == "" {
+		return
+	}
+	content := "You closed the queue."
+	if _, err := s.FollowupMessageEdit(p.interaction, p.msgID, &discordgo.WebhookEdit{
+		Content:    &content,
+		Components: &[]discordgo.MessageComponent{},
+	}); err != nil {
+		log.Printf("error ending close undo: %v\n", err)
+	}
+}
+
+// runUndoCloseJobLocked closes the queue once its undo window is over.
+// lock must be held
+func (q *queueState) runUndoCloseJobLocked(s *discordgo.Session, j *job) {
+	q.selectQueueLocked(q.queueLocked(j.Args[0]))
+	if q.closing == nil || q.currentMsgID == "" {
+		return
+	}
+	q.closeQueueLocked(s)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxMapPool is how many map buttons fit on a message.
+const maxMapPool = 25
+
+// The sides the team that didn't make the last ban can start on.
+const (
+	vetoAttack  = "Attack"
+	vetoDefense = "Defense"
+)
+
+var vetoCommand = &discordgo.ApplicationCommand{
+	Name:        "standby-veto",
+	Description: "Captains: start the map veto for your bracket match",
+}
+
+// mapVeto is a ban-until-one-left veto between the two captains of a match.
+// The team that didn't make the last ban picks its starting side.
+type mapVeto struct {
+	msgID  string
+	number int
+	pool   []string
+	// banned maps pool index to the team that banned it
+	banned map[int]int
+	order  []int
+	turn   int
+	// side is the side the picking team starts on once chosen
+	side string
+}
+
+func (v *mapVeto) remaining() []int {
+	var idx []int
+	for i := range v.pool {
+		if _, ok := v.banned[i]; !ok {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+func (v *mapVeto) finalMap() string {
+	if rest := v.remaining(); len(rest) == 1 {
+		return v.pool[rest[0]]
+	}
+	return ""
+}
+
+func (q *queueState) handleVeto(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	b := q.bracket
+	if b == nil {
+		respondEphemeral(s, i, "There is no bracket running.")
+		return
+	}
+	team := b.captainTeam(i.Member.User.ID)
+	if team == noTeam {
+		respondEphemeral(s, i, "Only team captains can start a map veto.")
+		return
+	}
+	m, number := b.currentMatch(team)
+	if m == nil {
+		respondEphemeral(s, i, "Your team has no match to play right now.")
+		return
+	}
+	if m.veto != nil {
+		respondEphemeral(s, i, "The veto for this match has already started.")
+		return
+	}
+	pool := q.configs.get(q.guildID).MapPool
+	if len(pool) < 2 {
+		respondEphemeral(s, i, "Ask an admin to set a map pool with /standby-config maps first.")
+		return
+	}
+
+	v := &mapVeto{
+		number: number,
+		pool:   pool,
+		banned: make(map[int]int),
+		// The captain who asked for the veto bans first.
+		turn: team,
+	}
+	msg, err := s.ChannelMessageSendComplex(b.channelID, &discordgo.MessageSend{
+		Content:         v.content(b, m),
+		Components:      v.components(m),
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{b.teams[v.turn][0].ID}},
+	})
+	if err != nil {
+		log.Printf("interaction %s: error sending map veto: %v\n", interactionRef(i), err)
+		respondError(s, i, "Couldn't post the map veto.")
+		return
+	}
+	v.msgID = msg.ID
+	m.veto = v
+	respondEphemeral(s, i, "Map veto started.")
+}
+
+func (v *mapVeto) content(b *bracket, m *bracketMatch) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("### Map veto, match %d: %s vs %s\n", v.number, teamName(m.a), teamName(m.b)))
+	for _, idx := range v.order {
+		sb.WriteString(fmt.Sprintf("%s banned ~~%s~~\n", teamName(v.banned[idx]), v.pool[idx]))
+	}
+	switch {
+	case v.side != "":
+		other := vetoDefense
+		if v.side == vetoDefense {
+			other = vetoAttack
+		}
+		sb.WriteString(fmt.Sprintf("\nMap: **%s**\n%s starts on %s, %s on %s.", v.finalMap(), teamName(v.turn), v.side, teamName(m.opponent(v.turn)), other))
+	case v.finalMap() != "":
+		sb.WriteString(fmt.Sprintf("\nMap: **%s**\n<@%s>, pick %s's starting side.", v.finalMap(), b.teams[v.turn][0].ID, teamName(v.turn)))
+	default:
+		sb.WriteString(fmt.Sprintf("\n<@%s>, ban a map for %s.", b.teams[v.turn][0].ID, teamName(v.turn)))
+	}
+	return sb.String()
+}
+
+func (v *mapVeto) components(m *bracketMatch) []discordgo.MessageComponent {
+	prefix := "veto:" + strconv.Itoa(v.number) + ":"
+	switch {
+	case v.side != "":
+		return []discordgo.MessageComponent{}
+	case v.finalMap() != "":
+		return []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: vetoAttack, Style: discordgo.PrimaryButton, CustomID: prefix + vetoAttack},
+				discordgo.Button{Label: vetoDefense, Style: discordgo.PrimaryButton, CustomID: prefix + vetoDefense},
+			}},
+		}
+	}
+	var rows []discordgo.MessageComponent
+	var row discordgo.ActionsRow
+	for _, idx := range v.remaining() {
+		row.Components = append(row.Components, discordgo.Button{
+			Label:    v.pool[idx],
+			Style:    discordgo.DangerButton,
+			CustomID: prefix + strconv.Itoa(idx),
+		})
+		if len(row.Components) == 5 {
+			rows = append(rows, row)
+			row = discordgo.ActionsRow{}
+		}
+	}
+	if len(row.Components) > 0 {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// handleVetoButton applies a ban or side pick from the captain whose turn it is.
+func (q *queueState) handleVetoButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	q.Lock()
+	defer q.Unlock()
+
+	args := customIDArgs(i)
+	number, _ := strconv.Atoi(args[0])
+	b := q.bracket
+	var m *bracketMatch
+	if b != nil && len(args) == 2 {
+		m = b.match(number)
+	}
+	if m == nil || m.veto == nil || m.veto.msgID != i.Message.ID {
+		respondEphemeral(s, i, "This veto is no longer running.")
+		return
+	}
+	v := m.veto
+	if b.captainTeam(i.Member.User.ID) != v.turn {
+		respondEphemeral(s, i, "It's not your turn.")
+		return
+	}
+
+	if v.finalMap() != "" {
+		if v.side != "" || (args[1] != vetoAttack && args[1] != vetoDefense) {
+			respondEphemeral(s, i, "That side can't be picked.")
+			return
+		}
+		v.side = args[1]
+		log.Printf("map veto for match %d finished on %s\n", v.number, v.finalMap())
+	} else {
+		idx, err := strconv.Atoi(args[1])
+		if _, banned := v.banned[idx]; err != nil || banned || idx < 0 || idx >= len(v.pool) {
+			respondEphemeral(s, i, "That map can't be banned.")
+			return
+		}
+		v.banned[idx] = v.turn
+		v.order = append(v.order, idx)
+		v.turn = m.opponent(v.turn)
+	}
+
+	content := v.content(b, m)
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:         content,
+			Components:      v.components(m),
+			AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{b.teams[v.turn][0].ID}},
+		},
+	}); err != nil {
+		log.Printf("error updating map veto: %v\n", err)
+	}
+	if v.side != "" {
+		q.editBracketLocked(s)
+	}
+}
+
+func (q *queueState) configMaps(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	var pool []string
+	if opt, ok := opts["maps"]; ok {
+		pool = splitList(opt.StringValue())
+	}
+	if len(pool) > maxMapPool {
+		return fmt.Sprintf("The map pool can have at most %d maps.", maxMapPool), nil
+	}
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		cfg.MapPool = pool
+	}); err != nil {
+		return "", err
+	}
+	if len(pool) == 0 {
+		return "Map pool cleared.", nil
+	}
+	return fmt.Sprintf("Map pool set to %s.", strings.Join(pool, ", ")), nil
+}
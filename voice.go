@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// voiceModeRequire only lets members in the voice channel join the queue.
+	voiceModeRequire = "require"
+	// voiceModeAuto also joins members when they enter the voice channel.
+	voiceModeAuto = "auto"
+)
+
+// voiceQueue ties a queue to a voice channel.
+type voiceQueue struct {
+	ChannelID string `json:"channel_id"`
+	Mode      string `json:"mode"`
+	// AutoLeave removes members from the queue when they leave the channel.
+	AutoLeave bool `json:"auto_leave,omitempty"`
+}
+
+// handleVoiceQueueUpdate joins members entering an auto-join voice channel
+// and removes those leaving one with auto leave set.
+func (q *queueState) handleVoiceQueueUpdate(s *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	if v.GuildID != q.guildID {
+		return
+	}
+	var before string
+	if v.BeforeUpdate != nil {
+		before = v.BeforeUpdate.ChannelID
+	}
+	if before == v.ChannelID {
+		// Mute, deafen and the like
+		return
+	}
+	cfg := q.configs.get(q.guildID)
+	if len(cfg.VoiceQueues) == 0 {
+		return
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	changed := false
+	for name, vq := range cfg.VoiceQueues {
+		q.selectQueueLocked(q.queueLocked(name))
+		if q.currentMsgID == "" {
+			continue
+		}
+		switch {
+		case v.ChannelID == vq.ChannelID && vq.Mode == voiceModeAuto:
+			if v.Member == nil || !q.canAutoJoinLocked(v.UserID) {
+				continue
+			}
+			q.removeConditionalLocked(v.UserID)
+			q.removeDeclineLocked(v.UserID)
+			q.addUsersLocked(q.withDuoLocked(v.Member.User), joinSourceVoice)
+			log.Printf("%s (%s) joined queue %s from voice\n", v.Member.User.Username, v.UserID, q.currentMsgID)
+		case before == vq.ChannelID && vq.AutoLeave:
+			m := q.queuedMemberLocked(v.UserID)
+			if m == nil {
+				continue
+			}
+			q.leaveLocked(m.User)
+			q.promoteLocked()
+			log.Printf("%s (%s) left queue %s by leaving voice\n", m.Username, v.UserID, q.currentMsgID)
+		default:
+			continue
+		}
+		q.refreshLocked(s)
+		changed = true
+	}
+	if changed {
+		q.saveStateLocked()
+	}
+}
+
+// canAutoJoinLocked reports whether a member entering voice should be added
+// to the selected queue, applying the same rules as the Join button unless
+// they turned auto-join off.
+// lock must be held
+func (q *queueState) canAutoJoinLocked(userID string) bool {
+	return !q.prefsLocked(userID).NoVoiceAutoJoin && q.canJoinLocked(userID)
+}
+
+// canJoinLocked applies the Join button's account, rank and alt rules to a
+// user who isn't queued yet, for joins that don't come from the button.
+// lock must be held
+func (q *queueState) canJoinLocked(userID string) bool {
+	return !q.isQueuedLocked(userID) && q.joinRuleLocked(userID) == "" && q.inRankBracketLocked(userID)
+}
+
+func (q *queueState) configVoice(opts map[string]*discordgo.ApplicationCommandInteractionDataOption) (string, error) {
+	var name string
+	if opt, ok := opts["name"]; ok {
+		name = normalizeQueueName(opt.StringValue())
+	}
+	mode := opts["mode"].StringValue()
+	vq := &voiceQueue{Mode: mode}
+	if opt, ok := opts["channel"]; ok {
+		vq.ChannelID = opt.ChannelValue(nil).ID
+	} else if mode != "off" {
+		return "Pick a voice channel.", nil
+	}
+	if opt, ok := opts["leave"]; ok {
+		vq.AutoLeave = opt.BoolValue()
+	}
+
+	if err := q.configs.update(q.guildID, func(cfg *guildConfig) {
+		if mode == "off" {
+			delete(cfg.VoiceQueues, name)
+			return
+		}
+		if cfg.VoiceQueues == nil {
+			cfg.VoiceQueues = make(map[string]*voiceQueue)
+		}
+		cfg.VoiceQueues[name] = vq
+	}); err != nil {
+		return "", err
+	}
+
+	var reply string
+	switch mode {
+	case "off":
+		return "The queue no longer depends on voice.", nil
+	case voiceModeRequire:
+		reply = fmt.Sprintf("Members need to be in <#%s> to join the queue.", vq.ChannelID)
+	case voiceModeAuto:
+		reply = fmt.Sprintf("Members joining <#%s> are added to the queue.", vq.ChannelID)
+	}
+	if vq.AutoLeave {
+		reply += " Leaving the channel removes them from it."
+	}
+	return reply, nil
+}
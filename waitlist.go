@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// interactionTokenTTL is how long Discord accepts follow-ups to an
+// interaction, less a minute to be safe.
+const interactionTokenTTL = 14 * time.Minute
+
+// waitlistNotice tracks what a waitlisted user was last told about their
+// position.
+type waitlistNotice struct {
+	pos int
+	// interaction and msgID are the ephemeral follow-up that's edited as the
+	// position changes, until its token expires and DMs take over.
+	interaction *discordgo.Interaction
+	msgID       string
+	sentAt      time.Time
+}
+
+// waitlistPositionMessage tells a member their position, and how long they
+// can expect to wait if there's an estimate, see eta.go.
+func waitlistPositionMessage(pos int, eta string) string {
+	content := fmt.Sprintf("You're #%d on the waitlist. I'll let you know when you move up.", pos)
+	if pos == 1 {
+		content = "You're #1 on the waitlist, you'll get the next open slot."
+	}
+	if eta != "" {
+		content += fmt.Sprintf("\n-# Expected wait: %s.", eta)
+	}
+	return content
+}
+
+// waitlistPositionLocked returns the user's 1-based position on the
+// waitlist, or 0 if they aren't on it.
+// lock must be held
+func (q *queueState) waitlistPositionLocked(userID string) int {
+	for idx, m := range q.waitlist {
+		if m.ID == userID {
+			return idx + 1
+		}
+	}
+	return 0
+}
+
+// sendWaitlistPositionLocked tells the user who just clicked Join or Fill
+// where they landed if it was on the waitlist. The interaction must already
+// have been responded to.
+// lock must be held
+func (q *queueState) sendWaitlistPositionLocked(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := i.Member.User.ID
+	pos := q.waitlistPositionLocked(userID)
+	if pos == 0 {
+		return
+	}
+	m, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: waitlistPositionMessage(pos, q.waitlistETALocked(q.waitlist[pos-1])),
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		log.Printf("error sending waitlist position: %v\n", err)
+		return
+	}
+	q.waitlistNotices[userID] = &waitlistNotice{
+		pos:         pos,
+		interaction: i.Interaction,
+		msgID:       m.ID,
+		sentAt:      time.Now(),
+	}
+}
+
+// updateWaitlistPositionsLocked tells waitlisted users their new position
+// when it changes, by editing their follow-up or else by DM.
+// lock must be held
+func (q *queueState) updateWaitlistPositionsLocked(s *discordgo.Session) {
+	waitlisted := make(map[string]bool)
+	for idx, m := range q.waitlist {
+		pos := idx + 1
+		waitlisted[m.ID] = true
+		n, ok := q.waitlistNotices[m.ID]
+		if !ok {
+			// Joined some other way, they're only told when they move
+			q.waitlistNotices[m.ID] = &waitlistNotice{pos: pos}
+			continue
+		}
+		if n.pos == pos {
+			continue
+		}
+		n.pos = pos
+		content := waitlistPositionMessage(pos, q.waitlistETALocked(m))
+		if n.interaction != nil && time.Since(n.sentAt) < interactionTokenTTL {
+			_, err := s.FollowupMessageEdit(n.interaction, n.msgID, &discordgo.WebhookEdit{Content: &content})
+			if err == nil {
+				continue
+			}
+			log.Printf("error editing waitlist position: %v\n", err)
+		}
+		q.notifyLocked(s, m.ID, notifyWaitlist, content)
+	}
+	for id, n := range q.waitlistNotices {
+		if waitlisted[id] {
+			continue
+		}
+		if n.interaction != nil && time.Since(n.sentAt) < interactionTokenTTL && q.inMainQueueLocked(id) {
+			content := "You got a slot in the queue!"
+			if _, err := s.FollowupMessageEdit(n.interaction, n.msgID, &discordgo.WebhookEdit{Content: &content}); err != nil {
+				log.Printf("error editing waitlist position: %v\n", err)
+			}
+		}
+		delete(q.waitlistNotices, id)
+	}
+}